@@ -7,12 +7,22 @@ import (
 	"syscall"
 	"tadl/pkg/app"
 	"tadl/pkg/app/config"
+	"time"
 
 	"github.com/urfave/cli/v2"
 	"github.com/womat/debug"
 )
 
-const defaultConfigFile = "/opt/womat/config/" + app.MODULE + ".yaml"
+const (
+	defaultConfigFile = "/opt/womat/config/" + app.MODULE + ".yaml"
+	// flushTimeout is the max time to flush the last state on a graceful exit (SIGTERM).
+	flushTimeout = 5 * time.Second
+)
+
+// flusher is implemented by the app, to save the last state before exit.
+type flusher interface {
+	Flush(time.Duration) error
+}
 
 func main() {
 	exitCode := 1
@@ -29,16 +39,21 @@ func main() {
 		Version: app.VERSION,
 		Description: "Read measurements of the UVR42 Controller and write values to mqtt" +
 			"\n the UVR42 Controller is manufactured by Technische Alternative: https://www.ta.co.at" +
-			"\n and the connection between UVR42 is implemented by DL-Bus (50Hz display clock).",
-		UsageText: "tadl [--conf <file>] [--log error|debug|trace]" +
+			"\n and the connection between UVR42 is implemented by DL-Bus (display clock see dlbus.clockhz, default 50Hz).",
+		UsageText: "tadl [--config <file>]... [--log error|debug|trace]" +
 			"\n\nEXAMPLE:" +
 			"\n\tstart the data logger and use the configuration file tadl.yaml" +
-			"\n\t\ttadl --conf /opt/womat/tadl.yaml",
+			"\n\t\ttadl --config /opt/womat/tadl.yaml" +
+			"\n\tstart the data logger with a base configuration and a host specific override" +
+			"\n\t\ttadl --config /opt/womat/base.yaml --config /opt/womat/host.yaml" +
+			"\n\nPRECEDENCE:" +
+			"\n\tdefaults < config files (in the given order, deep-merged) < command line flags",
 		Flags: []cli.Flag{
-			&cli.StringFlag{Name: "config", Aliases: []string{"c"}, Destination: &cfg.Flag.ConfigFile, Value: defaultConfigFile, Usage: "load configuration from `FILE`"},
+			&cli.StringSliceFlag{Name: "config", Aliases: []string{"c"}, Value: cli.NewStringSlice(defaultConfigFile), Usage: "load configuration from `FILE` (repeatable, later files override earlier ones)"},
 			&cli.StringFlag{Name: "log", Aliases: []string{"l"}, Destination: &cfg.Flag.LogLevel, Value: "standard", Usage: "`LEVEL` defines the log level (fatal|info|warning|error|debug|trace)"},
 		},
 		Action: func(ctx *cli.Context) error {
+			cfg.Flag.ConfigFiles = ctx.StringSlice("config")
 			if err := cfg.LoadConfig(); err != nil {
 				return err
 			}
@@ -61,18 +76,35 @@ func main() {
 
 			debug.InfoLog.Printf("starting app %s", app.Version())
 			if err = a.Run(); err != nil {
+				return err
 			}
 
 			// capture exit signals to ensure resources are released on exit.
-			quit := make(chan os.Signal)
-			signal.Notify(quit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+			quit := make(chan os.Signal, 1)
+			signal.Notify(quit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 			defer signal.Stop(quit)
 
-			// wait for am os.Interrupt signal (CTRL C)
-			sig := <-quit
-			debug.InfoLog.Printf("Got %s signal. Aborting...", sig)
-
-			return err
+			// wait for am os.Interrupt signal (CTRL C) or SIGTERM (e.g. systemd), SIGHUP reloads the config
+			// a requested restart (e.g. mqtt command) rebuilds the dl-bus pipeline without exiting the process
+			for {
+				select {
+				case <-a.Restart():
+					if err := a.RestartBus(); err != nil {
+						debug.ErrorLog.Printf("can't restart dl-bus: %v", err)
+					}
+				case sig := <-quit:
+					if sig == syscall.SIGHUP {
+						if c := reloadConfig(cfg); c != nil {
+							cfg = c
+							a.Reload(cfg)
+						}
+						continue
+					}
+
+					handleSignal(sig, a)
+					return err
+				}
+			}
 		},
 	}
 
@@ -90,3 +122,38 @@ func main() {
 	exitCode = 0
 	return
 }
+
+// reloadConfig reads the config files again and applies the log configuration.
+// It returns nil if the config is invalid.
+func reloadConfig(cfg *config.Config) *config.Config {
+	debug.InfoLog.Printf("reloading config %v", cfg.Flag.ConfigFiles)
+
+	c := config.NewConfig()
+	c.Flag = cfg.Flag
+	if err := c.LoadConfig(); err != nil {
+		debug.ErrorLog.Printf("can't reload config: %v", err)
+		return nil
+	}
+
+	debug.SetDebug(c.Log.File, c.Log.Flag)
+	if cfg.Log.File != c.Log.File {
+		_ = cfg.Log.File.Close()
+	}
+
+	return c
+}
+
+// handleSignal handles the exit signals:
+//  * SIGTERM: graceful exit, the last state is flushed to mqtt (limited by flushTimeout)
+//  * SIGINT (CTRL C): fast exit
+func handleSignal(sig os.Signal, f flusher) {
+	if sig != syscall.SIGTERM {
+		debug.InfoLog.Printf("Got %s signal. Aborting...", sig)
+		return
+	}
+
+	debug.InfoLog.Printf("Got %s signal. Flush and exit...", sig)
+	if err := f.Flush(flushTimeout); err != nil {
+		debug.ErrorLog.Printf("flush failed: %v", err)
+	}
+}
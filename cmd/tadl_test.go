@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testFlusher records the calls of Flush.
+type testFlusher struct {
+	calls   int
+	timeout time.Duration
+}
+
+// Flush records the call and the timeout.
+func (f *testFlusher) Flush(timeout time.Duration) error {
+	f.calls++
+	f.timeout = timeout
+	return nil
+}
+
+func TestHandleSignal(t *testing.T) {
+	tests := []struct {
+		sig   os.Signal
+		flush bool
+	}{
+		{sig: syscall.SIGTERM, flush: true},
+		{sig: syscall.SIGINT, flush: false},
+		{sig: os.Interrupt, flush: false},
+	}
+
+	for _, tt := range tests {
+		var f testFlusher
+		handleSignal(tt.sig, &f)
+
+		if got := f.calls == 1; got != tt.flush {
+			t.Errorf("%v: got flush %v (%v calls), want %v", tt.sig, got, f.calls, tt.flush)
+		}
+		if tt.flush && f.timeout != flushTimeout {
+			t.Errorf("%v: got flush timeout %v, want %v", tt.sig, f.timeout, flushTimeout)
+		}
+	}
+}
@@ -3,10 +3,10 @@ module tadl
 go 1.16
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.3.4
 	github.com/gofiber/fiber/v2 v2.20.1
 	github.com/urfave/cli/v2 v2.3.0
 	github.com/warthog618/gpiod v0.8.0
 	github.com/womat/debug v0.0.3
-	github.com/womat/mqtt v0.2.0
 	gopkg.in/yaml.v2 v2.4.0
 )
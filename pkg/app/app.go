@@ -1,17 +1,23 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/url"
+	"os"
 	"sync"
 	"tadl/pkg/app/config"
 	"tadl/pkg/datalogger"
 	"tadl/pkg/dlbus"
 	"tadl/pkg/manchester"
+	"tadl/pkg/mqtt"
+	"tadl/pkg/mqttmem"
 	"tadl/pkg/raspberry"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/womat/debug"
-	"github.com/womat/mqtt"
 )
 
 // App is the main application struct and where the application is wired up.
@@ -31,11 +37,14 @@ type App struct {
 	mqtt mqtt.PublisherSubscriber
 
 	// chip is the handler to the rpi gpio memory.
-	chip *raspberry.Chip
+	chip raspberry.LineRequester
 
 	// gpio is the handler to the rpi gpio.
 	gpio *raspberry.Line
 
+	// busCancel cancels the context of the gpio line (it's cancelled by closeBus or the shutdown of the app).
+	busCancel context.CancelFunc
+
 	// decoder ist the handler of the manchester decoder
 	decoder *manchester.Decoder
 
@@ -46,22 +55,127 @@ type App struct {
 	// dl is the handler to the data logger.
 	dl datalogger.DL
 
+	// history contains the last read data frames.
+	history *history
+	// memory is the memory budget shared by the history and the watchpoint trace.
+	memory *memoryBudget
+
+	// quality tracks the decoding quality to withhold data frames during a marginal lock.
+	quality *quality
+
+	// median is the median filter of the temperatures.
+	median *medianFilter
+
+	// edges detects the transitions of the outputs.
+	edges *edgeDetector
+
+	// capture writes the raw edges of the first frames after startup to a file (nil if disabled).
+	capture *capture
+
+	// watchpoint writes the latest edges to a file, if its condition becomes true (nil if disabled).
+	watchpoint *watchpoint
+
+	// bus protects the handlers of the dl-bus pipeline (chip, gpio, decoder, dlbus, dl) and the config
+	// during a warm restart or a config reload.
+	bus sync.Mutex
+
+	// reload contains the latest requested config of a debounced config reload.
+	reload struct {
+		sync.Mutex
+		config *config.Config
+		timer  *time.Timer
+		// apply serializes the application of config changes.
+		apply sync.Mutex
+	}
+
 	// DataFrame contains the last read data frame of uvr42.
 	DataFrame struct {
 		sync.Mutex
 		data interface{}
 	}
 
-	// mqttData contains the last sent data frame to mqtt.
+	// mqttData contains the last sent data frame to mqtt per device (see frameDevice).
 	mqttData struct {
 		sync.Mutex
-		data interface{}
+		data map[string]interface{}
 	}
 
-	// restart signals application restart.
+	// binary publishes the data frames in the binary format (mqtt.format).
+	binary bool
+	// qos and retained are the qos and the retained flag of the data frames (mqtt.qos, mqtt.retained).
+	qos      byte
+	retained bool
+	// influx writes the data frames to an InfluxDB (nil if influxdb.url isn't defined).
+	influx *influxWriter
+	// timeFormat is the format of the time stamps of the mqtt messages (mqtt.timeformat, mqtt.timezone).
+	timeFormat timeFormat
+
+	// publishers detects a second publisher of our topics (nil if mqtt.detectduplicates is disabled).
+	publishers *publisherMonitor
+
+	// publishQueue contains the messages to publish in order (nil if mqtt.strictorder is disabled).
+	publishQueue chan outgoing
+
+	// runtime accumulates the on-time of the outputs (nil if runtime.enabled is disabled).
+	runtime *runtimeMeter
+
+	// ready is closed, when the first data frame is published (see WaitReady).
+	ready chan struct{}
+	// readyOnce guarantees that ready is closed only once.
+	readyOnce sync.Once
+
+	// restart signals a requested warm restart of the dl-bus pipeline (see triggerRestart).
 	restart chan struct{}
-	// shutdown signals application shutdown.
-	shutdown chan struct{}
+	// connects signals a (re)connect to the mqtt broker (see connected).
+	connects chan struct{}
+	// ctx is the root context of the application, it's cancelled by Close to stop the goroutines (shutdown).
+	ctx context.Context
+	// cancel cancels the root context.
+	cancel context.CancelFunc
+	// wg waits for the goroutines of the application (see goRun).
+	wg sync.WaitGroup
+}
+
+// reloadDelay is the quiet period of config reloads, only the latest config is applied.
+//  It's a variable to be able to shorten the quiet period (e.g. in tests).
+var reloadDelay = time.Second
+
+// publishQueueSize is the maximum number of messages waiting to be published in order (see mqtt.strictorder).
+const publishQueueSize = 100
+
+// shutdownTimeout is the maximum time to wait for the goroutines and the web server on Close.
+const shutdownTimeout = 5 * time.Second
+
+// memoryBroker is the connection string of the in-memory mqtt broker (e.g. to run without a mqtt broker).
+const memoryBroker = "memory://"
+
+// newMQTT generates the mqtt handler and connects to the mqtt broker of the configuration c,
+// onConnect is called after each (re)connect.
+//  The connection memory:// uses an in-memory broker, which is connected immediately.
+//  It's a variable to be able to inject an own handler (e.g. in tests).
+var newMQTT = func(c config.MQTTConfig, onConnect func()) (mqtt.PublisherSubscriber, error) {
+	if c.Connection == memoryBroker {
+		onConnect()
+		return mqttmem.New(), nil
+	}
+
+	h, err := mqtt.Connect(mqtt.Options{
+		Broker:               c.Connection,
+		ClientID:             c.ClientID,
+		Username:             c.Username,
+		Password:             c.Password,
+		TLS:                  c.TLS.Enabled,
+		CAFile:               c.TLS.CA,
+		CertFile:             c.TLS.Cert,
+		KeyFile:              c.TLS.Key,
+		Will:                 mqtt.Will{Topic: c.Will.Topic, Online: c.Will.Online, Offline: c.Will.Offline},
+		MaxReconnectInterval: c.MaxReconnectInterval,
+		OnConnect:            onConnect,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
 }
 
 // New checks the Web server URL and initialize the main app structure
@@ -76,60 +190,236 @@ func New(config *config.Config) (*App, error) {
 		config:    config,
 		urlParsed: u,
 		web:       fiber.New(),
-		restart:   make(chan struct{}),
-		shutdown:  make(chan struct{}),
+		memory:    newMemoryBudget(config.History.MaxMemory),
+		restart:   make(chan struct{}, 1),
+		connects:  make(chan struct{}, 1),
+		ready:     make(chan struct{}),
 	}
+	app.history = newHistory(config.History.Size, app.memory)
+	app.ctx, app.cancel = context.WithCancel(context.Background())
 
 	return &app, err
 }
 
+// goRun runs the function f as goroutine, which is waited for by Close.
+//  The function must return, if the root context is done.
+func (app *App) goRun(f func()) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		f()
+	}()
+}
+
 // Run starts the application.
 func (app *App) Run() error {
 	if err := app.init(); err != nil {
 		return err
 	}
 
-	go app.runWebServer()
+	app.goRun(app.runWebServer)
 
 	// receive data frames from datalogger and sent it to mqtt broker
-	go app.run()
+	app.goRun(app.run)
+
+	if i := app.config.MQTT.RepublishInterval; i > 0 {
+		app.goRun(func() { app.republish(i) })
+	}
+	if i := app.config.MQTT.Heartbeat; i > 0 {
+		app.goRun(func() { app.runHeartbeat(i) })
+	}
 
 	return nil
 }
 
 // init initializes the used modules of the application:
-//  * check if data logger type is supported
+//  * dl-bus pipeline (gpio pin, manchester decoder, dlbus decoder, data logger)
 //	* mqtt
+func (app *App) init() (err error) {
+	if c := app.config.Capture; c.Frames > 0 {
+		if app.capture, err = newCapture(c.File, c.Frames); err != nil {
+			debug.ErrorLog.Printf("can't create capture file: %v", err)
+			return err
+		}
+	}
+
+	if c := app.config.Watchpoint; c.Condition != "" {
+		if app.watchpoint, err = newWatchpoint(c.Condition, c.File, c.Events, app.memory); err != nil {
+			debug.ErrorLog.Printf("can't arm watchpoint: %v", err)
+			return err
+		}
+	}
+
+	if c := app.config.Runtime; c.Enabled {
+		if app.runtime, err = newRuntimeMeter(c.File); err != nil {
+			debug.ErrorLog.Printf("can't read runtime file: %v", err)
+			return err
+		}
+	}
+
+	if err = app.initBus(); err != nil {
+		return err
+	}
+
+	if c := app.config.InfluxDB; c.URL != "" {
+		host, _ := os.Hostname()
+		app.influx = newInfluxWriter(c.URL, c.Token, host, c.FlushInterval, c.MaxLines)
+	}
+
+	// initialize mqtt handler and connect to mqtt broker
+	if app.mqtt, err = newMQTT(app.config.MQTT, app.connected); err != nil {
+		debug.ErrorLog.Printf("can't open mqtt broker %v", err)
+		return err
+	}
+	app.binary = app.config.MQTT.Format == "binary"
+	app.qos, app.retained = byte(app.config.MQTT.Qos), app.config.MQTT.Retained
+	if app.timeFormat, err = newTimeFormat(app.config.MQTT.TimeFormat, app.config.MQTT.TimeZone); err != nil {
+		debug.ErrorLog.Printf("can't set mqtt time format: %v", err)
+		return err
+	}
+	if app.config.MQTT.DetectDuplicates {
+		app.publishers = newPublisherMonitor()
+		if err = app.monitorTopic(); err != nil {
+			debug.ErrorLog.Printf("can't subscribe mqtt topic %v", err)
+			return err
+		}
+	}
+	if app.config.MQTT.Commands {
+		if err = app.subscribeCommands(); err != nil {
+			debug.ErrorLog.Printf("can't subscribe mqtt command topic %v", err)
+			return err
+		}
+	}
+	if app.config.MQTT.StrictOrder {
+		app.publishQueue = make(chan outgoing, publishQueueSize)
+		app.goRun(app.runPublisher)
+	}
+	app.goRun(app.runOnConnect)
+
+	// initRoutes and initDefaultRoutes should be always called last because it may access things like app.api
+	// which must be initialized before in initAPI()
+	app.initDefaultRoutes()
+
+	return nil
+}
+
+// initBus initializes the dl-bus pipeline:
+//  * check if data logger type is supported
 //	* gpio pin
+//	* manchester decoder
+//	* dlbus decoder
 //	* data logger
-func (app *App) init() (err error) {
+func (app *App) initBus() (err error) {
 	// initialize gpio
-	if app.chip, err = raspberry.Open(); err != nil {
+	if app.chip, err = openChip(app.config.DLbus.Chip); err != nil {
 		debug.ErrorLog.Printf("can't open chip: %v", err)
 		return err
 	}
 
 	// requests control of gpio pin
-	if app.gpio, err = app.chip.NewLine(app.config.DLbus.Gpio, app.config.DLbus.Terminator, app.config.DLbus.DebouncePeriod); err != nil {
+	lineOpts := []raspberry.LineOption{raspberry.WithBuffer(app.config.DLbus.GpioBuffer)}
+	if app.config.DLbus.ActiveLow {
+		lineOpts = append(lineOpts, raspberry.WithActiveLow())
+	}
+	if app.config.DLbus.HardwareDebounce {
+		lineOpts = append(lineOpts, raspberry.WithHardwareDebounce())
+	}
+	// the line is released by closeBus or on application shutdown
+	ctx, cancel := context.WithCancel(app.ctx)
+	app.busCancel = cancel
+	if app.gpio, err = app.chip.NewLineContext(ctx, app.config.DLbus.Gpio, app.config.DLbus.Terminator, app.config.DLbus.DebouncePeriod,
+		lineOpts...); err != nil {
 		debug.ErrorLog.Printf("can't open to gpio: %v", err)
 		return err
 	}
+	go checkLevel(app.gpio)
 
 	// start manchaster decoder
-	decoder := manchester.New(app.gpio.C)
+	opts := []manchester.Option{
+		manchester.WithClockRange(app.config.DLbus.ClockHz, app.config.DLbus.ClockTolerance),
+		manchester.WithSensitivity(app.config.DLbus.Sensitivity),
+		manchester.WithSampleCount(app.config.DLbus.ClockSamples),
+		manchester.WithGapTimeout(app.config.DLbus.GapTimeout),
+		manchester.WithQuietStart(app.config.DLbus.QuietStart),
+		manchester.WithDriftCorrection(app.config.DLbus.DriftAlpha),
+	}
+	if app.config.DLbus.Convention == "ieee" {
+		opts = append(opts, manchester.WithConvention(manchester.IEEEConvention))
+	}
+	if app.config.DLbus.FixedClock {
+		opts = append(opts, manchester.WithFixedClock(app.config.DLbus.ClockHz))
+	}
+	events := app.gpio.C
+	if app.capture != nil {
+		events = app.capture.tap(events)
+	}
+	if app.watchpoint != nil {
+		events = app.watchpoint.tap(events)
+	}
+	if app.decoder, err = manchester.NewWithOptions(events, opts...); err != nil {
+		debug.ErrorLog.Printf("can't start manchester decoder: %v", err)
+		return err
+	}
 
 	// start dlbus decoder
-	app.dlbus = dlbus.NewReader(decoder.C)
+	dlbusOpts := []dlbus.Option{
+		dlbus.WithMaxFrameLen(app.config.DLbus.MaxFrameLen),
+		dlbus.WithSyncTimeout(app.config.DLbus.SyncTimeout),
+		dlbus.WithFrameTimeout(app.config.DLbus.FrameTimeout),
+		dlbus.WithQueueSize(app.config.DLbus.QueueSize),
+	}
+	if app.config.DLbus.BitOrder == "msb" {
+		dlbusOpts = append(dlbusOpts, dlbus.WithBitOrder(dlbus.MSBFirst))
+	}
+	if app.config.DLbus.Polarity == "inverted" {
+		dlbusOpts = append(dlbusOpts, dlbus.WithFrameFormat(dlbus.InvertedFrameFormat))
+	}
+	if app.config.DLbus.Checksum {
+		dlbusOpts = append(dlbusOpts, dlbus.WithChecksum())
+	}
+	if app.dlbus, err = dlbus.NewReaderWithOptions(app.decoder.C, dlbusOpts...); err != nil {
+		debug.ErrorLog.Printf("can't start dlbus decoder: %v", err)
+		return err
+	}
 
 	// initialize datalogger reader
 	switch t := app.config.DataLogger.Type; t {
 	case "uvr42":
-		app.dl = datalogger.NewUVR42()
-		app.DataFrame.data = datalogger.UVR42Frame{}
-		app.mqttData.data = datalogger.UVR42Frame{}
+		h := datalogger.NewUVR42()
+		h.SetInputTypes(inputTypes(app.config.DataLogger.InputTypes)...)
+		h.SetTypedInputs(app.config.DataLogger.TypedInputs)
+		h.SetMaxDelta(app.config.DataLogger.MaxDelta)
+		h.SetScale(app.scale())
+		h.SetDelimiter(app.delimiter())
+		app.dl = h
+	case "uvr31":
+		h := datalogger.NewUVR31()
+		h.SetScale(app.scale())
+		h.SetDelimiter(app.delimiter())
+		app.dl = h
+	case "uvr1611":
+		h := datalogger.NewUVR1611()
+		h.SetInputTypes(inputTypes(app.config.DataLogger.InputTypes)...)
+		h.SetScale(app.scale())
+		h.SetDelimiter(app.delimiter())
+		app.dl = h
+	case "raw":
+		h := datalogger.NewRaw()
+		h.SetDelimiter(app.delimiter())
+		app.dl = h
+	case "auto":
+		h := datalogger.NewAuto()
+		h.SetDelimiter(app.delimiter())
+		app.dl = h
 	default:
 		debug.ErrorLog.Printf("unsupported data logger: %q", t)
+		return fmt.Errorf("unsupported data logger: %q", t)
 	}
+	app.clearFrames()
+
+	app.median = newMedianFilter(app.config.DataLogger.MedianWindow)
+	app.quality = newQuality(app.config.DataLogger.MaxErrorRate, app.config.DataLogger.ErrorWindow)
+	app.edges = newEdgeDetector()
 
 	// start datenlogger reader
 	if err = app.dl.Connect(app.dlbus); err != nil {
@@ -137,42 +427,266 @@ func (app *App) init() (err error) {
 		return err
 	}
 
-	// initialize mqtt handler and connect to mqtt broker
-	if app.mqtt, err = mqtt.New(app.config.MQTT.Connection); err != nil {
-		debug.ErrorLog.Printf("can't open mqtt broker %v", err)
+	return nil
+}
+
+// inputTypes converts the configured sensor types of the inputs (validated by LoadConfig).
+func inputTypes(names []string) []datalogger.SensorType {
+	types := make([]datalogger.SensorType, len(names))
+	for i, n := range names {
+		types[i], _ = datalogger.ParseSensorType(n)
+	}
+	return types
+}
+
+// deviceInputs returns the configured sensor types, the unit of the temperatures and the labels of the inputs of
+// the device (see frameDevice). The configuration is used by the handler of the datalogger type only,
+// the handlers of the datalogger type auto use the transmitted types and the default scale.
+// The config must be locked by the caller.
+func (app *App) deviceInputs(device string) (types []datalogger.SensorType, unit datalogger.Unit, labels []string) {
+	if device != app.config.DataLogger.Type {
+		return nil, datalogger.DefaultScale.Unit, nil
+	}
+	return inputTypes(app.config.DataLogger.InputTypes), app.scale().Unit, app.config.DataLogger.Labels
+}
+
+// levelSamples is the count of samples (in the interval levelSampleInterval) of the startup level check.
+const (
+	levelSamples        = 20
+	levelSampleInterval = 5 * time.Millisecond
+)
+
+// checkLevel samples the level of the line after startup and warns, if the line is stuck high or low
+// (e.g. wrong wiring or terminator), because the dl-bus transmits continuously.
+func checkLevel(l *raspberry.Line) {
+	level, err := l.Value()
+	if err != nil {
+		debug.ErrorLog.Printf("can't read gpio level: %v", err)
+		return
+	}
+
+	for i := 1; i < levelSamples; i++ {
+		time.Sleep(levelSampleInterval)
+
+		v, err := l.Value()
+		if err != nil {
+			// the line is closed (e.g. restart)
+			return
+		}
+		if v != level {
+			return
+		}
+	}
+
+	if l.Stats().Events == 0 {
+		debug.WarningLog.Printf("gpio is stuck at level %v for %v, check the wiring and the terminator",
+			level, levelSamples*levelSampleInterval)
+	}
+}
+
+// openChip opens the gpio chip name, the name mock opens an emulated chip (e.g. to run without a raspberry pi).
+//  On an operating system without gpio chips (e.g. windows) the emulated chip is used instead.
+func openChip(name string) (raspberry.LineRequester, error) {
+	if name == "mock" {
+		return raspberry.NewMockChip(), nil
+	}
+
+	c, err := raspberry.OpenChip(name)
+	switch {
+	case errors.Is(err, raspberry.ErrNotSupported):
+		debug.WarningLog.Printf("gpio chip %q isn't supported, using the emulated chip", name)
+		return raspberry.NewMockChip(), nil
+	case err != nil:
+		return nil, err
+	}
+	return c, nil
+}
+
+// scale returns the configured scaling of the temperatures.
+//  The unit is validated by config.LoadConfig.
+func (app *App) scale() datalogger.Scale {
+	u, _ := datalogger.ParseUnit(app.config.DataLogger.Unit)
+	return datalogger.Scale{Factor: app.config.DataLogger.Scale, Unit: u}
+}
+
+// delimiter returns the configured self-delimitation of the data frames (datalogger.delimiter).
+func (app *App) delimiter() datalogger.Delimiter {
+	d := app.config.DataLogger.Delimiter
+	return datalogger.Delimiter{LengthOffset: d.LengthOffset, Terminated: d.Terminated, Terminator: byte(d.Terminator)}
+}
+
+// clearFrames clears the last read data frame and the last sent data frames (no data frame received yet).
+//  The store isn't seeded with a zero frame, it would be published as a received data frame (e.g. by Flush).
+func (app *App) clearFrames() {
+	app.setLatestFrame(nil)
+
+	app.mqttData.Lock()
+	app.mqttData.data = map[string]interface{}{}
+	app.mqttData.Unlock()
+}
+
+// closeBus closes all handler of the dl-bus pipeline in reverse order:
+//  * data logger
+//  * dlbus decoder
+//  * manchester decoder
+//  * gpio
+func (app *App) closeBus() {
+	if app.dl != nil {
+		_ = app.dl.Close()
+		app.dl = nil
+	}
+	if app.dlbus != nil {
+		_ = app.dlbus.Close()
+		app.dlbus = nil
+	}
+	if app.decoder != nil {
+		_ = app.decoder.Close()
+		app.decoder = nil
+	}
+	if app.gpio != nil {
+		_ = app.gpio.Close()
+		app.gpio = nil
+	}
+	if app.busCancel != nil {
+		app.busCancel()
+		app.busCancel = nil
+	}
+	if app.chip != nil {
+		_ = app.chip.Close()
+		app.chip = nil
+	}
+}
+
+// RestartBus tears down and rebuilds the dl-bus pipeline (warm restart), e.g. after a watchdog timeout.
+//  Only gpio, decoders and data logger are recreated, the mqtt connection and the web server persist.
+//  After Close the pipeline isn't rebuilt, the gpio line would leak.
+func (app *App) RestartBus() error {
+	app.bus.Lock()
+	defer app.bus.Unlock()
+
+	if err := app.ctx.Err(); err != nil {
 		return err
 	}
 
-	// initRoutes and initDefaultRoutes should be always called last because it may access things like app.api
-	// which must be initialized before in initAPI()
-	app.initDefaultRoutes()
+	debug.InfoLog.Print("restarting dl-bus")
+	app.closeBus()
+	return app.initBus()
+}
 
-	return nil
+// Reload requests to apply a new configuration, e.g. after SIGHUP.
+//  Rapid requests are coalesced (debounced), only the latest configuration is applied after a quiet period.
+//  The dl-bus pipeline is rebuilt with the new configuration, changes of the mqtt connection and
+//  the web server are applied on the next start of the application.
+func (app *App) Reload(c *config.Config) {
+	app.reload.Lock()
+	defer app.reload.Unlock()
+
+	app.reload.config = c
+	if app.reload.timer == nil {
+		app.reload.timer = time.AfterFunc(reloadDelay, app.applyReload)
+		return
+	}
+	app.reload.timer.Reset(reloadDelay)
 }
 
-// Restart returns the read only restart channel.
-//  It is used to be able to react on application restart (see cmd/main.go).
+// applyReload applies the latest requested configuration.
+func (app *App) applyReload() {
+	app.reload.apply.Lock()
+	defer app.reload.apply.Unlock()
+
+	app.reload.Lock()
+	c := app.reload.config
+	app.reload.config = nil
+	app.reload.Unlock()
+
+	if c == nil {
+		return
+	}
+
+	app.bus.Lock()
+	defer app.bus.Unlock()
+
+	if app.ctx.Err() != nil {
+		// the application is closed
+		return
+	}
+
+	debug.InfoLog.Print("reloading config")
+	app.config = c
+	app.closeBus()
+	if err := app.initBus(); err != nil {
+		debug.ErrorLog.Printf("can't apply config: %v", err)
+	}
+}
+
+// triggerRestart requests a warm restart of the dl-bus pipeline without blocking the caller (e.g. a mqtt handler).
+//  The restart is executed by the receiver of the restart channel (see Restart and cmd/tadl.go),
+//  a request is dropped, if a restart is already pending.
+func (app *App) triggerRestart() {
+	select {
+	case app.restart <- struct{}{}:
+	default:
+		debug.DebugLog.Print("restart is already pending")
+	}
+}
+
+// Restart returns the read only restart channel, which signals a requested warm restart (see triggerRestart).
+//  It is used to be able to react on application restart (see cmd/main.go), the receiver calls RestartBus.
 func (app *App) Restart() <-chan struct{} {
 	return app.restart
 }
 
-// Shutdown returns the read only shutdown channel.
+// Shutdown returns the read only shutdown channel, which is closed by Close.
 //  It is used to be able to react on application shutdown (see cmd/main.go).
 func (app *App) Shutdown() <-chan struct{} {
-	return app.shutdown
+	return app.ctx.Done()
 }
 
-// Close all handler used by app:
+// Close shuts the application down and closes all handler used by app:
+//  * root context (stops the goroutines, see Shutdown)
+//  * web server
+//  * dl-bus pipeline (data logger, decoders, gpio)
+//  * influxdb (the buffered lines are written)
 //  * mqtt
-//  * data logger
-//  * gpio
+//  * capture file
+// The goroutines are waited for up to shutdownTimeout, so the queued messages are published before mqtt is closed.
 func (app *App) Close() error {
-	_ = app.mqtt.Close()
-	_ = app.dl.Close()
-	_ = app.dlbus.Close()
-	//_ = app.decoder.Close()
-	_ = app.gpio.Close()
-	_ = app.chip.Close()
+	if app.cancel != nil {
+		app.cancel()
+	}
+	if app.web != nil {
+		if err := app.web.Shutdown(); err != nil {
+			debug.ErrorLog.Printf("web server shutdown: %v", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		app.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		debug.WarningLog.Printf("shutdown timeout, goroutines didn't stop within %v", shutdownTimeout)
+	}
+
+	app.bus.Lock()
+	app.closeBus()
+	app.bus.Unlock()
+
+	if app.influx != nil {
+		_ = app.influx.Close()
+	}
+	if app.mqtt != nil {
+		_ = app.mqtt.Close()
+	}
+	if app.capture != nil {
+		_ = app.capture.Close()
+	}
+	if app.runtime != nil {
+		_ = app.runtime.Close()
+	}
 
 	return nil
 }
@@ -0,0 +1,349 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tadl/pkg/app/config"
+	"tadl/pkg/datalogger"
+	"tadl/pkg/dlbus"
+	"tadl/pkg/mqtt"
+	"tadl/pkg/mqttmem"
+	"tadl/pkg/port"
+	"tadl/pkg/raspberry"
+)
+
+// newTestApp returns an app of the datalogger type device, which publishes to an in-memory broker.
+//  The dl-bus pipeline isn't initialized, the data frames are passed to app.store by the test.
+func newTestApp(t *testing.T, device string) (*App, *mqttmem.Broker) {
+	t.Helper()
+
+	c := config.NewConfig()
+	c.DataLogger.Type = device
+	c.MQTT.Topic = "tadl"
+	c.MQTT.StrictOrder = false
+
+	app, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := mqttmem.New()
+	app.mqtt = b
+	app.retained = c.MQTT.Retained
+	app.clearFrames()
+
+	t.Cleanup(func() { _ = app.Close() })
+	return app, b
+}
+
+// waitMessages waits until the broker received n messages of the topic and returns the messages of the topic.
+func waitMessages(t *testing.T, b *mqttmem.Broker, topic string, n int) []mqtt.Message {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		msgs := topicMessages(b, topic)
+		if len(msgs) >= n {
+			return msgs
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %v messages of topic %q, want %v", len(msgs), topic, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// topicMessages returns the messages of the topic, which are received by the broker.
+func topicMessages(b *mqttmem.Broker, topic string) []mqtt.Message {
+	var msgs []mqtt.Message
+	for _, m := range b.Messages() {
+		if m.Topic == topic {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+// busEvents returns the line events of the data frames, which are sent as manchester encoded dl-bus signal.
+//  The bits are encoded by the Thomas convention (a falling mid-bit edge is a High), signalT is the half bit period.
+func busEvents(t *testing.T, signalT time.Duration, frames ...[]byte) []port.Event {
+	t.Helper()
+
+	c := make(chan port.StateType, 4096)
+	w := dlbus.NewWriter(c)
+	for _, b := range frames {
+		if _, err := w.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = w.Close()
+
+	var evts []port.Event
+	var ts time.Duration
+	level := port.Low
+	for bit := range c {
+		// the first half bit is the level of the bit, the mid-bit edge inverts it
+		for _, half := range []port.StateType{bit, 1 - bit} {
+			if half != level {
+				e := port.Event{Timestamp: ts, Type: port.RisingEdge}
+				if half == port.Low {
+					e.Type = port.FallingEdge
+				}
+				evts = append(evts, e)
+				level = half
+			}
+			ts += signalT
+		}
+	}
+	return evts
+}
+
+// pushFrame pushes the data frame b as dl-bus signal (50 Hz) to the emulated gpio line of the app.
+//  The frame is repeated, the first events are consumed by the clock discovery (see config DLbus.ClockSamples).
+func pushFrame(t *testing.T, app *App, b []byte) {
+	t.Helper()
+
+	app.bus.Lock()
+	chip, ok := app.chip.(*raspberry.MockChip)
+	app.bus.Unlock()
+	if !ok {
+		t.Fatalf("got chip %T, want the emulated chip", app.chip)
+	}
+
+	l := chip.Line(app.config.DLbus.Gpio)
+	for _, e := range busEvents(t, 10*time.Millisecond, b, b, b) {
+		l.Push(e)
+	}
+}
+
+func TestRestartBus(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	app.config.DLbus.Chip = "mock"
+	app.config.DLbus.GpioBuffer = 4096
+	app.config.DLbus.ClockSamples = 100
+	if err := app.initBus(); err != nil {
+		t.Fatal(err)
+	}
+	app.goRun(app.run)
+
+	// uvr42 frame with the untyped temperatures temp and 21.0 °C (0.1 °C resolution)
+	frame := func(temp uint16) []byte {
+		b := []byte{0x10}
+		for _, v := range []uint16{temp, 210, 210, 210} {
+			b = append(b, byte(v), byte(v>>8))
+		}
+		return append(b, 0)
+	}
+	// waitTemperature waits until a frame of the temperature is published
+	waitTemperature := func(want float64) {
+		t.Helper()
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			for _, m := range topicMessages(b, "tadl") {
+				var f datalogger.UVR42Frame
+				if err := json.Unmarshal(m.Payload, &f); err != nil {
+					t.Fatalf("invalid json payload %s: %v", m.Payload, err)
+				}
+				if f.Temperature1 == want {
+					return
+				}
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("got no published frame of temperature %v", want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	pushFrame(t, app, frame(455))
+	waitTemperature(45.5)
+
+	client, line := app.mqtt, app.gpio
+	if err := app.RestartBus(); err != nil {
+		t.Fatal(err)
+	}
+	if app.mqtt != client {
+		t.Errorf("got mqtt handler %p after restart, want the unchanged handler %p", app.mqtt, client)
+	}
+	if app.gpio == line {
+		t.Error("got the same gpio line after restart, want a new line")
+	}
+
+	// decoding resumes on the rebuilt pipeline and publishes to the same mqtt handler
+	pushFrame(t, app, frame(300))
+	waitTemperature(30)
+}
+
+func TestInitBusDelimiter(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	app.config.DLbus.Chip = "mock"
+	app.config.DLbus.GpioBuffer = 4096
+	app.config.DLbus.ClockSamples = 100
+	app.config.DataLogger.Delimiter = config.DataLoggerDelimiterConfig{LengthOffset: 1, Terminated: true, Terminator: 0x55}
+	if err := app.initBus(); err != nil {
+		t.Fatal(err)
+	}
+	app.goRun(app.run)
+
+	// uvr42 frame with the untyped temperatures 45.5 and 21.0 °C, the length byte and the terminator
+	frame := []byte{0x10, 12}
+	for _, v := range []uint16{455, 210, 210, 210} {
+		frame = append(frame, byte(v), byte(v>>8))
+	}
+	pushFrame(t, app, append(frame, 0, 0x55))
+
+	var f datalogger.UVR42Frame
+	if err := json.Unmarshal(waitMessages(t, b, "tadl", 1)[0].Payload, &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Temperature1 != 45.5 || f.Temperature4 != 21 {
+		t.Errorf("got frame %+v of the delimited frame, want temperatures 45.5 and 21", f)
+	}
+}
+
+func TestReload(t *testing.T) {
+	defer func(d time.Duration) { reloadDelay = d }(reloadDelay)
+	reloadDelay = 50 * time.Millisecond
+
+	app, _ := newTestApp(t, "uvr42")
+	app.config.DLbus.Chip = "mock"
+	if err := app.initBus(); err != nil {
+		t.Fatal(err)
+	}
+	initial := app.config
+
+	// rapid reloads within the quiet period
+	var configs []*config.Config
+	for i := 0; i < 5; i++ {
+		c := *initial
+		c.DLbus.Gpio = i + 1
+		configs = append(configs, &c)
+		app.Reload(&c)
+		time.Sleep(reloadDelay / 5)
+	}
+
+	// record each applied config until the quiet period is over twice
+	applied := map[*config.Config]bool{}
+	for deadline := time.Now().Add(4 * reloadDelay); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		app.bus.Lock()
+		applied[app.config] = true
+		app.bus.Unlock()
+	}
+
+	final := configs[len(configs)-1]
+	if !applied[final] {
+		t.Fatalf("got applied configs %v, want the final config %p", applied, final)
+	}
+	for i, c := range configs[:len(configs)-1] {
+		if applied[c] {
+			t.Errorf("got applied config %v, want only the final config", i)
+		}
+	}
+
+	app.bus.Lock()
+	chip, gpio := app.chip.(*raspberry.MockChip), app.config.DLbus.Gpio
+	app.bus.Unlock()
+	if gpio != 5 || chip.Line(5) == nil {
+		t.Errorf("got gpio %v, want the dl-bus pipeline of the final config (gpio 5)", gpio)
+	}
+}
+
+func TestReloadRequests(t *testing.T) {
+	defer func(d time.Duration) { reloadDelay = d }(reloadDelay)
+	reloadDelay = time.Millisecond
+
+	app, _ := newTestApp(t, "uvr42")
+	app.config.DLbus.Chip = "mock"
+	app.config.Webserver.Token = "secret"
+	if err := app.initBus(); err != nil {
+		t.Fatal(err)
+	}
+	app.web.Get("/metrics", app.HandleMetrics())
+	app.web.Post("/test/frame", app.HandleTestFrame())
+	app.setLatestFrame(datalogger.UVR42Frame{TimeStamp: time.Now(), Temperature1: 45.5})
+	initial := app.config
+
+	// the requests read the config, while it's replaced by reloads (see go test -race)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			c := *initial
+			c.DataLogger.Labels = []string{fmt.Sprintf("collector%v", i)}
+			app.Reload(&c)
+			time.Sleep(2 * time.Millisecond)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest("POST", "/test/frame", strings.NewReader(`{"Temperature1":45.5}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer secret")
+		for _, r := range []*http.Request{httptest.NewRequest("GET", "/metrics", nil), req} {
+			resp, err := app.web.Test(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("got status %v of %v, want %v", resp.StatusCode, r.URL, http.StatusOK)
+			}
+		}
+	}
+	wg.Wait()
+}
+
+func TestInitBusType(t *testing.T) {
+	tests := []struct {
+		device string
+		want   string
+	}{
+		{"uvr42", "*datalogger.UVR42Handler"},
+		{"uvr31", "*datalogger.UVR31Handler"},
+		{"uvr1611", "*datalogger.UVR1611Handler"},
+		{"raw", "*datalogger.RawHandler"},
+		{"auto", "*datalogger.MultiHandler"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.device, func(t *testing.T) {
+			f := filepath.Join(t.TempDir(), "tadl.yaml")
+			if err := os.WriteFile(f, []byte("datalogger:\n  type: "+tt.device+"\ndlbus:\n  chip: mock\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			c := config.NewConfig()
+			c.Flag.ConfigFiles = []string{f}
+			if err := c.LoadConfig(); err != nil {
+				t.Fatal(err)
+			}
+
+			app, err := New(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer app.Close()
+
+			if err = app.initBus(); err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprintf("%T", app.dl); got != tt.want {
+				t.Errorf("got data logger %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	app, _ := newTestApp(t, "uvr64")
+	app.config.DLbus.Chip = "mock"
+	if err := app.initBus(); err == nil {
+		t.Errorf("got data logger %T of an unsupported type, want an error", app.dl)
+	}
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+
+	"tadl/pkg/port"
+
+	"github.com/womat/debug"
+)
+
+// capture writes the raw line events (edges) after startup to a file, until the configured count of frames
+// is received. The trace contains all edges since startup (incl. clock discovery), so it can be replayed.
+// file format (csv): timestamp in nanoseconds, edge (rising|falling)
+type capture struct {
+	sync.Mutex
+	// file is the capture file, nil if capture is finished.
+	file *os.File
+	// w is the buffered writer of the capture file.
+	w *bufio.Writer
+	// frames is the remaining count of frames to capture.
+	frames int
+}
+
+// newCapture creates the capture file and starts capturing the edges of the next frames.
+func newCapture(name string, frames int) (*capture, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	debug.InfoLog.Printf("capture edges of %v frames to %q", frames, name)
+	return &capture{file: f, w: bufio.NewWriter(f), frames: frames}, nil
+}
+
+// tap forwards the events of channel in to the returned channel and writes the events to the capture file.
+func (c *capture) tap(in chan port.Event) chan port.Event {
+	out := make(chan port.Event, 100)
+
+	go func() {
+		defer close(out)
+
+		for evt := range in {
+			c.write(evt)
+			out <- evt
+		}
+	}()
+
+	return out
+}
+
+// write writes an event to the capture file.
+func (c *capture) write(evt port.Event) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.file == nil {
+		return
+	}
+
+	edge := "rising"
+	if evt.Type == port.FallingEdge {
+		edge = "falling"
+	}
+
+	if _, err := fmt.Fprintf(c.w, "%d,%s\n", evt.Timestamp.Nanoseconds(), edge); err != nil {
+		debug.ErrorLog.Printf("capture: %v", err)
+		c.close()
+	}
+}
+
+// frame counts a received frame and stops capturing after the configured count of frames.
+func (c *capture) frame() {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.file == nil {
+		return
+	}
+
+	if c.frames--; c.frames <= 0 {
+		debug.InfoLog.Printf("capture finished: %q", c.file.Name())
+		c.close()
+	}
+}
+
+// Close stops capturing and closes the capture file.
+func (c *capture) Close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.close()
+}
+
+// close flushes and closes the capture file, the lock must be held by the caller.
+func (c *capture) close() error {
+	if c.file == nil {
+		return nil
+	}
+
+	_ = c.w.Flush()
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tadl/pkg/port"
+)
+
+func TestCapture(t *testing.T) {
+	const frames, edges = 3, 10
+
+	name := filepath.Join(t.TempDir(), "capture.csv")
+	c, err := newCapture(name, frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	in := make(chan port.Event)
+	out := c.tap(in)
+
+	var ts time.Duration
+	// the edges of one more frame are sent, they must not be captured
+	for f := 0; f < frames+1; f++ {
+		for i := 0; i < edges; i++ {
+			ts += 10 * time.Millisecond
+			e := port.Event{Timestamp: ts, Type: port.RisingEdge}
+			if i%2 == 1 {
+				e.Type = port.FallingEdge
+			}
+			in <- e
+			// the event is forwarded after it's written
+			if got := <-out; got != e {
+				t.Fatalf("got forwarded event %v, want %v", got, e)
+			}
+		}
+		c.frame()
+	}
+	close(in)
+	if _, open := <-out; open {
+		t.Error("got open channel after the input is closed, want closed")
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != frames*edges {
+		t.Fatalf("got %v captured edges, want %v (%v frames)", len(lines), frames*edges, frames)
+	}
+	if lines[0] != "10000000,rising" || lines[1] != "20000000,falling" {
+		t.Errorf("got first lines %q, want 10000000,rising and 20000000,falling", lines[:2])
+	}
+
+	// the capture is finished, further frames don't reopen it
+	c.frame()
+	if c.file != nil {
+		t.Error("got open capture file after the frames are captured, want closed")
+	}
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"strings"
+	"tadl/pkg/mqtt"
+
+	"github.com/womat/debug"
+)
+
+// commandQos is the qos of the command subscription, a command is delivered at least once.
+const commandQos = 1
+
+// commandTopic returns the topic of the remote commands <topic>/cmd (see mqtt.commands).
+//  The config must be locked by the caller.
+func (app *App) commandTopic() string {
+	return app.config.MQTT.Topic + "/cmd"
+}
+
+// subscribeCommands subscribes the command topic (mqtt.commands).
+func (app *App) subscribeCommands() error {
+	return app.mqtt.Subscribe(app.commandTopic(), commandQos, app.command)
+}
+
+// command executes a received remote command, the payload is the command (case-insensitive):
+//  restart: warm restart of the dl-bus pipeline (gpio, decoders and data logger, see triggerRestart)
+//  publish: publish the last received data frame immediately, independent of the change detection
+// Retained commands are ignored, they would be executed again on each start of the application.
+func (app *App) command(m mqtt.Message) {
+	if m.Retained {
+		debug.WarningLog.Printf("ignore retained command %q of topic %v", m.Payload, m.Topic)
+		return
+	}
+
+	switch c := strings.ToLower(strings.TrimSpace(string(m.Payload))); c {
+	case "restart":
+		debug.InfoLog.Print("received restart command")
+		app.triggerRestart()
+	case "publish":
+		debug.InfoLog.Print("received publish command")
+		go func() {
+			if err := app.publishLatest(); err != nil {
+				debug.WarningLog.Printf("can't publish the last data frame: %v", err)
+			}
+		}()
+	default:
+		debug.WarningLog.Printf("unknown command %q of topic %v", c, m.Topic)
+	}
+}
+
+// publishLatest publishes the last received data frame, it's the new reference of the change detection.
+//  If no data frame has been received yet, errNoFrame is returned.
+func (app *App) publishLatest() error {
+	f, err := app.receivedFrame()
+	if err != nil {
+		return err
+	}
+
+	app.mqttData.Lock()
+	app.mqttData.data[frameDevice(f)] = f
+	app.mqttData.Unlock()
+
+	app.bus.Lock()
+	topic := app.topic(f)
+	app.bus.Unlock()
+
+	app.sendMQTT(topic, f)
+	return nil
+}
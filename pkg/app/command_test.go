@@ -0,0 +1,46 @@
+package app
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"tadl/pkg/datalogger"
+	"tadl/pkg/mqtt"
+)
+
+func TestPublishLatest(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+
+	if err := app.publishLatest(); !errors.Is(err, errNoFrame) {
+		t.Fatalf("got error %v without received frame, want %v", err, errNoFrame)
+	}
+
+	app.setLatestFrame(datalogger.UVR42Frame{TimeStamp: time.Now(), Temperature1: 45.5})
+	if err := app.publishLatest(); err != nil {
+		t.Fatalf("publish latest: %v", err)
+	}
+	waitMessages(t, b, "tadl", 1)
+}
+
+func TestCommand(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	app.setLatestFrame(datalogger.UVR42Frame{TimeStamp: time.Now(), Temperature1: 45.5})
+
+	// a retained command is ignored
+	app.command(mqtt.Message{Topic: app.commandTopic(), Payload: []byte("publish"), Retained: true})
+	app.command(mqtt.Message{Topic: app.commandTopic(), Payload: []byte(" Publish\n")})
+	waitMessages(t, b, "tadl", 1)
+
+	time.Sleep(50 * time.Millisecond)
+	if m := topicMessages(b, "tadl"); len(m) != 1 {
+		t.Errorf("got %v published frames, want 1 (retained command ignored)", len(m))
+	}
+
+	app.command(mqtt.Message{Topic: app.commandTopic(), Payload: []byte("restart")})
+	select {
+	case <-app.Restart():
+	case <-time.After(time.Second):
+		t.Fatal("restart command didn't trigger a restart")
+	}
+}
@@ -3,8 +3,10 @@ package config
 import (
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"strings"
+	"tadl/pkg/datalogger"
 	"time"
 
 	"github.com/womat/debug"
@@ -23,27 +25,72 @@ type Config struct {
 	MQTT       MQTTConfig       `yaml:"mqtt"`
 	Webserver  WebserverConfig  `yaml:"webserver"`
 	Log        LogConfig        `yaml:"log"`
+	Capture    CaptureConfig    `yaml:"capture"`
+	History    HistoryConfig    `yaml:"history"`
+	Runtime    RuntimeConfig    `yaml:"runtime"`
+	InfluxDB   InfluxDBConfig   `yaml:"influxdb"`
+	Watchpoint WatchpointConfig `yaml:"watchpoint"`
 }
 
 // FlagConfig defines the configured command line flags (parameters).
 type FlagConfig struct {
-	LogLevel   string `json:"LogLevel,omitempty" yaml:"LogLevel,omitempty"`
-	ConfigFile string `json:"Config,omitempty" yaml:"Config,omitempty"`
+	LogLevel string `json:"LogLevel,omitempty" yaml:"LogLevel,omitempty"`
+	// ConfigFiles are the configuration files in the order of precedence (later files override earlier ones).
+	ConfigFiles []string `json:"Config,omitempty" yaml:"Config,omitempty"`
 }
 
 // WebserverConfig defines the struct of the webserver and webservice configuration.
 type WebserverConfig struct {
 	URL         string          `yaml:"url"`
 	Webservices map[string]bool `yaml:"webservices"`
+	Token       string          `yaml:"token"`
 }
 
 // MQTTConfig defines the struct of the mqtt client configuration.
 type MQTTConfig struct {
-	Connection  string        `yaml:"connection"`
-	Interval    time.Duration `yaml:"-"`
-	IntervalInt int           `yaml:"interval"`
-	DeltaKelvin float64       `yaml:"deltakelvin"`
-	Topic       string        `yaml:"topic"`
+	Connection              string         `yaml:"connection"`
+	Interval                time.Duration  `yaml:"-"`
+	IntervalInt             int            `yaml:"interval"`
+	DeltaKelvin             float64        `yaml:"deltakelvin"`
+	DeltaPercent            []float64      `yaml:"deltapercent"`
+	Topic                   string         `yaml:"topic"`
+	RepublishInterval       time.Duration  `yaml:"-"`
+	RepublishIntervalInt    int            `yaml:"republishinterval"`
+	ConnectJitter           time.Duration  `yaml:"-"`
+	ConnectJitterInt        int            `yaml:"connectjitter"`
+	Edges                   bool           `yaml:"edges"`
+	StrictOrder             bool           `yaml:"strictorder"`
+	Format                  string         `yaml:"format"`
+	DetectDuplicates        bool           `yaml:"detectduplicates"`
+	ClientID                string         `yaml:"clientid"`
+	Username                string         `yaml:"username"`
+	Password                string         `yaml:"password"`
+	TLS                     MQTTTLSConfig  `yaml:"tls"`
+	Will                    MQTTWillConfig `yaml:"will"`
+	MaxReconnectInterval    time.Duration  `yaml:"-"`
+	MaxReconnectIntervalInt int            `yaml:"maxreconnectinterval"`
+	Qos                     int            `yaml:"qos"`
+	Retained                bool           `yaml:"retained"`
+	Heartbeat               time.Duration  `yaml:"-"`
+	HeartbeatInt            int            `yaml:"heartbeat"`
+	TimeFormat              string         `yaml:"timeformat"`
+	TimeZone                string         `yaml:"timezone"`
+	Commands                bool           `yaml:"commands"`
+}
+
+// MQTTWillConfig defines the struct of the availability topic (last will) of the mqtt client.
+type MQTTWillConfig struct {
+	Topic   string `yaml:"topic"`
+	Online  string `yaml:"online"`
+	Offline string `yaml:"offline"`
+}
+
+// MQTTTLSConfig defines the struct of the TLS connection to the mqtt broker.
+type MQTTTLSConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	CA      string `yaml:"ca"`
+	Cert    string `yaml:"cert"`
+	Key     string `yaml:"key"`
 }
 
 // LogConfig defines the struct of the debug configuration and configuration file.
@@ -54,30 +101,135 @@ type LogConfig struct {
 	FileString string         `yaml:"file"`
 }
 
+// HistoryConfig defines the struct of the in-memory history of data frames.
+type HistoryConfig struct {
+	Size      int `yaml:"size"`
+	MaxMemory int `yaml:"maxmemory"`
+}
+
+// CaptureConfig defines the struct of the edge capture configuration.
+type CaptureConfig struct {
+	Frames int    `yaml:"frames"`
+	File   string `yaml:"file"`
+}
+
+// WatchpointConfig defines the struct of the watchpoint, which writes the latest edges on a condition.
+type WatchpointConfig struct {
+	Condition string `yaml:"condition"`
+	File      string `yaml:"file"`
+	Events    int    `yaml:"events"`
+}
+
+// RuntimeConfig defines the struct of the on-time accumulation of the outputs.
+type RuntimeConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	File    string `yaml:"file"`
+}
+
+// InfluxDBConfig defines the struct of the InfluxDB export.
+type InfluxDBConfig struct {
+	URL              string        `yaml:"url"`
+	Token            string        `yaml:"token"`
+	FlushInterval    time.Duration `yaml:"-"`
+	FlushIntervalInt int           `yaml:"flushinterval"`
+	MaxLines         int           `yaml:"maxlines"`
+}
+
 // DataLoggerConfig defines the struct of the Data Logger.
 type DataLoggerConfig struct {
-	Type string `yaml:"type"`
+	Type         string                    `yaml:"type"`
+	MedianWindow int                       `yaml:"medianwindow"`
+	MaxErrorRate float64                   `yaml:"maxerrorrate"`
+	ErrorWindow  int                       `yaml:"errorwindow"`
+	InputTypes   []string                  `yaml:"inputtypes"`
+	TypedInputs  bool                      `yaml:"typedinputs"`
+	Labels       []string                  `yaml:"labels"`
+	MaxDelta     float64                   `yaml:"maxdelta"`
+	Scale        float64                   `yaml:"scale"`
+	Unit         string                    `yaml:"unit"`
+	Delimiter    DataLoggerDelimiterConfig `yaml:"delimiter"`
+}
+
+// DataLoggerDelimiterConfig defines the struct of the self-delimitation of the data frames (see datalogger.Delimiter).
+type DataLoggerDelimiterConfig struct {
+	LengthOffset int  `yaml:"lengthoffset"`
+	Terminated   bool `yaml:"terminated"`
+	Terminator   int  `yaml:"terminator"`
 }
 
 // DLbusConfig defines the struct of the dl-bus configuration.
 type DLbusConfig struct {
+	Chip              string        `yaml:"chip"`
 	Gpio              int           `yaml:"gpio"`
+	GpioBuffer        int           `yaml:"gpiobuffer"`
 	DebouncePeriodInt int           `yaml:"debounceperiod"`
 	DebouncePeriod    time.Duration `yaml:"-"`
+	HardwareDebounce  bool          `yaml:"hardwaredebounce"`
 	Terminator        string        `yaml:"terminator"`
+	ActiveLow         bool          `yaml:"activelow"`
+	ClockHz           float64       `yaml:"clockhz"`
+	ClockTolerance    float64       `yaml:"clocktolerance"`
+	FixedClock        bool          `yaml:"fixedclock"`
+	Sensitivity       float64       `yaml:"sensitivity"`
+	ClockSamples      int           `yaml:"clocksamples"`
+	GapTimeout        int           `yaml:"gaptimeout"`
+	QuietStart        int           `yaml:"quietstart"`
+	DriftAlpha        float64       `yaml:"driftalpha"`
+	Convention        string        `yaml:"convention"`
+	Checksum          bool          `yaml:"checksum"`
+	MaxFrameLen       int           `yaml:"maxframelen"`
+	SyncTimeoutInt    int           `yaml:"synctimeout"`
+	SyncTimeout       time.Duration `yaml:"-"`
+	FrameTimeoutInt   int           `yaml:"frametimeout"`
+	FrameTimeout      time.Duration `yaml:"-"`
+	QueueSize         int           `yaml:"queuesize"`
+	BitOrder          string        `yaml:"bitorder"`
+	Polarity          string        `yaml:"polarity"`
 }
 
+// tlsSchemes are the schemes of the mqtt connection, which support TLS (see paho).
+var tlsSchemes = map[string]bool{"ssl": true, "tls": true, "mqtts": true, "mqtt+ssl": true, "tcps": true, "wss": true}
+
 // NewConfig create the structure of the application configuration.
 func NewConfig() *Config {
 	return &Config{
 		DataLogger: DataLoggerConfig{
-			Type: "UVR4",
+			Type:        "uvr42",
+			ErrorWindow: 10,
+			Scale:       0.1,
+			Unit:        "C",
 		},
 		DLbus: DLbusConfig{
+			Chip:              "gpiochip0",
+			GpioBuffer:        100,
 			DebouncePeriodInt: 0,
 			Terminator:        "none",
+			ClockHz:           50,
+			ClockTolerance:    0.2,
+			Sensitivity:       0.6,
+			ClockSamples:      500,
+			Convention:        "thomas",
+			MaxFrameLen:       64,
+			QueueSize:         8,
+			BitOrder:          "lsb",
+			Polarity:          "normal",
 		},
 		Flag: FlagConfig{},
+		History: HistoryConfig{
+			Size: 1000,
+		},
+		Capture: CaptureConfig{
+			Frames: 0,
+			File:   "/tmp/tadl-capture.csv",
+		},
+		Watchpoint: WatchpointConfig{
+			File:   "/tmp/tadl-watchpoint.csv",
+			Events: 5000,
+		},
+		InfluxDB: InfluxDBConfig{
+			FlushIntervalInt: 10,
+			MaxLines:         10000,
+		},
 		Log: LogConfig{
 			FileString: "stderr",
 			FlagString: "standard",
@@ -88,34 +240,237 @@ func NewConfig() *Config {
 				"version": true,
 				"health":  true,
 				"data":    true,
+				"history": true,
+				"export":  true,
+				"metrics": true,
 			},
 		},
 		MQTT: MQTTConfig{
-			Connection:  "tcp:127.0.0.1883",
-			IntervalInt: 5,
-			DeltaKelvin: 0.5,
-			Topic:       "/test/uvr42"},
+			Connection:              "tcp:127.0.0.1883",
+			IntervalInt:             5,
+			DeltaKelvin:             0.5,
+			Topic:                   "/test/uvr42",
+			StrictOrder:             true,
+			Format:                  "json",
+			Will:                    MQTTWillConfig{Online: "online", Offline: "offline"},
+			MaxReconnectIntervalInt: 120,
+			Retained:                true},
 	}
 }
 
-// LoadConfig reads the config file and set the application configuration.
+// LoadConfig reads the config files and set the application configuration.
+// The configuration is built in the following order of precedence (lowest first):
+//  * defaults of NewConfig()
+//  * config files in the order of the --config flags, later files are deep-merged over earlier ones
+//    (maps are merged, scalars and lists are overridden)
+//  * command line flags (e.g. --log)
 func (c *Config) LoadConfig() error {
-	if err := c.readConfigFile(); err != nil {
-		return fmt.Errorf("error reading config file %q: %w", c.Flag.ConfigFile, err)
+	if err := c.readConfigFiles(); err != nil {
+		return err
 	}
 
 	if c.Flag.LogLevel != "" {
 		c.Log.FlagString = c.Flag.LogLevel
 	}
+
+	// enum values are case-insensitive
+	c.Log.FlagString = normalize(c.Log.FlagString)
+	c.DataLogger.Type = normalize(c.DataLogger.Type)
+	c.DLbus.Terminator = normalize(c.DLbus.Terminator)
+	c.DLbus.Convention = normalize(c.DLbus.Convention)
+	c.DLbus.BitOrder = normalize(c.DLbus.BitOrder)
+	c.DLbus.Polarity = normalize(c.DLbus.Polarity)
+	c.MQTT.Format = normalize(c.MQTT.Format)
+	c.DataLogger.Unit = strings.ToUpper(strings.TrimSpace(c.DataLogger.Unit))
+	for i, t := range c.DataLogger.InputTypes {
+		c.DataLogger.InputTypes[i] = normalize(t)
+	}
 	if err := c.setDebugConfig(); err != nil {
 		return fmt.Errorf("unable to open debug file %q: %w", c.Log, err)
 	}
 
 	c.MQTT.Interval = time.Duration(c.MQTT.IntervalInt) * time.Second
+	c.MQTT.RepublishInterval = time.Duration(c.MQTT.RepublishIntervalInt) * time.Second
+	c.MQTT.ConnectJitter = time.Duration(c.MQTT.ConnectJitterInt) * time.Millisecond
+	c.MQTT.MaxReconnectInterval = time.Duration(c.MQTT.MaxReconnectIntervalInt) * time.Second
+	c.MQTT.Heartbeat = time.Duration(c.MQTT.HeartbeatInt) * time.Second
+	c.InfluxDB.FlushInterval = time.Duration(c.InfluxDB.FlushIntervalInt) * time.Second
 	c.DLbus.DebouncePeriod = time.Duration(c.DLbus.DebouncePeriodInt) * time.Microsecond
 
+	if c.DLbus.ClockHz < 0 || (c.DLbus.FixedClock && c.DLbus.ClockHz == 0) {
+		return fmt.Errorf("invalid dlbus clock: %v Hz", c.DLbus.ClockHz)
+	}
+	if c.DLbus.ClockTolerance < 0 || c.DLbus.ClockTolerance >= 1 {
+		return fmt.Errorf("invalid dlbus clock tolerance: %v", c.DLbus.ClockTolerance)
+	}
+
+	if c.DLbus.Sensitivity <= 0 || c.DLbus.Sensitivity >= 1 {
+		return fmt.Errorf("invalid dlbus sensitivity: %v", c.DLbus.Sensitivity)
+	}
+
+	if c.DLbus.ClockSamples < 4 {
+		return fmt.Errorf("invalid dlbus clock samples: %v", c.DLbus.ClockSamples)
+	}
+
+	if c.DLbus.GapTimeout < 0 {
+		return fmt.Errorf("invalid dlbus gap timeout: %v", c.DLbus.GapTimeout)
+	}
+	if c.DLbus.QuietStart < 0 {
+		return fmt.Errorf("invalid dlbus quiet start: %v", c.DLbus.QuietStart)
+	}
+
+	if c.History.Size < 0 {
+		return fmt.Errorf("invalid history size: %v", c.History.Size)
+	}
+	if c.History.MaxMemory < 0 {
+		return fmt.Errorf("invalid history max memory: %v", c.History.MaxMemory)
+	}
+	if c.Capture.Frames < 0 {
+		return fmt.Errorf("invalid capture frames: %v", c.Capture.Frames)
+	}
+
+	if c.DLbus.SyncTimeoutInt < 0 {
+		return fmt.Errorf("invalid dlbus sync timeout: %v", c.DLbus.SyncTimeoutInt)
+	}
+	c.DLbus.SyncTimeout = time.Duration(c.DLbus.SyncTimeoutInt) * time.Second
+
+	if c.DLbus.FrameTimeoutInt < 0 {
+		return fmt.Errorf("invalid dlbus frame timeout: %v", c.DLbus.FrameTimeoutInt)
+	}
+	c.DLbus.FrameTimeout = time.Duration(c.DLbus.FrameTimeoutInt) * time.Millisecond
+
+	if c.DLbus.QueueSize < 1 {
+		return fmt.Errorf("invalid dlbus queue size: %v", c.DLbus.QueueSize)
+	}
+
+	if c.DLbus.MaxFrameLen < 1 {
+		return fmt.Errorf("invalid dlbus max frame len: %v", c.DLbus.MaxFrameLen)
+	}
+
+	if c.DLbus.DriftAlpha < 0 || c.DLbus.DriftAlpha >= 1 {
+		return fmt.Errorf("invalid dlbus drift alpha: %v", c.DLbus.DriftAlpha)
+	}
+
+	if w := c.DataLogger.MedianWindow; w < 0 || (w > 1 && w%2 == 0) {
+		return fmt.Errorf("invalid median window: %v (must be an odd number)", w)
+	}
+
+	if c.MQTT.Qos < 0 || c.MQTT.Qos > 2 {
+		return fmt.Errorf("invalid mqtt qos: %v (must be 0, 1 or 2)", c.MQTT.Qos)
+	}
+
+	if c.InfluxDB.URL != "" {
+		if u, err := url.Parse(c.InfluxDB.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid influxdb url: %q", c.InfluxDB.URL)
+		}
+		if c.InfluxDB.FlushIntervalInt < 1 {
+			return fmt.Errorf("invalid influxdb flush interval: %v", c.InfluxDB.FlushIntervalInt)
+		}
+		if c.InfluxDB.MaxLines < 1 {
+			return fmt.Errorf("invalid influxdb max lines: %v", c.InfluxDB.MaxLines)
+		}
+	}
+
+	if c.MQTT.HeartbeatInt < 0 {
+		return fmt.Errorf("invalid mqtt heartbeat: %v", c.MQTT.HeartbeatInt)
+	}
+
+	if c.MQTT.MaxReconnectIntervalInt < 1 {
+		return fmt.Errorf("invalid mqtt max reconnect interval: %v", c.MQTT.MaxReconnectIntervalInt)
+	}
+
+	for _, p := range c.MQTT.DeltaPercent {
+		if p < 0 {
+			return fmt.Errorf("invalid delta percent: %v", p)
+		}
+	}
+
+	if c.Watchpoint.Condition != "" && c.Watchpoint.Events < 1 {
+		return fmt.Errorf("invalid watchpoint events: %v", c.Watchpoint.Events)
+	}
+
+	if c.DataLogger.MaxDelta < 0 {
+		return fmt.Errorf("invalid max delta: %v", c.DataLogger.MaxDelta)
+	}
+
+	if r := c.DataLogger.MaxErrorRate; r < 0 || r > 1 {
+		return fmt.Errorf("invalid max error rate: %v", r)
+	}
+	if c.DataLogger.ErrorWindow < 1 {
+		return fmt.Errorf("invalid error window: %v", c.DataLogger.ErrorWindow)
+	}
+
+	if d := c.DataLogger.Delimiter; d.LengthOffset < 0 {
+		return fmt.Errorf("invalid delimiter length offset: %v", d.LengthOffset)
+	}
+	if d := c.DataLogger.Delimiter; d.Terminator < 0 || d.Terminator > 255 {
+		return fmt.Errorf("invalid delimiter terminator: %v (must be a byte 0..255)", d.Terminator)
+	}
+
+	switch c.DLbus.Convention {
+	case "thomas", "ieee":
+	default:
+		return fmt.Errorf("unsupported dlbus convention: %q", c.DLbus.Convention)
+	}
+
+	switch c.DLbus.BitOrder {
+	case "lsb", "msb":
+	default:
+		return fmt.Errorf("unsupported dlbus bit order: %q", c.DLbus.BitOrder)
+	}
+
+	switch c.MQTT.Format {
+	case "json", "binary":
+	default:
+		return fmt.Errorf("unsupported mqtt format: %q", c.MQTT.Format)
+	}
+	// the binary format encodes the temperatures in 0.1 °C
+	if c.MQTT.Format == "binary" && (c.DataLogger.Scale != 0.1 || c.DataLogger.Unit != string(datalogger.Celsius)) {
+		return fmt.Errorf("mqtt format binary requires the datalogger scale 0.1 and unit C: %v %v", c.DataLogger.Scale, c.DataLogger.Unit)
+	}
+
+	if t := c.MQTT.TLS; t.Enabled {
+		if u, err := url.Parse(c.MQTT.Connection); err != nil || !tlsSchemes[u.Scheme] {
+			return fmt.Errorf("mqtt tls requires a ssl:// connection: %q", c.MQTT.Connection)
+		}
+		if (t.Cert == "") != (t.Key == "") {
+			return fmt.Errorf("mqtt tls requires both client cert and key")
+		}
+	}
+
+	if c.DLbus.Chip == "" {
+		return fmt.Errorf("missing dlbus chip")
+	}
+	switch c.DLbus.Terminator {
+	case "pullup", "pulldown", "none":
+	default:
+		return fmt.Errorf("unsupported dlbus terminator: %q", c.DLbus.Terminator)
+	}
+	if c.DLbus.GpioBuffer < 1 {
+		return fmt.Errorf("invalid dlbus gpio buffer: %v", c.DLbus.GpioBuffer)
+	}
+
+	switch c.DLbus.Polarity {
+	case "normal", "inverted":
+	default:
+		return fmt.Errorf("unsupported dlbus polarity: %q", c.DLbus.Polarity)
+	}
+
+	for _, t := range c.DataLogger.InputTypes {
+		if _, err := datalogger.ParseSensorType(t); err != nil {
+			return err
+		}
+	}
+
+	if c.DataLogger.Scale <= 0 {
+		return fmt.Errorf("invalid scale: %v", c.DataLogger.Scale)
+	}
+	if _, err := datalogger.ParseUnit(c.DataLogger.Unit); err != nil {
+		return err
+	}
+
 	switch l := c.DataLogger.Type; l {
-	case "uvr42":
+	case "uvr42", "uvr31", "uvr1611", "raw", "auto":
 	default:
 		return fmt.Errorf("unsupported Datalogger: %q: ", l)
 	}
@@ -123,25 +478,58 @@ func (c *Config) LoadConfig() error {
 	return nil
 }
 
-// readConfigFile read the configuration File and store the content to the config structure.
-func (c *Config) readConfigFile() error {
-	file, err := os.Open(c.Flag.ConfigFile)
+// readConfigFiles reads all configuration files, merges the content and store it to the config structure.
+func (c *Config) readConfigFiles() error {
+	merged := map[interface{}]interface{}{}
+
+	for _, f := range c.Flag.ConfigFiles {
+		m, err := readConfigFile(f)
+		if err != nil {
+			return fmt.Errorf("error reading config file %q: %w", f, err)
+		}
+		mergeMaps(merged, m)
+	}
+
+	b, err := yaml.Marshal(merged)
 	if err != nil {
 		return err
 	}
-	defer func() { _ = file.Close() }()
 
-	decoder := yaml.NewDecoder(file)
-	if err = decoder.Decode(c); err != nil {
-		return err
+	return yaml.Unmarshal(b, c)
+}
+
+// readConfigFile reads a configuration file and returns the content as generic map.
+func readConfigFile(name string) (map[interface{}]interface{}, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	m := map[interface{}]interface{}{}
+	if err = yaml.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// mergeMaps deep-merges src into dst.
+// Nested maps are merged recursively, all other values of src override the values of dst.
+func mergeMaps(dst, src map[interface{}]interface{}) {
+	for k, v := range src {
+		if s, ok := v.(map[interface{}]interface{}); ok {
+			if d, ok := dst[k].(map[interface{}]interface{}); ok {
+				mergeMaps(d, s)
+				continue
+			}
+		}
+		dst[k] = v
+	}
 }
 
 // setDebugConfig translate the log parameter to values of the debug module and open the log file.
 func (c *Config) setDebugConfig() (err error) {
-	switch s := strings.ToLower(c.Log.FlagString); s {
+	switch c.Log.FlagString {
 	case "trace", "full":
 		c.Log.Flag = debug.Full
 	case "debug":
@@ -169,3 +557,8 @@ func (c *Config) setDebugConfig() (err error) {
 
 	return
 }
+
+// normalize removes leading and trailing white spaces and converts the enum value to lower case.
+func normalize(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
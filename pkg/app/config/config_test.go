@@ -0,0 +1,217 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile writes the content to the file name in the directory dir and returns the path of the file.
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoadConfigMerge(t *testing.T) {
+	dir := t.TempDir()
+	base := writeFile(t, dir, "base.yaml", `
+datalogger:
+  type: uvr42
+  maxdelta: 2
+mqtt:
+  connection: tcp://broker:1883
+  topic: tadl/base
+  interval: 10
+webserver:
+  webservices:
+    version: false
+    health: true
+log:
+  flag: info
+`)
+	host := writeFile(t, dir, "host.yaml", `
+mqtt:
+  topic: tadl/host1
+webserver:
+  webservices:
+    health: false
+`)
+
+	c := NewConfig()
+	c.Flag.ConfigFiles = []string{base, host}
+	if err := c.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	// overlapping keys: the later file wins
+	if c.MQTT.Topic != "tadl/host1" {
+		t.Errorf("got topic %q, want the override tadl/host1", c.MQTT.Topic)
+	}
+	if c.Webserver.Webservices["health"] {
+		t.Error("got webservice health enabled, want the override disabled")
+	}
+
+	// base-only keys persist
+	if c.MQTT.Connection != "tcp://broker:1883" || c.MQTT.IntervalInt != 10 || c.DataLogger.MaxDelta != 2 {
+		t.Errorf("got connection %q interval %v maxdelta %v, want the base values",
+			c.MQTT.Connection, c.MQTT.IntervalInt, c.DataLogger.MaxDelta)
+	}
+	if c.Webserver.Webservices["version"] {
+		t.Error("got webservice version enabled, want the base value disabled")
+	}
+
+	if c.Log.FlagString != "info" {
+		t.Errorf("got log flag %q, want the base value info", c.Log.FlagString)
+	}
+
+	// keys of no file keep the default
+	if !c.Webserver.Webservices["data"] || c.DataLogger.Scale != 0.1 {
+		t.Errorf("got webservice data %v scale %v, want the defaults", c.Webserver.Webservices["data"], c.DataLogger.Scale)
+	}
+}
+
+func TestLoadConfigFlagPrecedence(t *testing.T) {
+	f := writeFile(t, t.TempDir(), "tadl.yaml", "log:\n  flag: info\n")
+
+	c := NewConfig()
+	c.Flag.ConfigFiles = []string{f}
+	c.Flag.LogLevel = "Debug"
+	if err := c.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the command line flag overrides the config files
+	if c.Log.FlagString != "debug" {
+		t.Errorf("got log level %q, want the flag debug", c.Log.FlagString)
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	c := NewConfig()
+	c.Flag.ConfigFiles = []string{filepath.Join(t.TempDir(), "missing.yaml")}
+	if err := c.LoadConfig(); err == nil {
+		t.Error("got no error of a missing config file")
+	}
+}
+
+func TestMergeMaps(t *testing.T) {
+	dst := map[interface{}]interface{}{
+		"a": 1,
+		"m": map[interface{}]interface{}{"x": 1, "y": 2},
+		"l": []interface{}{1, 2},
+	}
+	mergeMaps(dst, map[interface{}]interface{}{
+		"b": 2,
+		"m": map[interface{}]interface{}{"y": 3},
+		"l": []interface{}{3},
+	})
+
+	m := dst["m"].(map[interface{}]interface{})
+	if dst["a"] != 1 || dst["b"] != 2 || m["x"] != 1 || m["y"] != 3 {
+		t.Errorf("got %v, want maps merged", dst)
+	}
+	// lists are overridden, not appended
+	if l := dst["l"].([]interface{}); len(l) != 1 || l[0] != 3 {
+		t.Errorf("got list %v, want [3]", l)
+	}
+}
+
+func TestLoadConfigNormalize(t *testing.T) {
+	f := writeFile(t, t.TempDir(), "tadl.yaml", `
+datalogger:
+  type: "  UVR42 "
+  unit: " f"
+dlbus:
+  terminator: " PullUp"
+  convention: IEEE
+  bitorder: "MSB "
+  polarity: Inverted
+mqtt:
+  format: " JSON"
+log:
+  flag: " INFO "
+`)
+
+	c := NewConfig()
+	c.Flag.ConfigFiles = []string{f}
+	if err := c.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{c.DataLogger.Type, c.DataLogger.Unit, c.DLbus.Terminator, c.DLbus.Convention, c.DLbus.BitOrder,
+		c.DLbus.Polarity, c.MQTT.Format, c.Log.FlagString}
+	want := []string{"uvr42", "F", "pullup", "ieee", "msb", "inverted", "json", "info"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got normalized values %q, want %q", got, want)
+			break
+		}
+	}
+
+	// the defaults are accepted by the datalogger type switch (lower case)
+	if c := NewConfig(); c.DataLogger.Type != "uvr42" || c.DLbus.Terminator != "none" {
+		t.Errorf("got default type %q terminator %q, want uvr42 none", c.DataLogger.Type, c.DLbus.Terminator)
+	}
+
+	f = writeFile(t, t.TempDir(), "tadl.yaml", "dlbus:\n  terminator: pull-up\n")
+	c = NewConfig()
+	c.Flag.ConfigFiles = []string{f}
+	if err := c.LoadConfig(); err == nil {
+		t.Error("got no error of an unsupported terminator")
+	}
+}
+
+func TestLoadConfigDelimiter(t *testing.T) {
+	f := writeFile(t, t.TempDir(), "tadl.yaml", `
+datalogger:
+  delimiter:
+    lengthoffset: 1
+    terminated: true
+    terminator: 0x55
+`)
+
+	c := NewConfig()
+	c.Flag.ConfigFiles = []string{f}
+	if err := c.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if want := (DataLoggerDelimiterConfig{LengthOffset: 1, Terminated: true, Terminator: 0x55}); c.DataLogger.Delimiter != want {
+		t.Errorf("got delimiter %+v, want %+v", c.DataLogger.Delimiter, want)
+	}
+
+	for _, d := range []string{"lengthoffset: -1", "terminator: 256", "terminator: -1"} {
+		f = writeFile(t, t.TempDir(), "tadl.yaml", "datalogger:\n  delimiter:\n    "+d+"\n")
+		c = NewConfig()
+		c.Flag.ConfigFiles = []string{f}
+		if err := c.LoadConfig(); err == nil {
+			t.Errorf("got no error of the delimiter %q", d)
+		}
+	}
+}
+
+func TestLoadConfigBinaryFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		valid bool
+	}{
+		{"default scale", "mqtt:\n  format: binary\n", true},
+		{"scale 0.5", "mqtt:\n  format: binary\ndatalogger:\n  scale: 0.5\n", false},
+		{"unit F", "mqtt:\n  format: binary\ndatalogger:\n  unit: F\n", false},
+		{"json unit F", "mqtt:\n  format: json\ndatalogger:\n  unit: F\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConfig()
+			c.Flag.ConfigFiles = []string{writeFile(t, t.TempDir(), "tadl.yaml", tt.yaml)}
+			if err := c.LoadConfig(); (err == nil) != tt.valid {
+				t.Errorf("got error %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -1,86 +1,399 @@
 package app
 
 import (
+	"context"
+	"encoding"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"time"
 
 	"tadl/pkg/datalogger"
+	"tadl/pkg/mqtt"
 
 	"github.com/womat/debug"
-	"github.com/womat/mqtt"
 )
 
+// busRetryDelay is the delay to wait for the dl-bus pipeline, if it isn't initialized (e.g. failed restart).
+const busRetryDelay = 100 * time.Millisecond
+
 // service wait in an endless loop for valid data logger frames.
 // It save the data frame to app main structure and send the dataframe to the mqtt broker
+//  The data logger is read as soon as the dl-bus signals a completed frame, the loop is stopped by the shutdown.
 func (app *App) run() {
 	for {
-		if f, err := app.dl.Get(); err != nil {
-			if err == io.EOF {
-				time.Sleep(100 * time.Millisecond)
+		app.bus.Lock()
+		var frames <-chan []byte
+		if app.dlbus != nil {
+			frames = app.dlbus.Frames()
+		}
+		app.bus.Unlock()
+
+		if frames == nil {
+			select {
+			case <-time.After(busRetryDelay):
+				continue
+			case <-app.ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case _, ok := <-frames:
+			if !ok {
+				// the dl-bus is closed by a restart/reload, wait for the new one
 				continue
 			}
+		case <-app.ctx.Done():
+			return
+		}
 
-			debug.ErrorLog.Println(err)
-		} else {
-			debug.TraceLog.Printf("Frame: %v", f)
-			app.DataFrame.Lock()
-			app.DataFrame.data = f
-			app.DataFrame.Unlock()
-			_ = app.validateMeasurements(f)
+		// process all queued data frames
+		for app.receive() {
 		}
 	}
 }
 
+// receive reads the next data frame from the data logger and processes it.
+//  It returns false if no data frame is available.
+//  The config and the dl-bus pipeline are locked while processing, so they can't be replaced by a restart/reload.
+func (app *App) receive() bool {
+	app.bus.Lock()
+	defer app.bus.Unlock()
+
+	if app.dl == nil {
+		// the dl-bus pipeline is not initialized (e.g. failed restart)
+		return false
+	}
+
+	f, err := app.dl.Get()
+	if err == io.EOF {
+		return false
+	}
+
+	app.quality.add(err != nil)
+	if err != nil {
+		debug.ErrorLog.Println(err)
+		return true
+	}
+
+	// on a shared dl-bus, the frame is tagged with the device id, the device is also derived from the frame type
+	if d, ok := f.(datalogger.DeviceFrame); ok {
+		f = d.Frame
+	}
+
+	f = app.median.filter(f)
+	if !app.quality.confident(app.decoder.Locked()) {
+		debug.DebugLog.Printf("dl-bus not confidently locked, frame withheld: %v", f)
+		return true
+	}
+
+	debug.TraceLog.Printf("Frame: %v", f)
+	if app.capture != nil {
+		app.capture.frame()
+	}
+	app.store(f)
+	if app.watchpoint != nil {
+		app.watchpoint.check(f, app.decoder.Stats().Resyncs)
+	}
+	return true
+}
+
+// store saves the data frame as latest frame and in the history and sends it to mqtt (see validateMeasurements).
+//  The caller must lock the dl-bus pipeline.
+func (app *App) store(f interface{}) {
+	app.setLatestFrame(f)
+	app.history.add(time.Now(), f)
+	if app.config.MQTT.Edges {
+		app.publishEdges(f)
+	}
+	if app.runtime != nil {
+		app.runtime.update(f)
+	}
+	_ = app.validateMeasurements(f)
+}
+
+// minBaseline is the minimum baseline of the percentage thresholds (mqtt.deltapercent),
+// so the threshold of a value near zero doesn't become zero.
+const minBaseline = 1.0
+
+// changed returns true, if the value v of index i differs from the last sent value by more than its threshold:
+//  * the percentage threshold of the value (mqtt.deltapercent), relative to the last sent value (at least minBaseline)
+//  * otherwise the absolute threshold (mqtt.deltakelvin)
+func (app *App) changed(i int, v, last float64) bool {
+	if p := app.config.MQTT.DeltaPercent; i < len(p) && p[i] > 0 {
+		return math.Abs(v-last) > math.Max(math.Abs(last), minBaseline)*p[i]/100
+	}
+
+	return math.Abs(v-last) > app.config.MQTT.DeltaKelvin
+}
+
+// LatestFrame returns a copy of the last read data frame and its timestamp.
+//  The timestamp is zero, if no data frame has been read yet.
+func (app *App) LatestFrame() (interface{}, time.Time) {
+	app.DataFrame.Lock()
+	defer app.DataFrame.Unlock()
+	return app.DataFrame.data, frameTime(app.DataFrame.data)
+}
+
+// errNoFrame is returned, if no data frame has been received yet.
+var errNoFrame = errors.New("no data frame received yet")
+
+// receivedFrame returns the last read data frame or errNoFrame, if no data frame has been received yet.
+func (app *App) receivedFrame() (interface{}, error) {
+	f, ts := app.LatestFrame()
+	if ts.IsZero() || frameDevice(f) == "" {
+		return nil, errNoFrame
+	}
+	return f, nil
+}
+
+// setLatestFrame sets the last read data frame.
+func (app *App) setLatestFrame(f interface{}) {
+	app.DataFrame.Lock()
+	app.DataFrame.data = f
+	app.DataFrame.Unlock()
+}
+
 // validateMeasurements checks the dataframe by deltaT and delta
 // and send dataframe to mqtt if data changed or by send interval
 func (app *App) validateMeasurements(d interface{}) error {
-	var diff bool
+	device := frameDevice(d)
+	if device == "" {
+		return fmt.Errorf("unsupported frame type")
+	}
 
 	app.mqttData.Lock()
 	defer app.mqttData.Unlock()
 
-	switch f := d.(type) {
-	case datalogger.UVR42Frame:
-		switch m := app.mqttData.data.(type) {
-		case datalogger.UVR42Frame:
-			diff = f.TimeStamp.Sub(m.TimeStamp) > app.config.MQTT.Interval ||
-				f.Out1 != m.Out1 || f.Out2 != m.Out2 ||
-				math.Abs(f.Temperature1-m.Temperature1) > app.config.MQTT.DeltaKelvin ||
-				math.Abs(f.Temperature2-m.Temperature2) > app.config.MQTT.DeltaKelvin ||
-				math.Abs(f.Temperature3-m.Temperature3) > app.config.MQTT.DeltaKelvin ||
-				math.Abs(f.Temperature4-m.Temperature4) > app.config.MQTT.DeltaKelvin
-		default:
-			return fmt.Errorf("unsupported frame type")
+	diff := true
+	if m, ok := app.mqttData.data[device]; ok {
+		diff = frameTime(d).Sub(frameTime(m)) > app.config.MQTT.Interval
+
+		t, o := frameValues(d)
+		mt, mo := frameValues(m)
+		for i := range o {
+			diff = diff || o[i] != mo[i]
+		}
+		for i := range t {
+			diff = diff || app.changed(i, t[i], mt[i])
+		}
+
+		if r, ok := d.(datalogger.RawFrame); ok {
+			diff = diff || r.Data != m.(datalogger.RawFrame).Data
 		}
-	default:
-		return fmt.Errorf("unsupported frame type")
 	}
 
 	if diff {
-		app.mqttData.data = d
-		app.sendMQTT(app.config.MQTT.Topic, app.mqttData.data)
+		app.mqttData.data[device] = d
+		app.sendMQTT(app.topic(d), d)
+		if app.runtime != nil {
+			app.publishRuntime(d)
+		}
+		if app.influx != nil {
+			app.influx.add(d)
+		}
 	}
 
 	return nil
 }
 
+// topic returns the mqtt topic of the data frame.
+//  On a shared dl-bus (datalogger type auto), the device is appended to the topic, e.g. tadl/uvr42.
+//  The config must be locked by the caller.
+func (app *App) topic(d interface{}) string {
+	return app.deviceTopic(frameDevice(d))
+}
+
+// deviceTopic returns the mqtt topic of the device, see topic.
+func (app *App) deviceTopic(device string) string {
+	if app.config.DataLogger.Type == "auto" {
+		return app.config.MQTT.Topic + "/" + device
+	}
+	return app.config.MQTT.Topic
+}
+
+// republish sends the last sent data frames periodically to the mqtt broker (see mqtt.republishinterval),
+//  independent of the change detection, e.g. to defeat the eviction of retained messages by the broker.
+func (app *App) republish(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-app.ctx.Done():
+			return
+		}
+
+		app.mqttData.Lock()
+		frames := make([]interface{}, 0, len(app.mqttData.data))
+		for _, f := range app.mqttData.data {
+			frames = append(frames, f)
+		}
+		app.mqttData.Unlock()
+
+		for _, f := range frames {
+			app.bus.Lock()
+			topic := app.topic(f)
+			app.bus.Unlock()
+
+			debug.DebugLog.Print("republish last data frame")
+			app.sendMQTT(topic, f)
+		}
+	}
+}
+
 // sendMQTT send message struct to the mqtt broker.
 func (app *App) sendMQTT(topic string, msg interface{}) {
 	debug.TraceLog.Printf("prepare mqtt message %v %v", topic, msg)
 
-	b, err := json.MarshalIndent(msg, "", "  ")
+	frame := frameDevice(msg) != ""
+
+	m, err := newMessage(topic, msg, app.binary, app.timeFormat)
 	if err != nil {
 		debug.ErrorLog.Printf("sendMQTT marshal: %v", err)
 		return
 	}
+	if frame {
+		m.Qos, m.Retained = app.qos, app.retained
+	}
+
+	app.publish(m, frame)
+}
+
+// outgoing is a message to publish, frame is true for the message of a data frame.
+type outgoing struct {
+	mqtt.Message
+	frame bool
+}
+
+// publish sends the message to the mqtt broker without blocking the caller, frame is true for a data frame.
+//  With mqtt.strictorder the messages are published by a single worker in the order of the calls,
+//  otherwise each message is published by an own goroutine (messages may be reordered).
+func (app *App) publish(m mqtt.Message, frame bool) {
+	if app.publishers != nil {
+		app.publishers.record(m)
+	}
+
+	o := outgoing{Message: m, frame: frame}
+	if app.publishQueue == nil {
+		go app.deliver(o)
+		return
+	}
+
+	select {
+	case app.publishQueue <- o:
+	default:
+		debug.ErrorLog.Printf("mqtt publish queue is full, message %v dropped", m.Topic)
+	}
+}
+
+// runPublisher publishes the messages of the publish queue in order.
+//  On shutdown the queued messages are published, before the mqtt connection is closed.
+func (app *App) runPublisher() {
+	for {
+		select {
+		case o := <-app.publishQueue:
+			app.deliver(o)
+		case <-app.ctx.Done():
+			for {
+				select {
+				case o := <-app.publishQueue:
+					app.deliver(o)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver publishes the message, the first published data frame signals the readiness (see WaitReady).
+func (app *App) deliver(o outgoing) {
+	switch err := app.mqtt.Publish(o.Message); {
+	case errors.Is(err, mqtt.ErrNotConnected):
+		// the broker is offline, the lost connection is already logged by the mqtt handler
+		debug.DebugLog.Printf("mqtt publish %v: %v", o.Topic, err)
+		return
+	case err != nil:
+		debug.ErrorLog.Printf("mqtt publish %v: %v", o.Topic, err)
+		return
+	}
+
+	if o.frame {
+		app.readyOnce.Do(func() { close(app.ready) })
+	}
+}
+
+// WaitReady blocks until the first valid data frame is decoded and published to the mqtt broker
+// or the context is done. It returns the error of the context, if the application didn't get ready.
+func (app *App) WaitReady(ctx context.Context) error {
+	select {
+	case <-app.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush publishes the last read data frame to the mqtt broker and waits until the message is sent
+// or the timeout is reached. It is used to save the last state before a graceful exit.
+//  If no data frame has been received yet, nothing is published.
+func (app *App) Flush(timeout time.Duration) error {
+	if app.mqtt == nil {
+		return nil
+	}
+
+	f, err := app.receivedFrame()
+	if err != nil {
+		debug.InfoLog.Printf("nothing to flush: %v", err)
+		return nil
+	}
+
+	app.bus.Lock()
+	topic := app.topic(f)
+	app.bus.Unlock()
+
+	m, err := newMessage(topic, f, app.binary, app.timeFormat)
+	if err != nil {
+		return err
+	}
+	m.Qos, m.Retained = app.qos, app.retained
+
+	done := make(chan error, 1)
+	go func() { done <- app.mqtt.Publish(m) }()
+
+	select {
+	case err = <-done:
+		return err
+	case <-time.After(timeout):
+		return errors.New("flush timeout")
+	}
+}
+
+// newMessage marshals the message struct to a mqtt message (retained, qos 0).
+//  If binary is true and the message implements encoding.BinaryMarshaler (e.g. UVR42Frame),
+//  the message is marshaled to the binary format, otherwise to json with the time stamps in the time format tf.
+func newMessage(topic string, msg interface{}, binary bool, tf timeFormat) (mqtt.Message, error) {
+	var b []byte
+	var err error
+
+	if m, ok := msg.(encoding.BinaryMarshaler); ok && binary {
+		b, err = m.MarshalBinary()
+	} else {
+		b, err = json.MarshalIndent(tf.apply(msg), "", "  ")
+	}
+	if err != nil {
+		return mqtt.Message{}, err
+	}
 
-	go app.mqtt.Publish(mqtt.Message{
+	return mqtt.Message{
 		Qos:      0,
 		Retained: true,
 		Topic:    topic,
 		Payload:  b,
-	})
+	}, nil
 }
@@ -0,0 +1,388 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"tadl/pkg/app/config"
+	"tadl/pkg/datalogger"
+	"tadl/pkg/mqtt"
+	"tadl/pkg/mqttmem"
+	"tadl/pkg/raspberry"
+)
+
+func TestSendMQTT(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+
+	f := datalogger.UVR42Frame{
+		TimeStamp:    time.Date(2021, 11, 7, 10, 0, 0, 0, time.UTC),
+		Temperature1: 45.5,
+		Temperature2: -3.5,
+		Out1:         true,
+		Outputs:      1,
+	}
+	app.sendMQTT("tadl", f)
+
+	m := waitMessages(t, b, "tadl", 1)[0]
+	if !m.Retained || m.Qos != 0 {
+		t.Errorf("got retained %v qos %v, want retained true qos 0", m.Retained, m.Qos)
+	}
+
+	var got datalogger.UVR42Frame
+	if err := json.Unmarshal(m.Payload, &got); err != nil {
+		t.Fatalf("invalid json payload %s: %v", m.Payload, err)
+	}
+	if !got.TimeStamp.Equal(f.TimeStamp) || got.Temperature1 != 45.5 || got.Temperature2 != -3.5 || !got.Out1 || got.Out2 ||
+		got.Outputs != 1 {
+		t.Errorf("got payload %+v, want %+v", got, f)
+	}
+}
+
+func TestSendMQTTBinary(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	app.binary = true
+	app.qos, app.retained = 1, false
+
+	f := datalogger.UVR42Frame{TimeStamp: time.Unix(1636275600, 0), Temperature1: 21.5, Out2: true, Outputs: 2}
+	app.sendMQTT("tadl", f)
+
+	m := waitMessages(t, b, "tadl", 1)[0]
+	if m.Retained || m.Qos != 1 {
+		t.Errorf("got retained %v qos %v, want retained false qos 1", m.Retained, m.Qos)
+	}
+
+	want, _ := f.MarshalBinary()
+	if !bytes.Equal(m.Payload, want) {
+		t.Errorf("got payload %x, want %x", m.Payload, want)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+
+	// no data frame received yet, the zero frame must not be published
+	if err := app.Flush(time.Second); err != nil {
+		t.Fatalf("flush without frame: %v", err)
+	}
+	if m := b.Messages(); len(m) != 0 {
+		t.Fatalf("got %v published messages without received frame, want none: %+v", len(m), m)
+	}
+
+	app.setLatestFrame(datalogger.UVR42Frame{TimeStamp: time.Now(), Temperature1: 45.5})
+	if err := app.Flush(time.Second); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	m := topicMessages(b, "tadl")
+	if len(m) != 1 || !m[0].Retained {
+		t.Fatalf("got messages %+v, want one retained message", m)
+	}
+	var got datalogger.UVR42Frame
+	if err := json.Unmarshal(m[0].Payload, &got); err != nil || got.Temperature1 != 45.5 {
+		t.Errorf("got payload %s (%v), want the latest frame", m[0].Payload, err)
+	}
+}
+
+func TestFlushAuto(t *testing.T) {
+	app, b := newTestApp(t, "auto")
+
+	if err := app.Flush(time.Second); err != nil {
+		t.Fatalf("flush without frame: %v", err)
+	}
+	if m := b.Messages(); len(m) != 0 {
+		t.Fatalf("got published messages %+v without received frame, want none", m)
+	}
+}
+
+func TestRepublish(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	if app.config.MQTT.Heartbeat != 0 {
+		t.Fatalf("got heartbeat %v, want disabled", app.config.MQTT.Heartbeat)
+	}
+
+	// the unchanged frame isn't sent again by the change detection
+	f := datalogger.UVR42Frame{TimeStamp: time.Now(), Temperature1: 45.5}
+	app.store(f)
+	app.store(f)
+	time.Sleep(20 * time.Millisecond)
+	if m := topicMessages(b, "tadl"); len(m) != 1 {
+		t.Fatalf("got %v messages of the unchanged frame, want 1", len(m))
+	}
+
+	const interval = 50 * time.Millisecond
+	start := time.Now()
+	app.goRun(func() { app.republish(interval) })
+
+	m := waitMessages(t, b, "tadl", 3)
+	if d := time.Since(start); d < 2*interval {
+		t.Errorf("got 2 republished messages after %v, want after %v", d, 2*interval)
+	}
+	for _, m := range m[1:] {
+		var got datalogger.UVR42Frame
+		if err := json.Unmarshal(m.Payload, &got); err != nil || got.Temperature1 != 45.5 {
+			t.Errorf("got republished payload %s (%v), want the last sent frame", m.Payload, err)
+		}
+	}
+}
+
+func TestLatestFrameConcurrent(t *testing.T) {
+	app, _ := newTestApp(t, "uvr42")
+	app.web.Get("/data", app.HandleData())
+
+	const frames = 200
+	start := time.Date(2021, 11, 7, 10, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= frames; i++ {
+			app.setLatestFrame(datalogger.UVR42Frame{TimeStamp: start.Add(time.Duration(i) * time.Second), Temperature1: float64(i)})
+		}
+	}()
+
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < frames; i++ {
+				f, ts := app.LatestFrame()
+				u, ok := f.(datalogger.UVR42Frame)
+				if !ok {
+					continue
+				}
+				// the timestamp belongs to the returned frame
+				if !ts.Equal(u.TimeStamp) || ts.Sub(start) != time.Duration(u.Temperature1)*time.Second {
+					t.Errorf("got frame %+v with timestamp %v, want a consistent copy", u, ts)
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			resp, err := app.web.Test(httptest.NewRequest("GET", "/data", nil))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = resp.Body.Close()
+		}
+	}()
+	wg.Wait()
+
+	f, _ := app.LatestFrame()
+	if got := f.(datalogger.UVR42Frame).Temperature1; got != frames {
+		t.Errorf("got latest temperature %v, want %v", got, float64(frames))
+	}
+}
+
+func TestReceiveAuto(t *testing.T) {
+	app, b := newTestApp(t, "auto")
+	app.config.DLbus.Chip = "mock"
+	app.config.DLbus.GpioBuffer = 4096
+	app.config.DLbus.ClockSamples = 100
+	if err := app.initBus(); err != nil {
+		t.Fatal(err)
+	}
+	app.goRun(app.run)
+
+	// interleaved frames of an uvr42 (45.5 °C) and an uvr31 (21.0 °C) on a shared dl-bus
+	uvr42 := []byte{0x10, 0xc7, 0x01, 0xd2, 0x00, 0xd2, 0x00, 0xd2, 0x00, 0}
+	uvr31 := []byte{0x30, 0xd2, 0x00, 0xd2, 0x00, 0xd2, 0x00, 0}
+	l := app.chip.(*raspberry.MockChip).Line(app.config.DLbus.Gpio)
+	for _, e := range busEvents(t, 10*time.Millisecond, uvr42, uvr31, uvr42, uvr31, uvr42, uvr31) {
+		l.Push(e)
+	}
+
+	var f42 datalogger.UVR42Frame
+	if err := json.Unmarshal(waitMessages(t, b, "tadl/uvr42", 1)[0].Payload, &f42); err != nil || f42.Temperature1 != 45.5 {
+		t.Errorf("got uvr42 frame %+v (%v), want temperature 45.5", f42, err)
+	}
+	var f31 datalogger.UVR31Frame
+	if err := json.Unmarshal(waitMessages(t, b, "tadl/uvr31", 1)[0].Payload, &f31); err != nil || f31.Temperature1 != 21 {
+		t.Errorf("got uvr31 frame %+v (%v), want temperature 21", f31, err)
+	}
+	if m := topicMessages(b, "tadl"); len(m) != 0 {
+		t.Errorf("got %v messages of the topic without device, want none", len(m))
+	}
+}
+
+// slowBroker is an in-memory broker with a publish latency, which decreases with each message,
+// so concurrently published messages overtake each other.
+type slowBroker struct {
+	*mqttmem.Broker
+	sync.Mutex
+	latency time.Duration
+}
+
+func (b *slowBroker) Publish(m mqtt.Message) error {
+	b.Lock()
+	d := b.latency
+	if b.latency > time.Millisecond {
+		b.latency -= time.Millisecond
+	}
+	b.Unlock()
+
+	time.Sleep(d)
+	return b.Broker.Publish(m)
+}
+
+func TestStrictOrder(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	if !config.NewConfig().MQTT.StrictOrder {
+		t.Error("got strict order disabled by default, want enabled")
+	}
+
+	app.mqtt = &slowBroker{Broker: b, latency: 20 * time.Millisecond}
+	app.publishQueue = make(chan outgoing, publishQueueSize)
+	app.goRun(app.runPublisher)
+
+	const frames = 10
+	for i := 1; i <= frames; i++ {
+		app.store(datalogger.UVR42Frame{TimeStamp: time.Now(), Temperature1: float64(10 * i)})
+	}
+
+	for i, m := range waitMessages(t, b, "tadl", frames) {
+		var f datalogger.UVR42Frame
+		if err := json.Unmarshal(m.Payload, &f); err != nil {
+			t.Fatalf("invalid json payload %s: %v", m.Payload, err)
+		}
+		if want := float64(10 * (i + 1)); f.Temperature1 != want {
+			t.Errorf("message %v: got temperature %v, want %v (in order of the frames)", i, f.Temperature1, want)
+		}
+	}
+}
+
+func TestChanged(t *testing.T) {
+	tests := []struct {
+		name    string
+		percent []float64
+		i       int
+		v, last float64
+		want    bool
+	}{
+		{"absolute below", nil, 0, 45.9, 45.5, false},
+		{"absolute above", nil, 0, 46.1, 45.5, true},
+		{"percent below", []float64{2}, 0, 101.9, 100, false},
+		{"percent above", []float64{2}, 0, 102.1, 100, true},
+		{"percent of a negative value", []float64{2}, 0, -102.1, -100, true},
+		// the small absolute change is gated by the percentage
+		{"percent of a large value", []float64{2}, 0, 800.9, 800, false},
+		// the baseline of a zero value is minBaseline, the threshold is 0.02 instead of zero
+		{"percent near zero below", []float64{2}, 0, 0.01, 0, false},
+		{"percent near zero above", []float64{2}, 0, 0.03, 0, true},
+		// values without a percentage threshold use the absolute threshold
+		{"absolute without percent", []float64{2}, 1, 46.1, 45.5, true},
+		{"absolute of percent 0", []float64{2, 0}, 1, 45.9, 45.5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := newTestApp(t, "uvr42")
+			app.config.MQTT.DeltaKelvin = 0.5
+			app.config.MQTT.DeltaPercent = tt.percent
+
+			if got := app.changed(tt.i, tt.v, tt.last); got != tt.want {
+				t.Errorf("got changed %v of value %v (last %v), want %v", got, tt.v, tt.last, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeltaPercent(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	app.config.MQTT.DeltaKelvin = 0.5
+	app.config.MQTT.Interval = time.Hour
+	// Temperature2 (e.g. a radiation sensor) is gated by 2 %, the others by 0.5 K
+	app.config.MQTT.DeltaPercent = []float64{0, 2}
+
+	ts := time.Now()
+	frames := []struct {
+		t1, t2 float64
+		sent   bool
+	}{
+		{45.5, 800, true},
+		{45.5, 810, false},
+		{45.5, 817, true},
+		{45.9, 817, false},
+		{46.1, 817, true},
+	}
+	for i, f := range frames {
+		n := len(topicMessages(b, "tadl"))
+		_ = app.validateMeasurements(datalogger.UVR42Frame{TimeStamp: ts, Temperature1: f.t1, Temperature2: f.t2})
+		if f.sent {
+			n++
+			waitMessages(t, b, "tadl", n)
+		} else {
+			time.Sleep(20 * time.Millisecond)
+		}
+		if got := len(topicMessages(b, "tadl")); got != n {
+			t.Errorf("frame %v: got %v messages, want %v", i, got, n)
+		}
+	}
+}
+
+// offlineBroker is an in-memory broker, which can be disconnected.
+type offlineBroker struct {
+	*mqttmem.Broker
+	sync.Mutex
+	offline bool
+}
+
+func (b *offlineBroker) Publish(m mqtt.Message) error {
+	b.Lock()
+	offline := b.offline
+	b.Unlock()
+
+	if offline {
+		return mqtt.ErrNotConnected
+	}
+	return b.Broker.Publish(m)
+}
+
+func (b *offlineBroker) setOffline(offline bool) {
+	b.Lock()
+	b.offline = offline
+	b.Unlock()
+}
+
+func TestWaitReady(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	broker := &offlineBroker{Broker: b, offline: true}
+	app.mqtt = broker
+
+	// waitReady returns the error of WaitReady within the timeout
+	waitReady := func(timeout time.Duration) error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return app.WaitReady(ctx)
+	}
+
+	if err := waitReady(20 * time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v without a frame, want %v", err, context.DeadlineExceeded)
+	}
+
+	// a frame, which isn't published to the broker, doesn't signal the readiness
+	app.store(datalogger.UVR42Frame{TimeStamp: time.Now(), Temperature1: 45.5})
+	if err := waitReady(20 * time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v of an unpublished frame, want %v", err, context.DeadlineExceeded)
+	}
+
+	broker.setOffline(false)
+	app.store(datalogger.UVR42Frame{TimeStamp: time.Now(), Temperature1: 46.5})
+	if err := waitReady(time.Second); err != nil {
+		t.Fatalf("got error %v after the first published frame, want nil", err)
+	}
+	// the readiness remains
+	if err := waitReady(time.Millisecond); err != nil {
+		t.Errorf("got error %v of a ready app, want nil", err)
+	}
+}
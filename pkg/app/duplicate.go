@@ -0,0 +1,95 @@
+package app
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"tadl/pkg/mqtt"
+
+	"github.com/womat/debug"
+)
+
+// sentPayloads is the count of recently sent payloads per topic, which are recognized as own messages.
+const sentPayloads = 8
+
+// publisherMonitor detects a second publisher (e.g. a misconfigured tadl instance) of our topics.
+// It remembers the recently sent payloads per topic, a received message with another payload is foreign.
+type publisherMonitor struct {
+	sync.Mutex
+	// sent contains the recently sent payloads per topic.
+	sent map[string][][]byte
+	// foreign is the count of received foreign messages.
+	foreign uint64
+	// lastForeign is the receive time of the last foreign message.
+	lastForeign time.Time
+}
+
+// publisherStatus contains the result of the duplicate publisher detection.
+type publisherStatus struct {
+	ForeignMessages    uint64
+	LastForeignMessage time.Time
+}
+
+// newPublisherMonitor returns a monitor without any sent messages.
+func newPublisherMonitor() *publisherMonitor {
+	return &publisherMonitor{sent: map[string][][]byte{}}
+}
+
+// record remembers a sent message.
+func (p *publisherMonitor) record(m mqtt.Message) {
+	p.Lock()
+	defer p.Unlock()
+
+	s := append(p.sent[m.Topic], m.Payload)
+	if len(s) > sentPayloads {
+		s = s[1:]
+	}
+	p.sent[m.Topic] = s
+}
+
+// check checks a received message of our topic.
+//  Retained messages are delivered on subscribe and may be sent by a previous run, so they are ignored.
+func (p *publisherMonitor) check(m mqtt.Message) {
+	if m.Retained {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	for _, s := range p.sent[m.Topic] {
+		if bytes.Equal(s, m.Payload) {
+			return
+		}
+	}
+
+	p.foreign++
+	p.lastForeign = time.Now()
+	debug.WarningLog.Printf("received a message of topic %v, which wasn't sent by this instance, another publisher uses the topic", m.Topic)
+}
+
+// status returns the count and the time of the last foreign message.
+func (p *publisherMonitor) status() publisherStatus {
+	p.Lock()
+	defer p.Unlock()
+	return publisherStatus{ForeignMessages: p.foreign, LastForeignMessage: p.lastForeign}
+}
+
+// monitorTopic subscribes the topic of the data frames to detect a second publisher (mqtt.detectduplicates).
+//  On a shared dl-bus (datalogger type auto), the topics of all devices are subscribed.
+func (app *App) monitorTopic() error {
+	topic := app.config.MQTT.Topic
+	if app.config.DataLogger.Type == "auto" {
+		topic += "/+"
+	}
+
+	// the command topic matches the device topics, but the commands are sent by other clients,
+	// the availability topic (mqtt.will) may match too, but it's published by the mqtt handler and the broker
+	cmd, will := app.commandTopic(), app.config.MQTT.Will.Topic
+	return app.mqtt.Subscribe(topic, 0, func(m mqtt.Message) {
+		if m.Topic != cmd && m.Topic != will {
+			app.publishers.check(m)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tadl/pkg/datalogger"
+	"tadl/pkg/mqtt"
+)
+
+func TestMonitorTopic(t *testing.T) {
+	app, b := newTestApp(t, "auto")
+	app.config.MQTT.Will.Topic = "tadl/availability"
+	app.web.Get("/health", app.HandleHealth())
+	app.publishers = newPublisherMonitor()
+	if err := app.monitorTopic(); err != nil {
+		t.Fatal(err)
+	}
+
+	// own messages: a data frame, the availability published by the mqtt handler and a command of another client
+	app.sendMQTT(app.deviceTopic("uvr42"), datalogger.UVR42Frame{TimeStamp: time.Now(), Temperature1: 45.5})
+	waitMessages(t, b, "tadl/uvr42", 1)
+	for _, m := range []mqtt.Message{
+		{Topic: "tadl/availability", Payload: []byte("online"), Retained: true},
+		{Topic: "tadl/cmd", Payload: []byte("publish")},
+	} {
+		if err := b.Publish(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := app.publishers.status(); s.ForeignMessages != 0 {
+		t.Fatalf("got %v foreign messages of own messages, want 0", s.ForeignMessages)
+	}
+
+	// a second publisher of the device topic
+	if err := b.Publish(mqtt.Message{Topic: "tadl/uvr42", Payload: []byte(`{"Temperature1":21}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := app.web.Test(httptest.NewRequest("GET", "/health", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var health struct {
+		Publishers *publisherStatus
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	if p := health.Publishers; p == nil || p.ForeignMessages != 1 || p.LastForeignMessage.IsZero() {
+		t.Errorf("got publishers %+v, want 1 foreign message", p)
+	}
+}
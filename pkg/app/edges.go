@@ -0,0 +1,70 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/womat/debug"
+)
+
+// edgeDetector detects the transitions of the outputs between consecutive data frames of each device.
+type edgeDetector struct {
+	// outputs contains the output states of the last data frame per device (see frameDevice).
+	outputs map[string][]bool
+}
+
+// edge is the event of an output transition.
+// output example:
+//  {"TimeStamp":"2021-11-07T10:00:00+01:00","Output":1,"Edge":"on"}
+type edge struct {
+	TimeStamp time.Time
+	Output    int
+	Edge      string
+}
+
+// newEdgeDetector returns an edge detector without any previous data frames.
+func newEdgeDetector() *edgeDetector {
+	return &edgeDetector{outputs: map[string][]bool{}}
+}
+
+// detect returns the output transitions of the data frame to the previous data frame of the device.
+// The first data frame of a device has no transitions.
+func (e *edgeDetector) detect(d interface{}) []edge {
+	var edges []edge
+
+	device := frameDevice(d)
+	_, outputs := frameValues(d)
+
+	if last, ok := e.outputs[device]; ok && len(last) == len(outputs) {
+		for i, o := range outputs {
+			switch {
+			case o && !last[i]:
+				edges = append(edges, edge{TimeStamp: frameTime(d), Output: i + 1, Edge: "on"})
+			case !o && last[i]:
+				edges = append(edges, edge{TimeStamp: frameTime(d), Output: i + 1, Edge: "off"})
+			}
+		}
+	}
+
+	e.outputs[device] = outputs
+	return edges
+}
+
+// publishEdges sends the output transitions of the data frame to <topic>/out<n>/edge (see mqtt.edges).
+// The messages are not retained, because they are events.
+//  The config must be locked by the caller.
+func (app *App) publishEdges(d interface{}) {
+	for _, e := range app.edges.detect(d) {
+		topic := fmt.Sprintf("%v/out%d/edge", app.topic(d), e.Output)
+
+		m, err := newMessage(topic, e, false, app.timeFormat)
+		if err != nil {
+			debug.ErrorLog.Printf("publishEdges marshal: %v", err)
+			continue
+		}
+		m.Retained = false
+
+		debug.DebugLog.Printf("output %v turned %v", e.Output, e.Edge)
+		app.publish(m, false)
+	}
+}
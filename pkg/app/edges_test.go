@@ -0,0 +1,60 @@
+package app
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"tadl/pkg/datalogger"
+	"tadl/pkg/mqtt"
+)
+
+func TestPublishEdges(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	app.config.MQTT.Edges = true
+	app.edges = newEdgeDetector()
+
+	frame := func(out1, out2 bool) datalogger.UVR42Frame {
+		return datalogger.UVR42Frame{TimeStamp: time.Now(), Temperature1: 45.5, Out1: out1, Out2: out2}
+	}
+
+	// the first frame has no transitions, the unchanged frame neither
+	app.store(frame(false, true))
+	app.store(frame(false, true))
+	// Out1 0 >> 1
+	app.store(frame(true, true))
+	app.store(frame(true, true))
+	// Out1 1 >> 0, Out2 1 >> 0
+	app.store(frame(false, false))
+
+	// the messages are published concurrently, the order is checked by the timestamps of the frames
+	waitMessages(t, b, "tadl/out1/edge", 2)
+	waitMessages(t, b, "tadl/out2/edge", 1)
+	// no further edge events of the unchanged outputs
+	time.Sleep(20 * time.Millisecond)
+
+	edges := func(msgs []mqtt.Message) []edge {
+		var edges []edge
+		for _, m := range msgs {
+			if m.Retained {
+				t.Errorf("got retained edge event of topic %v, want not retained", m.Topic)
+			}
+			var e edge
+			if err := json.Unmarshal(m.Payload, &e); err != nil {
+				t.Fatalf("invalid json payload %s: %v", m.Payload, err)
+			}
+			edges = append(edges, e)
+		}
+		sort.Slice(edges, func(i, j int) bool { return edges[i].TimeStamp.Before(edges[j].TimeStamp) })
+		return edges
+	}
+
+	if got := edges(topicMessages(b, "tadl/out1/edge")); len(got) != 2 || got[0].Edge != "on" || got[1].Edge != "off" ||
+		got[0].Output != 1 {
+		t.Errorf("got edges %+v of out1, want on and off", got)
+	}
+	if got := edges(topicMessages(b, "tadl/out2/edge")); len(got) != 1 || got[0].Edge != "off" || got[0].Output != 2 {
+		t.Errorf("got edges %+v of out2, want off", got)
+	}
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/womat/debug"
+)
+
+// exportFile is the file name of the csv export, which is proposed by the browser.
+const exportFile = "tadl.csv"
+
+// HandleExport returns the data frames of the in-memory history as csv file (e.g. for a spreadsheet), see /history.
+//  The first row is the header, each field of the data frames is a column (e.g. Temperature1, Inputs1, HeatMeters1.Power).
+//  Different frame types (datalogger type auto) share the columns of the same name, missing fields are empty.
+//  An empty history returns the header of the configured frame type only.
+func (app *App) HandleExport() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		debug.DebugLog.Print("web request export")
+
+		since, err := parseSince(ctx.Query("since"))
+		if err != nil {
+			ctx.Status(fiber.StatusBadRequest)
+			return ctx.JSON(fiber.Map{"error": "invalid since"})
+		}
+
+		entries := app.history.since(since)
+		frames := make([]interface{}, 0, len(entries))
+		for _, e := range entries {
+			frames = append(frames, e.frame)
+		}
+		if len(frames) == 0 {
+			app.bus.Lock()
+			device := app.config.DataLogger.Type
+			app.bus.Unlock()
+
+			// the zero frame of the configured type defines the header
+			if f, err := syntheticFrame(device, []byte("{}")); err == nil {
+				header, _ := csvRows([]interface{}{f})
+				return sendCSV(ctx, header, nil)
+			}
+		}
+
+		header, rows := csvRows(frames)
+		return sendCSV(ctx, header, rows)
+	}
+}
+
+// sendCSV sends the csv file as download.
+func sendCSV(ctx *fiber.Ctx, header []string, rows [][]string) error {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	_ = w.Write(header)
+	_ = w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	ctx.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", exportFile))
+	return ctx.Send(b.Bytes())
+}
+
+// csvRows returns the header and the rows of the data frames.
+//  The columns are ordered by their first appearance, the first column is the device of the frame.
+func csvRows(frames []interface{}) ([]string, [][]string) {
+	header := []string{"Device"}
+	index := map[string]int{"Device": 0}
+
+	values := make([]map[string]string, 0, len(frames))
+	for _, f := range frames {
+		v := map[string]string{"Device": frameDevice(f)}
+		flatten(reflect.ValueOf(f), "", func(name, value string) {
+			if _, ok := index[name]; !ok {
+				index[name] = len(header)
+				header = append(header, name)
+			}
+			v[name] = value
+		})
+		values = append(values, v)
+	}
+
+	rows := make([][]string, 0, len(values))
+	for _, v := range values {
+		row := make([]string, len(header))
+		for name, value := range v {
+			row[index[name]] = value
+		}
+		rows = append(rows, row)
+	}
+
+	return header, rows
+}
+
+// textMarshalerType is the type of the encoding.TextMarshaler interface (e.g. SensorType).
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// flatten calls the function add for each field of the value v and its name.
+//  The fields of a struct are prefixed by the struct name (e.g. HeatMeters1.Power),
+//  the elements of an array or slice are numbered from 1 (e.g. Inputs1), a nil pointer is empty.
+func flatten(v reflect.Value, name string, add func(name, value string)) {
+	if v.Type() == timeType {
+		add(name, v.Interface().(time.Time).Format(time.RFC3339Nano))
+		return
+	}
+	if v.Type().Implements(textMarshalerType) {
+		b, _ := v.Interface().(encoding.TextMarshaler).MarshalText()
+		add(name, string(b))
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			add(name, "")
+			return
+		}
+		flatten(v.Elem(), name, add)
+	case reflect.Struct:
+		prefix := name
+		if prefix != "" {
+			prefix += "."
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.PkgPath == "" && f.Tag.Get("json") != "-" {
+				flatten(v.Field(i), prefix+f.Name, add)
+			}
+		}
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			flatten(v.Index(i), name+strconv.Itoa(i+1), add)
+		}
+	case reflect.Float32, reflect.Float64:
+		add(name, strconv.FormatFloat(v.Float(), 'f', -1, 64))
+	default:
+		add(name, fmt.Sprint(v.Interface()))
+	}
+}
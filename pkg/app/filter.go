@@ -0,0 +1,59 @@
+package app
+
+import (
+	"sort"
+)
+
+// medianFilter suppresses isolated temperature spikes by a median filter per sensor.
+// Real steps pass through with a delay of (window-1)/2 frames.
+type medianFilter struct {
+	// window is the count of samples (odd number), values < 3 disable the filter.
+	window int
+	// history holds the last samples of each sensor per device (see frameDevice).
+	history map[string][][]float64
+}
+
+// newMedianFilter returns a median filter with the given window size.
+func newMedianFilter(window int) *medianFilter {
+	return &medianFilter{window: window, history: map[string][][]float64{}}
+}
+
+// filter adds the temperatures of the data frame to the history and returns a copy of the data frame
+// with the median temperatures. Until the history is filled, the data frame is returned unchanged.
+func (m *medianFilter) filter(d interface{}) interface{} {
+	if m.window < 3 {
+		return d
+	}
+
+	t, _ := frameValues(d)
+	device := frameDevice(d)
+	h := m.history[device]
+	if len(h) != len(t) {
+		h = make([][]float64, len(t))
+		m.history[device] = h
+	}
+
+	filled := true
+	median := make([]float64, len(t))
+
+	for i, v := range t {
+		if h[i] = append(h[i], v); len(h[i]) > m.window {
+			h[i] = h[i][1:]
+		}
+
+		if len(h[i]) < m.window {
+			filled = false
+			continue
+		}
+
+		s := append([]float64{}, h[i]...)
+		sort.Float64s(s)
+		median[i] = s[len(s)/2]
+	}
+
+	if !filled {
+		return d
+	}
+
+	return setTemperatures(d, median)
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+
+	"tadl/pkg/datalogger"
+)
+
+func TestMedianFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		window int
+		in     []float64
+		want   []float64
+	}{
+		{"disabled", 1, []float64{20, 20, 80, 20}, []float64{20, 20, 80, 20}},
+		// until the history is filled, the frames pass unchanged
+		{"spike", 3, []float64{20, 20, 20, 80, 20, 20}, []float64{20, 20, 20, 20, 20, 20}},
+		{"step", 3, []float64{20, 20, 20, 30, 30, 30}, []float64{20, 20, 20, 20, 30, 30}},
+		{"spike of two samples", 5, []float64{20, 20, 20, 20, 80, 80, 20, 20}, []float64{20, 20, 20, 20, 20, 20, 20, 20}},
+		{"step of window 5", 5, []float64{20, 20, 20, 20, 20, 30, 30, 30, 30}, []float64{20, 20, 20, 20, 20, 20, 20, 30, 30}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMedianFilter(tt.window)
+
+			var got []float64
+			for _, v := range tt.in {
+				// the second sensor is constant, it's filtered independently
+				f := m.filter(datalogger.UVR42Frame{Temperature1: v, Temperature2: 45}).(datalogger.UVR42Frame)
+				if f.Temperature2 != 45 {
+					t.Errorf("got temperature2 %v, want 45", f.Temperature2)
+				}
+				got = append(got, f.Temperature1)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMedianFilterDevices(t *testing.T) {
+	m := newMedianFilter(3)
+
+	// the history is kept per device, the uvr31 frames don't disturb the uvr42 history
+	for _, v := range []float64{20, 20} {
+		m.filter(datalogger.UVR42Frame{Temperature1: v})
+		m.filter(datalogger.UVR31Frame{Temperature1: 60})
+	}
+	if f := m.filter(datalogger.UVR42Frame{Temperature1: 80}).(datalogger.UVR42Frame); f.Temperature1 != 20 {
+		t.Errorf("got uvr42 temperature %v, want the filtered 20", f.Temperature1)
+	}
+	if f := m.filter(datalogger.UVR31Frame{Temperature1: 60}).(datalogger.UVR31Frame); f.Temperature1 != 60 {
+		t.Errorf("got uvr31 temperature %v, want 60", f.Temperature1)
+	}
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"time"
+
+	"tadl/pkg/datalogger"
+)
+
+// frameValues returns the temperatures and output states of a data frame.
+func frameValues(d interface{}) (temperatures []float64, outputs []bool) {
+	switch f := d.(type) {
+	case datalogger.UVR42Frame:
+		return []float64{f.Temperature1, f.Temperature2, f.Temperature3, f.Temperature4}, []bool{f.Out1, f.Out2}
+	case datalogger.UVR31Frame:
+		return []float64{f.Temperature1, f.Temperature2, f.Temperature3}, []bool{f.Out1}
+	case datalogger.UVR1611Frame:
+		// the uvr1611 has 13 outputs
+		outputs := make([]bool, 13)
+		for i := range outputs {
+			outputs[i] = f.Outputs&(1<<i) > 0
+		}
+		return append([]float64{}, f.Inputs[:]...), outputs
+	}
+
+	return nil, nil
+}
+
+// frameInputs returns the sensor types of the values of a data frame (see frameValues) and the unit of the temperatures.
+// The configured types override the transmitted types, the type of a value is SensorNone (temperature), if it's unknown.
+func frameInputs(d interface{}, configured []datalogger.SensorType) (types []datalogger.SensorType, unit datalogger.Unit) {
+	var transmitted []datalogger.SensorType
+	switch f := d.(type) {
+	case datalogger.UVR42Frame:
+		transmitted, unit = f.SensorTypes, f.Unit
+	case datalogger.UVR31Frame:
+		unit = f.Unit
+	case datalogger.UVR1611Frame:
+		transmitted, unit = f.SensorTypes[:], f.Unit
+	}
+
+	values, _ := frameValues(d)
+	types = make([]datalogger.SensorType, len(values))
+	for i := range types {
+		if i < len(transmitted) {
+			types[i] = transmitted[i]
+		}
+		if i < len(configured) && configured[i] != datalogger.SensorNone {
+			types[i] = configured[i]
+		}
+	}
+
+	return types, unit
+}
+
+// setTemperatures returns a copy of the data frame with the given temperatures.
+func setTemperatures(d interface{}, t []float64) interface{} {
+	switch f := d.(type) {
+	case datalogger.UVR42Frame:
+		f.Temperature1, f.Temperature2, f.Temperature3, f.Temperature4 = t[0], t[1], t[2], t[3]
+		return f
+	case datalogger.UVR31Frame:
+		f.Temperature1, f.Temperature2, f.Temperature3 = t[0], t[1], t[2]
+		return f
+	case datalogger.UVR1611Frame:
+		copy(f.Inputs[:], t)
+		return f
+	}
+
+	return d
+}
+
+// frameTime returns the timestamp of a data frame.
+func frameTime(d interface{}) time.Time {
+	switch f := d.(type) {
+	case datalogger.UVR42Frame:
+		return f.TimeStamp
+	case datalogger.UVR31Frame:
+		return f.TimeStamp
+	case datalogger.UVR1611Frame:
+		return f.TimeStamp
+	case datalogger.RawFrame:
+		return f.TimeStamp
+	}
+
+	return time.Time{}
+}
+
+// frameDevice returns the device name of a data frame (as used for datalogger.type).
+func frameDevice(d interface{}) string {
+	switch d.(type) {
+	case datalogger.UVR42Frame:
+		return "uvr42"
+	case datalogger.UVR31Frame:
+		return "uvr31"
+	case datalogger.UVR1611Frame:
+		return "uvr1611"
+	case datalogger.RawFrame:
+		return "raw"
+	}
+
+	return ""
+}
@@ -6,10 +6,28 @@ import (
 	"runtime"
 	"time"
 
+	"tadl/pkg/manchester"
+	"tadl/pkg/port"
+	"tadl/pkg/raspberry"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/womat/debug"
 )
 
+// dlbusStatus contains the status of the dl-bus decoder.
+type dlbusStatus struct {
+	Synchronized bool
+	LastFrame    time.Time
+	LastFrameAge string
+	Frames       uint64
+}
+
+// channelFills contains the fill levels of the channels of the dl-bus pipeline.
+type channelFills struct {
+	Gpio    port.ChannelFill
+	Decoder port.ChannelFill
+}
+
 // HandleHealth returns data about the health of myself.
 // output example:
 //  {"JobCount":2,"NumGoroutines":11,"HeapAllocatedBytes":332256360,"HeapAllocatedMB":316,
@@ -30,6 +48,36 @@ func (app *App) HandleHealth() fiber.Handler {
 		hab := m.Alloc
 		smb := m.Sys
 
+		var decoderStats manchester.DecoderStats
+		var rejectedFrames, droppedFrames, syncTimeouts uint64
+		var status dlbusStatus
+		var channels channelFills
+		var lineStats raspberry.LineStats
+		var publishers *publisherStatus
+		if app.publishers != nil {
+			s := app.publishers.status()
+			publishers = &s
+		}
+		app.bus.Lock()
+		if app.decoder != nil {
+			decoderStats = app.decoder.Stats()
+			channels.Decoder = app.decoder.Fill()
+		}
+		if app.gpio != nil {
+			channels.Gpio = app.gpio.Fill()
+			lineStats = app.gpio.Stats()
+		}
+		if app.dlbus != nil {
+			rejectedFrames = app.dlbus.Rejected()
+			droppedFrames = app.dlbus.Dropped()
+			syncTimeouts = app.dlbus.SyncTimeouts()
+			status.Synchronized, status.LastFrame, status.Frames = app.dlbus.Status()
+			if !status.LastFrame.IsZero() {
+				status.LastFrameAge = time.Since(status.LastFrame).Round(time.Millisecond).String()
+			}
+		}
+		app.bus.Unlock()
+
 		healthData := struct {
 			NumGoroutines      int
 			NumCPU             int
@@ -41,6 +89,15 @@ func (app *App) HandleHealth() fiber.Handler {
 			ProgLang           string
 			HostName           string
 			Time               string
+			Decoder            manchester.DecoderStats
+			History            historyUsage
+			RejectedFrames     uint64
+			DroppedFrames      uint64
+			SyncTimeouts       uint64
+			DLbus              dlbusStatus
+			Channels           channelFills
+			Gpio               raspberry.LineStats
+			Publishers         *publisherStatus `json:",omitempty"`
 		}{
 			NumGoroutines:      runtime.NumGoroutine(),
 			NumCPU:             runtime.NumCPU(),
@@ -52,6 +109,15 @@ func (app *App) HandleHealth() fiber.Handler {
 			Version:            VERSION,
 			HostName:           host,
 			Time:               time.Now().Format(time.RFC3339),
+			Decoder:            decoderStats,
+			History:            app.history.usage(),
+			RejectedFrames:     rejectedFrames,
+			DroppedFrames:      droppedFrames,
+			SyncTimeouts:       syncTimeouts,
+			DLbus:              status,
+			Channels:           channels,
+			Gpio:               lineStats,
+			Publishers:         publishers,
 		}
 		ctx.Status(http.StatusOK)
 		return ctx.JSON(healthData)
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tadl/pkg/manchester"
+	"tadl/pkg/port"
+	"tadl/pkg/raspberry"
+)
+
+func TestHealthIntervals(t *testing.T) {
+	app, _ := newTestApp(t, "uvr42")
+	app.web.Get("/health", app.HandleHealth())
+
+	events := make(chan port.Event, 3)
+	d, err := manchester.NewWithOptions(events, manchester.WithFixedClock(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.decoder = d
+
+	// sync (interval 2), mid-bit (interval 3), other (invalid)
+	events <- port.Event{Timestamp: 20 * time.Millisecond, Type: port.FallingEdge}
+	events <- port.Event{Timestamp: 40 * time.Millisecond, Type: port.RisingEdge}
+	events <- port.Event{Timestamp: 100 * time.Millisecond, Type: port.FallingEdge}
+	for deadline := time.Now().Add(time.Second); d.Stats().IntervalOther == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("events aren't decoded")
+		}
+	}
+
+	resp, err := app.web.Test(httptest.NewRequest("GET", "/health", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var health struct {
+		Decoder manchester.DecoderStats
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	want := manchester.DecoderStats{Bits: 1, Invalid: 1, Resyncs: 1, Interval2: 1, Interval3: 1, IntervalOther: 1}
+	if health.Decoder != want {
+		t.Errorf("got decoder stats %+v, want %+v", health.Decoder, want)
+	}
+}
+
+func TestHealthChannels(t *testing.T) {
+	app, _ := newTestApp(t, "uvr42")
+	app.web.Get("/health", app.HandleHealth())
+
+	chip := raspberry.NewMockChip()
+	line, err := chip.NewLine(4, "none", 0, raspberry.WithBuffer(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer line.Close()
+	d, err := manchester.NewWithOptions(line.C, manchester.WithFixedClock(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.gpio, app.decoder = line, d
+
+	// channels returns the channel fills reported by /health
+	channels := func() channelFills {
+		t.Helper()
+
+		resp, err := app.web.Test(httptest.NewRequest("GET", "/health", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var health struct {
+			Channels channelFills
+		}
+		if err = json.NewDecoder(resp.Body).Decode(&health); err != nil {
+			t.Fatal(err)
+		}
+		return health.Channels
+	}
+
+	// push sends n edges of alternating bits (interval 2), each edge is decoded as a bit after the sync edge
+	ts := time.Duration(0)
+	typ := port.FallingEdge
+	push := func(n int) {
+		for i := 0; i < n; i++ {
+			ts += 20 * time.Millisecond
+			chip.Line(4).Push(port.Event{Timestamp: ts, Type: typ})
+			typ = port.RisingEdge + port.FallingEdge - typ
+		}
+	}
+	// waitIdle waits until the decoder doesn't consume any more events
+	waitIdle := func() {
+		for last := -1; len(line.C) != last; time.Sleep(20 * time.Millisecond) {
+			last = len(line.C)
+		}
+	}
+
+	// the bits aren't consumed from the decoder (stalled dl-bus reader)
+	push(21)
+	waitIdle()
+	first := channels()
+	if first.Decoder.Current != 20 || first.Decoder.Capacity != cap(d.C) || first.Gpio.Current != 0 || first.Gpio.Capacity != 64 {
+		t.Fatalf("got channels %+v, want 20 bits in the decoder channel and an empty gpio channel", first)
+	}
+
+	// the full decoder channel backs up the gpio channel, the edges are pushed in batches within the gpio buffer
+	for i := 0; i < 3; i++ {
+		push(40)
+		waitIdle()
+	}
+	second := channels()
+	if second.Decoder.Current != cap(d.C) || second.Gpio.Current <= first.Gpio.Current {
+		t.Errorf("got channels %+v, want a full decoder channel and an increased gpio depth", second)
+	}
+	if second.Decoder.Peak < second.Decoder.Current || second.Gpio.Peak < second.Gpio.Current {
+		t.Errorf("got channels %+v, want peaks of at least the current depth", second)
+	}
+
+	// the peak remains after the consumer resumes
+	for len(d.C) > 0 {
+		<-d.C
+	}
+	waitIdle()
+	if third := channels(); third.Decoder.Peak != cap(d.C) || third.Gpio.Peak != second.Gpio.Peak {
+		t.Errorf("got channels %+v after draining, want the peaks %v %v", third, cap(d.C), second.Gpio.Peak)
+	}
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"time"
+
+	"github.com/womat/debug"
+)
+
+// heartbeat is the message of the heartbeat topic <topic>/heartbeat (see mqtt.heartbeat).
+//  LastFrame is the time stamp of the last received data frame (zero time, if no frame is received yet),
+//  so a watchdog detects both a stalled logger (missing heartbeat) and a stalled dl-bus (old LastFrame).
+type heartbeat struct {
+	TimeStamp time.Time
+	LastFrame time.Time
+}
+
+// runHeartbeat publishes a heartbeat periodically, independent of the change detection of the data frames.
+//  The heartbeat isn't retained, a retained heartbeat would be delivered to a watchdog after the logger is dead.
+func (app *App) runHeartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var t time.Time
+		select {
+		case t = <-ticker.C:
+		case <-app.ctx.Done():
+			return
+		}
+
+		_, last := app.LatestFrame()
+
+		app.bus.Lock()
+		topic := app.config.MQTT.Topic + "/heartbeat"
+		app.bus.Unlock()
+
+		m, err := newMessage(topic, heartbeat{TimeStamp: t, LastFrame: last}, false, app.timeFormat)
+		if err != nil {
+			debug.ErrorLog.Printf("heartbeat marshal: %v", err)
+			continue
+		}
+		m.Retained = false
+
+		app.publish(m, false)
+	}
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// historyEntry is a data frame of the history with the receive time.
+type historyEntry struct {
+	time  time.Time
+	frame interface{}
+}
+
+// history is a bounded ring buffer of the last read data frames,
+// bounded by the count of frames and by the memory budget, which is shared with the watchpoint trace.
+// If the buffer is full or the budget is exhausted, the oldest frames are evicted (FIFO).
+type history struct {
+	sync.Mutex
+	// entries is the ring buffer.
+	entries []historyEntry
+	// start is the index of the oldest entry.
+	start int
+	// count is the current count of entries.
+	count int
+	// budget is the memory budget of the entries.
+	budget *memoryBudget
+	// bytes is the current memory usage of the entries.
+	bytes int
+	// evictions is the count of evicted entries.
+	evictions uint64
+}
+
+// historyUsage contains the current usage of the history.
+type historyUsage struct {
+	Frames    int
+	Bytes     int
+	MaxBytes  int
+	Evictions uint64
+}
+
+// newHistory returns a ring buffer with the given size, the memory usage of the entries is bounded by the budget.
+func newHistory(size int, budget *memoryBudget) *history {
+	return &history{entries: make([]historyEntry, size), budget: budget}
+}
+
+// add adds a data frame to the history, if the buffer is full or the budget is exhausted the oldest frames are evicted.
+// The frame is dropped, if the budget is exhausted without any entry (e.g. used by the watchpoint trace).
+func (h *history) add(t time.Time, frame interface{}) {
+	h.Lock()
+	defer h.Unlock()
+
+	if len(h.entries) == 0 {
+		return
+	}
+
+	if h.count == len(h.entries) {
+		h.evict()
+	}
+
+	size := entrySize(frame)
+	for !h.budget.reserve(size) {
+		if h.count == 0 {
+			return
+		}
+		h.evict()
+	}
+
+	h.entries[(h.start+h.count)%len(h.entries)] = historyEntry{time: t, frame: frame}
+	h.count++
+	h.bytes += size
+}
+
+// evict drops the oldest entry.
+func (h *history) evict() {
+	size := entrySize(h.entries[h.start].frame)
+	h.bytes -= size
+	h.budget.release(size)
+	h.entries[h.start] = historyEntry{}
+	h.start = (h.start + 1) % len(h.entries)
+	h.count--
+	h.evictions++
+}
+
+// since returns all data frames received after t, ordered from the oldest to the newest frame.
+func (h *history) since(t time.Time) []historyEntry {
+	h.Lock()
+	defer h.Unlock()
+
+	entries := make([]historyEntry, 0, h.count)
+	for i := 0; i < h.count; i++ {
+		if e := h.entries[(h.start+i)%len(h.entries)]; e.time.After(t) {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// usage returns the current usage of the history.
+func (h *history) usage() historyUsage {
+	h.Lock()
+	defer h.Unlock()
+
+	_, max := h.budget.usage()
+	return historyUsage{Frames: h.count, Bytes: h.bytes, MaxBytes: max, Evictions: h.evictions}
+}
+
+// entrySize returns the estimated memory usage of a history entry.
+func entrySize(frame interface{}) int {
+	size := int(reflect.TypeOf(historyEntry{}).Size())
+	if frame != nil {
+		size += int(reflect.TypeOf(frame).Size())
+	}
+	return size
+}
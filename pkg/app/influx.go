@@ -0,0 +1,206 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/womat/debug"
+)
+
+// influxMeasurement is the measurement of the InfluxDB line protocol.
+const influxMeasurement = "tadl"
+
+// influxTimeout is the timeout of a write request to the InfluxDB.
+const influxTimeout = 10 * time.Second
+
+// influxWriter writes the data frames as InfluxDB line protocol to the write api of an InfluxDB (see influxdb.url).
+// The lines are buffered and written in batches by the flush interval, a failed batch is written again with the next batch.
+// If the buffer is full (e.g. InfluxDB is down), the oldest lines are dropped.
+type influxWriter struct {
+	sync.Mutex
+	// url is the write api, e.g. http://localhost:8086/api/v2/write?org=home&bucket=tadl
+	url string
+	// token is the api token of the InfluxDB, the empty token writes without authentication.
+	token string
+	// host is the host tag of the lines.
+	host string
+	// client is the http client of the write requests.
+	client *http.Client
+	// lines contains the buffered lines.
+	lines []string
+	// maxLines is the maximum count of buffered lines.
+	maxLines int
+	// dropped is the count of dropped lines.
+	dropped uint64
+	// quit stops the flushing.
+	quit chan struct{}
+	// closeOnce guarantees that quit is closed only once.
+	closeOnce sync.Once
+}
+
+// newInfluxWriter returns the writer of the write api url and flushes the buffered lines every interval.
+func newInfluxWriter(url, token, host string, interval time.Duration, maxLines int) *influxWriter {
+	w := &influxWriter{
+		url:      url,
+		token:    token,
+		host:     host,
+		client:   &http.Client{Timeout: influxTimeout},
+		maxLines: maxLines,
+		quit:     make(chan struct{}),
+	}
+
+	go w.run(interval)
+	return w
+}
+
+// add buffers the data frame d as line, frames without values (e.g. RawFrame) are ignored.
+func (w *influxWriter) add(d interface{}) {
+	l := influxLine(d, w.host)
+	if l == "" {
+		return
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	w.lines = append(w.lines, l)
+	if n := len(w.lines) - w.maxLines; n > 0 {
+		w.lines = w.lines[n:]
+		w.dropped += uint64(n)
+		debug.WarningLog.Printf("influxdb buffer is full, %v lines dropped", w.dropped)
+	}
+}
+
+// run flushes the buffered lines every interval, until the writer is closed.
+func (w *influxWriter) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.flush(); err != nil {
+				debug.ErrorLog.Printf("can't write to influxdb: %v", err)
+			}
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+// flush writes the buffered lines, the lines are kept if the write fails.
+//  Rejected lines (400 Bad Request) are dropped, they would be rejected again.
+func (w *influxWriter) flush() error {
+	w.Lock()
+	lines := w.lines
+	w.lines = nil
+	w.Unlock()
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	err := w.write(lines)
+	var rejected influxRejectedError
+	switch {
+	case errors.As(err, &rejected):
+		w.Lock()
+		w.dropped += uint64(len(lines))
+		w.Unlock()
+		return err
+	case err != nil:
+		// keep the lines for the next batch, newer lines are appended
+		w.Lock()
+		w.lines = append(lines, w.lines...)
+		if n := len(w.lines) - w.maxLines; n > 0 {
+			w.lines = w.lines[n:]
+			w.dropped += uint64(n)
+		}
+		w.Unlock()
+		return err
+	}
+	return nil
+}
+
+// influxRejectedError is returned by write, if the InfluxDB rejects the lines (400 Bad Request).
+type influxRejectedError struct {
+	message string
+}
+
+// Error returns the message incl. the response of the InfluxDB.
+func (e influxRejectedError) Error() string {
+	return "influxdb rejected the lines: " + e.message
+}
+
+// write sends the lines to the write api.
+func (w *influxWriter) write(lines []string) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Token "+w.token)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusBadRequest {
+			return influxRejectedError{message: string(bytes.TrimSpace(b))}
+		}
+		return fmt.Errorf("%v: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return nil
+}
+
+// Close stops the flushing and writes the buffered lines.
+func (w *influxWriter) Close() error {
+	w.closeOnce.Do(func() { close(w.quit) })
+	return w.flush()
+}
+
+// influxLine returns the data frame d as line of the InfluxDB line protocol, e.g.
+//  tadl,device=uvr42,host=pi temperature1=45.5,temperature2=38,temperature3=21.5,temperature4=60,out1=true,out2=false 1636275600000000000
+// The empty string is returned for a data frame without values.
+func influxLine(d interface{}, host string) string {
+	t, o := frameValues(d)
+	if len(t) == 0 && len(o) == 0 {
+		return ""
+	}
+
+	fields := make([]string, 0, len(t)+len(o))
+	for i, v := range t {
+		fields = append(fields, "temperature"+strconv.Itoa(i+1)+"="+strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	for i, v := range o {
+		fields = append(fields, "out"+strconv.Itoa(i+1)+"="+strconv.FormatBool(v))
+	}
+
+	tags := influxMeasurement + ",device=" + influxEscape(frameDevice(d))
+	if host != "" {
+		tags += ",host=" + influxEscape(host)
+	}
+
+	return tags + " " + strings.Join(fields, ",") + " " + strconv.FormatInt(frameTime(d).UnixNano(), 10)
+}
+
+// influxEscaper escapes the special characters of a tag value.
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// influxEscape returns the escaped tag value s.
+func influxEscape(s string) string {
+	return influxEscaper.Replace(s)
+}
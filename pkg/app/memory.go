@@ -0,0 +1,46 @@
+package app
+
+import (
+	"sync"
+)
+
+// memoryBudget is the max (estimated) memory usage shared by the buffers of the app
+// (frame history and watchpoint trace), see history.maxmemory.
+type memoryBudget struct {
+	sync.Mutex
+	// max is the max memory usage in bytes, 0 means unlimited.
+	max int
+	// used is the current memory usage in bytes.
+	used int
+}
+
+// newMemoryBudget returns a memory budget of max bytes (0: unlimited).
+func newMemoryBudget(max int) *memoryBudget {
+	return &memoryBudget{max: max}
+}
+
+// reserve reserves n bytes, false is returned if the budget would be exceeded.
+func (m *memoryBudget) reserve(n int) bool {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.max > 0 && m.used+n > m.max {
+		return false
+	}
+	m.used += n
+	return true
+}
+
+// release releases n reserved bytes.
+func (m *memoryBudget) release(n int) {
+	m.Lock()
+	defer m.Unlock()
+	m.used -= n
+}
+
+// usage returns the current memory usage and the max memory usage in bytes.
+func (m *memoryBudget) usage() (used, max int) {
+	m.Lock()
+	defer m.Unlock()
+	return m.used, m.max
+}
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tadl/pkg/datalogger"
+	"tadl/pkg/port"
+)
+
+func TestHistoryEviction(t *testing.T) {
+	f := datalogger.UVR42Frame{}
+	size := entrySize(f)
+
+	// the budget holds 3 frames
+	h := newHistory(10, newMemoryBudget(3*size))
+	t0 := time.Now()
+	for i := 0; i < 5; i++ {
+		f.Temperature1 = float64(i)
+		h.add(t0.Add(time.Duration(i)*time.Second), f)
+	}
+
+	u := h.usage()
+	if u.Frames != 3 || u.Bytes != 3*size || u.MaxBytes != 3*size || u.Evictions != 2 {
+		t.Errorf("got usage %+v, want 3 frames %v bytes 2 evictions", u, 3*size)
+	}
+
+	// the oldest frames are evicted
+	entries := h.since(time.Time{})
+	if len(entries) != 3 || entries[0].frame.(datalogger.UVR42Frame).Temperature1 != 2 {
+		t.Errorf("got entries %+v, want the frames 2..4", entries)
+	}
+}
+
+func TestHistorySizeEviction(t *testing.T) {
+	m := newMemoryBudget(0)
+	h := newHistory(2, m)
+	for i := 0; i < 5; i++ {
+		h.add(time.Now(), datalogger.UVR42Frame{})
+	}
+
+	if u := h.usage(); u.Frames != 2 || u.Evictions != 3 {
+		t.Errorf("got usage %+v, want 2 frames 3 evictions", u)
+	}
+	if used, _ := m.usage(); used != 2*entrySize(datalogger.UVR42Frame{}) {
+		t.Errorf("got used memory %v, want the memory of 2 frames", used)
+	}
+}
+
+func TestSharedMemoryBudget(t *testing.T) {
+	size := entrySize(datalogger.UVR42Frame{})
+	m := newMemoryBudget(2*size + 4*eventSize)
+
+	h := newHistory(10, m)
+	h.add(time.Now(), datalogger.UVR42Frame{})
+	h.add(time.Now(), datalogger.UVR42Frame{})
+
+	file := filepath.Join(t.TempDir(), "trace.csv")
+	w, err := newWatchpoint("out1 == 1", file, 100, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 6; i++ {
+		w.add(port.Event{Timestamp: time.Duration(i), Type: port.RisingEdge})
+	}
+
+	// the trace doesn't grow beyond the budget left by the history, the oldest edges are overwritten
+	if events, bytes, evictions := w.usage(); events != 4 || bytes != 4*eventSize || evictions != 2 {
+		t.Errorf("got trace usage %v events %v bytes %v evictions, want 4 %v 2", events, bytes, evictions, 4*eventSize)
+	}
+	if used, max := m.usage(); used != max {
+		t.Errorf("got used memory %v, want %v", used, max)
+	}
+
+	// the history evicts its own frames to stay within the budget
+	h.add(time.Now(), datalogger.UVR42Frame{})
+	if u := h.usage(); u.Frames != 2 || u.Evictions != 1 {
+		t.Errorf("got history usage %+v, want 2 frames 1 eviction", u)
+	}
+
+	if err = w.write(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(b)); strings.Join(got, " ") != "3,rising 4,rising 5,rising 6,rising" {
+		t.Errorf("got trace %q, want the edges 3..6", got)
+	}
+}
+
+func TestMemoryBudgetExhausted(t *testing.T) {
+	m := newMemoryBudget(eventSize)
+	if !m.reserve(eventSize) {
+		t.Fatal("can't reserve the budget")
+	}
+
+	// the history can't evict frames reserved by others, the frame is dropped
+	h := newHistory(10, m)
+	h.add(time.Now(), datalogger.UVR42Frame{})
+	if u := h.usage(); u.Frames != 0 {
+		t.Errorf("got %v frames, want 0", u.Frames)
+	}
+
+	m.release(eventSize)
+	if used, _ := m.usage(); used != 0 {
+		t.Errorf("got used memory %v after release, want 0", used)
+	}
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"tadl/pkg/datalogger"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/womat/debug"
+)
+
+// HandleMetrics returns the last data frame of the controller in the prometheus text exposition format.
+// Only the temperatures in °C are tadl_temperature_celsius, the values of other sensor types (e.g. flow) and
+// other temperature units are tadl_input with the unit label. A configured label of the sensor is added as label.
+// output example:
+//  tadl_temperature_celsius{sensor="1",label="collector"} 21.5
+//  tadl_input{sensor="2",unit="l/h"} 480
+//  tadl_output{output="1"} 1
+func (app *App) HandleMetrics() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		debug.DebugLog.Print("web request metrics")
+
+		f, _ := app.LatestFrame()
+		values, outputs := frameValues(f)
+		app.bus.Lock()
+		configured, _, labels := app.deviceInputs(frameDevice(f))
+		app.bus.Unlock()
+		types, unit := frameInputs(f, configured)
+
+		var b, inputs strings.Builder
+		b.WriteString("# HELP tadl_temperature_celsius Temperature of the sensor in degree celsius.\n")
+		b.WriteString("# TYPE tadl_temperature_celsius gauge\n")
+		for i, v := range values {
+			l := fmt.Sprintf("sensor=\"%d\"", i+1)
+			if i < len(labels) && labels[i] != "" {
+				l += fmt.Sprintf(",label=%q", labels[i])
+			}
+
+			if u := types[i].Unit(unit); u != datalogger.Celsius.Symbol() {
+				fmt.Fprintf(&inputs, "tadl_input{%s,unit=\"%s\"} %v\n", l, u, v)
+				continue
+			}
+			fmt.Fprintf(&b, "tadl_temperature_celsius{%s} %v\n", l, v)
+		}
+
+		if inputs.Len() > 0 {
+			b.WriteString("# HELP tadl_input Value of the sensor, which isn't a temperature in degree celsius.\n")
+			b.WriteString("# TYPE tadl_input gauge\n")
+			b.WriteString(inputs.String())
+		}
+
+		b.WriteString("# HELP tadl_output State of the output (0: off, 1: on).\n")
+		b.WriteString("# TYPE tadl_output gauge\n")
+		for i, o := range outputs {
+			v := 0
+			if o {
+				v = 1
+			}
+			fmt.Fprintf(&b, "tadl_output{output=\"%d\"} %v\n", i+1, v)
+		}
+
+		u := app.history.usage()
+		b.WriteString("# HELP tadl_history_bytes Estimated memory usage of the frame history.\n")
+		b.WriteString("# TYPE tadl_history_bytes gauge\n")
+		fmt.Fprintf(&b, "tadl_history_bytes %v\n", u.Bytes)
+		b.WriteString("# HELP tadl_history_evictions_total Count of frames evicted from the frame history.\n")
+		b.WriteString("# TYPE tadl_history_evictions_total counter\n")
+		fmt.Fprintf(&b, "tadl_history_evictions_total %v\n", u.Evictions)
+
+		if app.watchpoint != nil {
+			_, bytes, evictions := app.watchpoint.usage()
+			b.WriteString("# HELP tadl_watchpoint_bytes Estimated memory usage of the watchpoint trace.\n")
+			b.WriteString("# TYPE tadl_watchpoint_bytes gauge\n")
+			fmt.Fprintf(&b, "tadl_watchpoint_bytes %v\n", bytes)
+			b.WriteString("# HELP tadl_watchpoint_evictions_total Count of edges evicted from the watchpoint trace.\n")
+			b.WriteString("# TYPE tadl_watchpoint_evictions_total counter\n")
+			fmt.Fprintf(&b, "tadl_watchpoint_evictions_total %v\n", evictions)
+		}
+
+		used, max := app.memory.usage()
+		b.WriteString("# HELP tadl_memory_bytes Estimated memory usage of the history and the watchpoint trace.\n")
+		b.WriteString("# TYPE tadl_memory_bytes gauge\n")
+		fmt.Fprintf(&b, "tadl_memory_bytes %v\n", used)
+		b.WriteString("# HELP tadl_memory_max_bytes Max memory usage of the history and the watchpoint trace (0: unlimited).\n")
+		b.WriteString("# TYPE tadl_memory_max_bytes gauge\n")
+		fmt.Fprintf(&b, "tadl_memory_max_bytes %v\n", max)
+
+		app.bus.Lock()
+		if app.dlbus != nil {
+			b.WriteString("# HELP tadl_dlbus_sync_timeouts_total Count of dl-bus resyncs, because no frame was received in time.\n")
+			b.WriteString("# TYPE tadl_dlbus_sync_timeouts_total counter\n")
+			fmt.Fprintf(&b, "tadl_dlbus_sync_timeouts_total %v\n", app.dlbus.SyncTimeouts())
+		}
+		app.bus.Unlock()
+
+		ctx.Set(fiber.HeaderContentType, "text/plain; version=0.0.4")
+		return ctx.SendString(b.String())
+	}
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tadl/pkg/datalogger"
+)
+
+// getMetrics returns the response of the metrics endpoint.
+func getMetrics(t *testing.T, app *App) string {
+	t.Helper()
+
+	app.web.Get("/metrics", app.HandleMetrics())
+	resp, err := app.web.Test(httptest.NewRequest("GET", "/metrics", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// assertLines checks that all lines are contained in the metrics and none of the missing lines.
+func assertLines(t *testing.T, metrics string, lines, missing []string) {
+	t.Helper()
+
+	got := map[string]bool{}
+	for _, l := range strings.Split(metrics, "\n") {
+		got[l] = true
+	}
+	for _, l := range lines {
+		if !got[l] {
+			t.Errorf("missing line %q in metrics:\n%s", l, metrics)
+		}
+	}
+	for _, l := range missing {
+		if got[l] {
+			t.Errorf("unexpected line %q in metrics", l)
+		}
+	}
+}
+
+func TestMetricsUVR42(t *testing.T) {
+	app, _ := newTestApp(t, "uvr42")
+	app.setLatestFrame(datalogger.UVR42Frame{
+		TimeStamp: time.Now(), Temperature1: 21.5, Temperature2: -3.5, Temperature3: 60, Temperature4: 45,
+		Out2: true, Outputs: 2, Unit: datalogger.Celsius,
+	})
+
+	assertLines(t, getMetrics(t, app), []string{
+		"# TYPE tadl_temperature_celsius gauge",
+		`tadl_temperature_celsius{sensor="1"} 21.5`,
+		`tadl_temperature_celsius{sensor="2"} -3.5`,
+		`tadl_temperature_celsius{sensor="3"} 60`,
+		`tadl_temperature_celsius{sensor="4"} 45`,
+		"# TYPE tadl_output gauge",
+		`tadl_output{output="1"} 0`,
+		`tadl_output{output="2"} 1`,
+	}, []string{"# TYPE tadl_input gauge"})
+}
+
+func TestMetricsInputTypes(t *testing.T) {
+	app, _ := newTestApp(t, "uvr42")
+	app.config.DataLogger.InputTypes = []string{"none", "flow"}
+	app.setLatestFrame(datalogger.UVR42Frame{
+		TimeStamp: time.Now(), Temperature1: 21.5, Temperature2: 480, Temperature3: 800, Temperature4: 1,
+		SensorTypes: []datalogger.SensorType{datalogger.SensorTemperature, datalogger.SensorNone,
+			datalogger.SensorRadiation, datalogger.SensorDigital},
+		Unit: datalogger.Celsius,
+	})
+
+	assertLines(t, getMetrics(t, app), []string{
+		`tadl_temperature_celsius{sensor="1"} 21.5`,
+		"# TYPE tadl_input gauge",
+		`tadl_input{sensor="2",unit="l/h"} 480`,
+		`tadl_input{sensor="3",unit="W/m²"} 800`,
+		`tadl_input{sensor="4",unit=""} 1`,
+	}, []string{
+		`tadl_temperature_celsius{sensor="2"} 480`,
+		`tadl_temperature_celsius{sensor="3"} 800`,
+		`tadl_temperature_celsius{sensor="4"} 1`,
+	})
+}
+
+func TestMetricsUnit(t *testing.T) {
+	app, _ := newTestApp(t, "uvr31")
+	app.setLatestFrame(datalogger.UVR31Frame{TimeStamp: time.Now(), Temperature1: 70.5, Unit: datalogger.Fahrenheit})
+
+	assertLines(t, getMetrics(t, app), []string{
+		`tadl_input{sensor="1",unit="°F"} 70.5`,
+	}, []string{
+		`tadl_temperature_celsius{sensor="1"} 70.5`,
+	})
+}
+
+func TestMetricsLabels(t *testing.T) {
+	app, _ := newTestApp(t, "uvr42")
+	app.config.DataLogger.InputTypes = []string{"none", "flow"}
+	app.config.DataLogger.Labels = []string{"collector", "solar \"flow\""}
+	app.setLatestFrame(datalogger.UVR42Frame{TimeStamp: time.Now(), Temperature1: 80, Temperature2: 240, Temperature3: 45})
+
+	assertLines(t, getMetrics(t, app), []string{
+		`tadl_temperature_celsius{sensor="1",label="collector"} 80`,
+		`tadl_input{sensor="2",label="solar \"flow\"",unit="l/h"} 240`,
+		`tadl_temperature_celsius{sensor="3"} 45`,
+	}, nil)
+}
@@ -0,0 +1,57 @@
+package app
+
+// quality tracks the decoding results of the last frames,
+// to withhold data frames while the dl-bus is only marginally locked.
+type quality struct {
+	// maxErrorRate is the max allowed error rate (0..1), 0 disables the check.
+	maxErrorRate float64
+	// results is a ring buffer of the last decoding results (true: error).
+	results []bool
+	// next is the index of the next result.
+	next int
+	// count is the current count of results.
+	count int
+}
+
+// newQuality returns a quality tracker over the last window frames.
+func newQuality(maxErrorRate float64, window int) *quality {
+	return &quality{maxErrorRate: maxErrorRate, results: make([]bool, window)}
+}
+
+// add adds a decoding result.
+func (q *quality) add(failed bool) {
+	if len(q.results) == 0 {
+		return
+	}
+
+	q.results[q.next] = failed
+	q.next = (q.next + 1) % len(q.results)
+	if q.count < len(q.results) {
+		q.count++
+	}
+}
+
+// errorRate returns the error rate of the last frames.
+func (q *quality) errorRate() float64 {
+	if q.count == 0 {
+		return 0
+	}
+
+	errors := 0
+	for i := 0; i < q.count; i++ {
+		if q.results[i] {
+			errors++
+		}
+	}
+
+	return float64(errors) / float64(q.count)
+}
+
+// confident returns true if the bus is locked and the error rate is below maxErrorRate.
+func (q *quality) confident(locked bool) bool {
+	if q.maxErrorRate == 0 {
+		return true
+	}
+
+	return locked && q.errorRate() < q.maxErrorRate
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"tadl/pkg/datalogger"
+	"tadl/pkg/manchester"
+	"tadl/pkg/port"
+)
+
+func TestQuality(t *testing.T) {
+	q := newQuality(0.5, 4)
+	if !q.confident(true) || q.confident(false) {
+		t.Error("got confidence without results, want confident only if locked")
+	}
+
+	tests := []struct {
+		failed    bool
+		confident bool
+	}{
+		{true, false},  // 1/1
+		{true, false},  // 2/2
+		{false, false}, // 2/3
+		{false, false}, // 2/4
+		{false, true},  // 1/4, the first error is dropped
+		{false, true},  // 0/4
+		{true, true},   // 1/4
+	}
+	for i, tt := range tests {
+		q.add(tt.failed)
+		if got := q.confident(true); got != tt.confident {
+			t.Errorf("result %v: got confident %v (error rate %v), want %v", i, got, q.errorRate(), tt.confident)
+		}
+	}
+
+	if q := newQuality(0, 4); !q.confident(false) {
+		t.Error("got no confidence with a disabled error rate, want confident")
+	}
+}
+
+// stubDL is a data logger, which returns the scripted data frames and errors.
+type stubDL struct {
+	frames []interface{}
+}
+
+func (s *stubDL) Connect(io.ReadCloser) error { return nil }
+func (s *stubDL) Restart() error              { return nil }
+func (s *stubDL) Close() error                { return nil }
+
+func (s *stubDL) Get() (interface{}, error) {
+	if len(s.frames) == 0 {
+		return nil, io.EOF
+	}
+
+	f := s.frames[0]
+	s.frames = s.frames[1:]
+	if err, ok := f.(error); ok {
+		return nil, err
+	}
+	return f, nil
+}
+
+func TestReceiveQuality(t *testing.T) {
+	app, _ := newTestApp(t, "uvr42")
+	app.median = newMedianFilter(0)
+	app.quality = newQuality(0.5, 4)
+
+	events := make(chan port.Event, 1)
+	d, err := manchester.NewWithOptions(events, manchester.WithFixedClock(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.decoder = d
+
+	errInvalid := errors.New("invalid temperature")
+	frame := func(v float64) datalogger.UVR42Frame {
+		return datalogger.UVR42Frame{TimeStamp: time.Now(), Temperature1: v}
+	}
+	app.dl = &stubDL{frames: []interface{}{frame(0), errInvalid, errInvalid, frame(1), frame(2), frame(3), frame(4)}}
+
+	// stored returns the temperature of the stored data frame, -1 if no data frame is stored
+	stored := func() float64 {
+		f, err := app.receivedFrame()
+		if err != nil {
+			return -1
+		}
+		return f.(datalogger.UVR42Frame).Temperature1
+	}
+
+	// the frame of the unlocked bus is withheld
+	if !app.receive() || stored() != -1 {
+		t.Fatalf("got stored temperature %v of the unlocked bus, want withheld", stored())
+	}
+
+	// the decoder is locked by a bit edge of the fixed clock
+	events <- port.Event{Timestamp: 20 * time.Millisecond, Type: port.FallingEdge}
+	for deadline := time.Now().Add(time.Second); !d.Locked(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("decoder isn't locked")
+		}
+	}
+
+	// error rate (incl. the unlocked frame): 1/2, 2/3, 2/4, 2/4 (withheld), 1/4 (stored), 0/4
+	for i, want := range []float64{-1, -1, -1, -1, 3, 4} {
+		if !app.receive() {
+			t.Fatalf("receive %v: got no data frame", i)
+		}
+		if got := stored(); got != want {
+			t.Errorf("receive %v: got stored temperature %v, want %v", i, got, want)
+		}
+	}
+	if app.receive() {
+		t.Error("got data frame, want none")
+	}
+}
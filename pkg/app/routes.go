@@ -13,5 +13,18 @@ func (app *App) initDefaultRoutes() {
 	}
 	if app.config.Webserver.Webservices["data"] {
 		api.Get("/data", app.HandleData())
+		api.Get("/data/stats", app.HandleStats())
+	}
+	if app.config.Webserver.Webservices["history"] {
+		api.Get("/history", app.HandleHistory())
+	}
+	if app.config.Webserver.Webservices["export"] {
+		api.Get("/export.csv", app.HandleExport())
+	}
+	if app.config.Webserver.Webservices["metrics"] {
+		api.Get("/metrics", app.HandleMetrics())
+	}
+	if app.config.Webserver.Webservices["test"] {
+		api.Post("/test/frame", app.HandleTestFrame())
 	}
 }
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/womat/debug"
+)
+
+// dayFormat is the format of the day of the accumulated on-time of today.
+const dayFormat = "2006-01-02"
+
+// runtimeMeter accumulates the on-time of the outputs of each device (today and total).
+// The on-time is computed from the output states and the timestamps of consecutive data frames.
+// The totals are saved to the state file (runtime.file) and restored at startup.
+type runtimeMeter struct {
+	sync.Mutex
+	// file is the state file, the value "" disables the persistence.
+	file string
+	// outputs contains the runtime of the outputs per device (see frameDevice).
+	outputs map[string][]outputRuntime
+}
+
+// outputRuntime is the accumulated on-time of an output.
+type outputRuntime struct {
+	// Day is the day of Today (dayFormat).
+	Day   string
+	Today time.Duration
+	Total time.Duration
+	// on is the output state of the last data frame.
+	on bool
+	// last is the timestamp of the last data frame.
+	last time.Time
+}
+
+// runtimeStatus is the accumulated on-time of an output in seconds.
+// output example:
+//  {"Output":1,"Today":3600,"Total":864000}
+type runtimeStatus struct {
+	Output int
+	Today  float64
+	Total  float64
+}
+
+// newRuntimeMeter returns a runtime meter with the totals of the state file file (if it exists).
+func newRuntimeMeter(file string) (*runtimeMeter, error) {
+	r := &runtimeMeter{file: file, outputs: map[string][]outputRuntime{}}
+	if file == "" {
+		return r, nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &r.outputs); err != nil {
+		return nil, fmt.Errorf("invalid runtime file %q: %w", file, err)
+	}
+	return r, nil
+}
+
+// update accumulates the on-time of the outputs of the data frame.
+// The interval to the previous data frame of the device is added, if the output was on.
+func (r *runtimeMeter) update(d interface{}) {
+	device := frameDevice(d)
+	_, outputs := frameValues(d)
+	ts := frameTime(d)
+
+	r.Lock()
+	defer r.Unlock()
+
+	rs := r.outputs[device]
+	for len(rs) < len(outputs) {
+		rs = append(rs, outputRuntime{})
+	}
+
+	var turnedOff bool
+	for i, o := range outputs {
+		if rs[i].on && !rs[i].last.IsZero() && ts.After(rs[i].last) {
+			rs[i].add(rs[i].last, ts)
+		}
+		turnedOff = turnedOff || (rs[i].on && !o)
+		rs[i].on, rs[i].last = o, ts
+	}
+	r.outputs[device] = rs
+
+	if turnedOff {
+		r.save()
+	}
+}
+
+// add adds the on-time from..to, the on-time of today starts at midnight.
+func (o *outputRuntime) add(from, to time.Time) {
+	o.Total += to.Sub(from)
+
+	if day := to.Format(dayFormat); day != o.Day {
+		o.Day, o.Today = day, 0
+		if midnight := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, to.Location()); from.Before(midnight) {
+			from = midnight
+		}
+	}
+	o.Today += to.Sub(from)
+}
+
+// status returns the accumulated on-time of the outputs of the device.
+func (r *runtimeMeter) status(device string) []runtimeStatus {
+	r.Lock()
+	defer r.Unlock()
+
+	today := time.Now().Format(dayFormat)
+	s := make([]runtimeStatus, len(r.outputs[device]))
+	for i, o := range r.outputs[device] {
+		s[i] = runtimeStatus{Output: i + 1, Total: o.Total.Seconds()}
+		if o.Day == today {
+			s[i].Today = o.Today.Seconds()
+		}
+	}
+	return s
+}
+
+// Close saves the totals to the state file.
+func (r *runtimeMeter) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	return r.save()
+}
+
+// save writes the totals to the state file, the caller must lock the runtime meter.
+func (r *runtimeMeter) save() error {
+	if r.file == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(r.outputs)
+	if err != nil {
+		return err
+	}
+
+	// write a temporary file and rename it, so a crash can't destroy the state file
+	tmp := r.file + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		debug.ErrorLog.Printf("can't write runtime file: %v", err)
+		return err
+	}
+	if err = os.Rename(tmp, r.file); err != nil {
+		debug.ErrorLog.Printf("can't write runtime file: %v", err)
+		return err
+	}
+	return nil
+}
+
+// publishRuntime sends the on-time of the outputs of the data frame to <topic>/out<n>/runtime (see runtime.enabled).
+//  The config must be locked by the caller.
+func (app *App) publishRuntime(d interface{}) {
+	for _, s := range app.runtime.status(frameDevice(d)) {
+		app.sendMQTT(fmt.Sprintf("%v/out%d/runtime", app.topic(d), s.Output), s)
+	}
+}
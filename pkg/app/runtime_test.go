@@ -0,0 +1,133 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tadl/pkg/datalogger"
+)
+
+// runtimeFrames returns uvr42 frames of the output states, the frames are sent one minute after midnight (today).
+//  The on-time is 150 s of Out1 and 90 s of Out2.
+func runtimeFrames() []datalogger.UVR42Frame {
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 1, 0, 0, now.Location())
+
+	frames := []struct {
+		at         time.Duration
+		out1, out2 bool
+	}{
+		{0, true, false},
+		{60 * time.Second, true, true},
+		{90 * time.Second, false, true},
+		{150 * time.Second, false, false},
+		{200 * time.Second, true, false},
+		{260 * time.Second, true, false},
+	}
+
+	var f []datalogger.UVR42Frame
+	for _, s := range frames {
+		f = append(f, datalogger.UVR42Frame{TimeStamp: start.Add(s.at), Out1: s.out1, Out2: s.out2})
+	}
+	return f
+}
+
+func TestRuntimeMeter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "runtime.json")
+	r, err := newRuntimeMeter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range runtimeFrames() {
+		r.update(f)
+	}
+
+	want := []runtimeStatus{{Output: 1, Today: 150, Total: 150}, {Output: 2, Today: 90, Total: 90}}
+	got := r.status("uvr42")
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got runtime %+v, want %+v", got, want)
+	}
+	if s := r.status("uvr31"); len(s) != 0 {
+		t.Errorf("got runtime %+v of a device without frames, want none", s)
+	}
+
+	// the totals are restored from the state file
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = newRuntimeMeter(file); err != nil {
+		t.Fatal(err)
+	}
+	if got = r.status("uvr42"); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got restored runtime %+v, want %+v", got, want)
+	}
+}
+
+func TestRuntimeMidnight(t *testing.T) {
+	midnight := time.Date(2021, 11, 7, 0, 0, 0, 0, time.UTC)
+
+	var o outputRuntime
+	o.add(midnight.Add(-time.Minute), midnight.Add(time.Minute))
+	if o.Day != "2021-11-07" || o.Today != time.Minute || o.Total != 2*time.Minute {
+		t.Errorf("got runtime %+v, want today 1m0s of 2021-11-07 and total 2m0s", o)
+	}
+
+	// the on-time of today is reset on the next day
+	o.add(midnight.Add(24*time.Hour-time.Minute), midnight.Add(24*time.Hour+30*time.Second))
+	if o.Day != "2021-11-08" || o.Today != 30*time.Second || o.Total != 3*time.Minute+30*time.Second {
+		t.Errorf("got runtime %+v, want today 30s of 2021-11-08 and total 3m30s", o)
+	}
+}
+
+func TestPublishRuntime(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	app.runtime, _ = newRuntimeMeter("")
+	app.web.Get("/data", app.HandleData())
+
+	for _, f := range runtimeFrames() {
+		app.store(f)
+	}
+
+	// the published runtime of the outputs after the last frame, the messages are published concurrently (unordered)
+	for topic, want := range map[string]runtimeStatus{
+		"tadl/out1/runtime": {Output: 1, Today: 150, Total: 150},
+		"tadl/out2/runtime": {Output: 2, Today: 90, Total: 90},
+	} {
+		published := func() bool {
+			for _, m := range topicMessages(b, topic) {
+				var got runtimeStatus
+				if err := json.Unmarshal(m.Payload, &got); err != nil {
+					t.Fatalf("invalid json payload %s: %v", m.Payload, err)
+				}
+				if got == want {
+					return true
+				}
+			}
+			return false
+		}
+		for deadline := time.Now().Add(time.Second); !published(); time.Sleep(5 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("got no runtime %+v of topic %v", want, topic)
+			}
+		}
+	}
+
+	resp, err := app.web.Test(httptest.NewRequest("GET", "/data", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Runtime []runtimeStatus
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Runtime) != 2 || data.Runtime[0].Total != 150 || data.Runtime[1].Total != 90 {
+		t.Errorf("got runtime %+v of /data, want the totals 150 and 90", data.Runtime)
+	}
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"math/rand"
+	"time"
+
+	"tadl/pkg/datalogger"
+
+	"github.com/womat/debug"
+)
+
+// profiles contains the frame profile of each device (as used for datalogger.type).
+var profiles = map[string]datalogger.Profile{
+	"uvr42":   datalogger.UVR42Profile,
+	"uvr31":   datalogger.UVR31Profile,
+	"uvr1611": datalogger.UVR1611Profile,
+	"raw":     datalogger.RawProfile,
+}
+
+// schema describes the fields of the data frames of a device, to let mqtt subscribers self-configure.
+// The names of the fields are the names of the frame values, the elements of an array are numbered from 1
+// (e.g. Inputs1, HeatMeters1.Power). An optional field may be missing in the frame.
+// output example:
+//  {"Device":"uvr42","Fields":[{"Name":"Temperature1","Type":"analog","Unit":"°C","Label":"collector"},{"Name":"Out1","Type":"digital"}]}
+type schema struct {
+	Device string
+	Fields []schemaField
+}
+
+// schemaField describes a field of a data frame.
+type schemaField struct {
+	Name     string
+	Type     string
+	Unit     string `json:",omitempty"`
+	Label    string `json:",omitempty"`
+	Optional bool   `json:",omitempty"`
+}
+
+// newSchema derives the schema of a device from its frame profile.
+// The inputs are analog fields in the order of the profile, the unit of an input is derived from its
+// sensor type (types) and the unit of the temperatures, labels are the labels of the inputs.
+func newSchema(device string, p datalogger.Profile, types []datalogger.SensorType, unit datalogger.Unit, labels []string) schema {
+	s := schema{Device: device, Fields: []schemaField{}}
+	input := 0
+	for _, f := range p.Fields {
+		field := schemaField{Name: f.Name, Type: f.Kind.String(), Unit: f.Unit, Optional: f.Optional}
+		if f.Kind == datalogger.Input {
+			field.Type = datalogger.Analog.String()
+			t := datalogger.SensorNone
+			if input < len(types) {
+				t = types[input]
+			}
+			field.Unit = t.Unit(unit)
+			if input < len(labels) {
+				field.Label = labels[input]
+			}
+			input++
+		}
+		s.Fields = append(s.Fields, field)
+	}
+	return s
+}
+
+// publishSchema publishes the retained schema message <topic>/schema of each device, which can be received.
+// On a shared dl-bus (datalogger type auto), the schema of each decoded device is published to <topic>/<device>/schema.
+// The config must be locked by the caller.
+func (app *App) publishSchema() {
+	for device, p := range profiles {
+		if t := app.config.DataLogger.Type; t != device && (t != "auto" || device == "raw") {
+			continue
+		}
+
+		debug.DebugLog.Printf("publish schema of %v", device)
+		types, unit, labels := app.deviceInputs(device)
+		app.sendMQTT(app.deviceTopic(device)+"/schema", newSchema(device, p, types, unit, labels))
+	}
+}
+
+// connected signals a (re)connect to the mqtt broker to runOnConnect, it's called by the mqtt handler and doesn't block.
+//  A connect is dropped, if the last connect isn't handled yet.
+func (app *App) connected() {
+	select {
+	case app.connects <- struct{}{}:
+	default:
+	}
+}
+
+// runOnConnect publishes the messages of a new mqtt connection after each (re)connect (see publishOnConnect),
+// until the root context is done.
+func (app *App) runOnConnect() {
+	for {
+		select {
+		case <-app.connects:
+			app.bus.Lock()
+			j := app.config.MQTT.ConnectJitter
+			app.bus.Unlock()
+
+			app.publishOnConnect(j)
+		case <-app.ctx.Done():
+			return
+		}
+	}
+}
+
+// publishOnConnect publishes the messages of a new mqtt connection (schema) after a random delay up to maxJitter,
+// to spread the load of the broker, if many instances reconnect simultaneously.
+func (app *App) publishOnConnect(maxJitter time.Duration) {
+	if d := jitter(maxJitter); d > 0 {
+		debug.DebugLog.Printf("delay the publishing on connect by %v", d)
+		select {
+		case <-time.After(d):
+		case <-app.ctx.Done():
+			return
+		}
+	}
+
+	app.bus.Lock()
+	defer app.bus.Unlock()
+	app.publishSchema()
+}
+
+// jitter returns a random duration within [0, max].
+//  It's a variable to be able to inject a fixed delay (e.g. in tests).
+var jitter = func(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.New(rand.NewSource(time.Now().UnixNano())).Int63n(int64(max) + 1))
+}
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"tadl/pkg/datalogger"
+)
+
+func TestSchemaMessage(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	app.config.DataLogger.InputTypes = []string{"none", "flow"}
+	app.config.DataLogger.Labels = []string{"collector", "storage", "return"}
+	app.config.DataLogger.Unit = "K"
+
+	app.publishSchema()
+
+	m := waitMessages(t, b, "tadl/schema", 1)[0]
+	if !m.Retained {
+		t.Error("the schema message isn't retained")
+	}
+
+	var got schema
+	if err := json.Unmarshal(m.Payload, &got); err != nil {
+		t.Fatalf("invalid json schema %s: %v", m.Payload, err)
+	}
+	want := schema{Device: "uvr42", Fields: []schemaField{
+		{Name: "TimeStamp", Type: "time"},
+		{Name: "Temperature1", Type: "analog", Unit: "K", Label: "collector"},
+		{Name: "Temperature2", Type: "analog", Unit: "l/h", Label: "storage"},
+		{Name: "Temperature3", Type: "analog", Unit: "K", Label: "return"},
+		{Name: "Temperature4", Type: "analog", Unit: "K"},
+		{Name: "Out1", Type: "digital"},
+		{Name: "Out2", Type: "digital"},
+		{Name: "Outputs", Type: "unsigned"},
+		{Name: "RotationSpeed", Type: "unsigned", Optional: true},
+		{Name: "SensorTypes1", Type: "text", Optional: true},
+		{Name: "SensorTypes2", Type: "text", Optional: true},
+		{Name: "SensorTypes3", Type: "text", Optional: true},
+		{Name: "SensorTypes4", Type: "text", Optional: true},
+		{Name: "Unit", Type: "text", Optional: true},
+		{Name: "Synthetic", Type: "digital", Optional: true},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got schema %+v, want %+v", got, want)
+	}
+}
+
+func TestSchemaDefaultUnit(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	app.publishSchema()
+
+	var got schema
+	if err := json.Unmarshal(waitMessages(t, b, "tadl/schema", 1)[0].Payload, &got); err != nil {
+		t.Fatal(err)
+	}
+	if f := got.Fields[1]; f.Unit != "°C" || f.Label != "" {
+		t.Errorf("got field %+v, want unit °C without label", f)
+	}
+}
+
+func TestSchemaAuto(t *testing.T) {
+	app, b := newTestApp(t, "auto")
+	app.config.DataLogger.Labels = []string{"collector"}
+	app.publishSchema()
+
+	var got schema
+	if err := json.Unmarshal(waitMessages(t, b, "tadl/uvr42/schema", 1)[0].Payload, &got); err != nil {
+		t.Fatal(err)
+	}
+	// the labels aren't used by the datalogger type auto
+	if f := got.Fields[1]; f.Unit != "°C" || f.Label != "" {
+		t.Errorf("got field %+v, want unit °C without label", f)
+	}
+
+	// the schema of each decoded device is published, the raw frames aren't decoded by the type auto
+	waitMessages(t, b, "tadl/uvr31/schema", 1)
+	waitMessages(t, b, "tadl/uvr1611/schema", 1)
+	if m := topicMessages(b, "tadl/raw/schema"); len(m) != 0 {
+		t.Errorf("got %v raw schema messages, want none", len(m))
+	}
+}
+
+func TestSchemaFrameFields(t *testing.T) {
+	speed := 12
+	// the frames contain all optional fields
+	tests := []struct {
+		device string
+		frame  interface{}
+	}{
+		{"uvr42", datalogger.UVR42Frame{RotationSpeed: &speed, SensorTypes: make([]datalogger.SensorType, 4), Unit: datalogger.Celsius, Synthetic: true}},
+		{"uvr31", datalogger.UVR31Frame{Unit: datalogger.Celsius, Synthetic: true}},
+		{"uvr1611", datalogger.UVR1611Frame{Unit: datalogger.Celsius, Synthetic: true}},
+		{"raw", datalogger.RawFrame{Synthetic: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.device, func(t *testing.T) {
+			p, ok := profiles[tt.device]
+			if !ok {
+				t.Fatalf("no profile of device %v", tt.device)
+			}
+			if err := p.Validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			// the schema describes each value of the frame in the order of the frame
+			var want []string
+			flatten(reflect.ValueOf(tt.frame), "", func(name, _ string) { want = append(want, name) })
+			var got []string
+			for _, f := range newSchema(tt.device, p, nil, datalogger.Celsius, nil).Fields {
+				got = append(got, f.Name)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got schema fields %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSchemaOnConnect(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	app.goRun(app.runOnConnect)
+
+	// each (re)connect publishes the schema again
+	app.connected()
+	waitMessages(t, b, "tadl/schema", 1)
+	app.connected()
+	waitMessages(t, b, "tadl/schema", 2)
+}
+
+func TestJitter(t *testing.T) {
+	if d := jitter(0); d != 0 {
+		t.Errorf("got jitter %v without max, want 0", d)
+	}
+	for i := 0; i < 100; i++ {
+		if d := jitter(10 * time.Millisecond); d < 0 || d > 10*time.Millisecond {
+			t.Fatalf("got jitter %v, want 0..10ms", d)
+		}
+	}
+}
+
+func TestConnectJitter(t *testing.T) {
+	const delay = 100 * time.Millisecond
+
+	max := make(chan time.Duration, 2)
+	defer func(j func(time.Duration) time.Duration) { jitter = j }(jitter)
+	jitter = func(m time.Duration) time.Duration {
+		max <- m
+		return m
+	}
+
+	app, b := newTestApp(t, "uvr42")
+	app.config.MQTT.ConnectJitter = delay
+	app.goRun(app.runOnConnect)
+
+	// the jitter is applied to each connect before the schema is published
+	for n := 1; n <= 2; n++ {
+		start := time.Now()
+		app.connected()
+		waitMessages(t, b, "tadl/schema", n)
+
+		if d := time.Since(start); d < delay {
+			t.Errorf("connect %v: schema published after %v, want the jitter delay %v", n, d, delay)
+		}
+		if m := <-max; m != delay {
+			t.Errorf("connect %v: got max jitter %v, want %v", n, m, delay)
+		}
+	}
+}
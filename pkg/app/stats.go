@@ -0,0 +1,92 @@
+package app
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/womat/debug"
+)
+
+// sensorStats contains the aggregated temperatures of a sensor of a device (see frameDevice).
+type sensorStats struct {
+	Device string
+	Sensor int
+	Min    float64
+	Max    float64
+	Avg    float64
+}
+
+// HandleStats returns min/max/avg of the temperatures over the time range of the in-memory history,
+// e.g. /data/stats?range=1h (default: 1h).
+func (app *App) HandleStats() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		debug.DebugLog.Print("web request stats")
+
+		r, err := time.ParseDuration(ctx.Query("range", "1h"))
+		if err != nil || r <= 0 {
+			ctx.Status(http.StatusBadRequest)
+			return ctx.JSON(fiber.Map{"error": "invalid range"})
+		}
+
+		entries := app.history.since(time.Now().Add(-r))
+
+		return ctx.JSON(struct {
+			Range        string
+			Count        int
+			Temperatures []sensorStats
+		}{
+			Range:        r.String(),
+			Count:        len(entries),
+			Temperatures: calcStats(entries),
+		})
+	}
+}
+
+// calcStats calculates min/max/avg per device and temperature sensor of the history entries,
+// so the sensors of different devices (datalogger type auto) aren't merged.
+// The stats are ordered by device and sensor.
+func calcStats(entries []historyEntry) []sensorStats {
+	type key struct {
+		device string
+		sensor int
+	}
+	stats := map[key]*sensorStats{}
+	count := map[key]int{}
+
+	for _, e := range entries {
+		t, _ := frameValues(e.frame)
+		device := frameDevice(e.frame)
+
+		for i, v := range t {
+			k := key{device: device, sensor: i + 1}
+			s, ok := stats[k]
+			if !ok {
+				s = &sensorStats{Device: device, Sensor: i + 1, Min: math.Inf(1), Max: math.Inf(-1)}
+				stats[k] = s
+			}
+
+			s.Min = math.Min(s.Min, v)
+			s.Max = math.Max(s.Max, v)
+			s.Avg += v
+			count[k]++
+		}
+	}
+
+	list := make([]sensorStats, 0, len(stats))
+	for k, s := range stats {
+		s.Avg /= float64(count[k])
+		list = append(list, *s)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Device != list[j].Device {
+			return list[i].Device < list[j].Device
+		}
+		return list[i].Sensor < list[j].Sensor
+	})
+
+	return list
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"tadl/pkg/datalogger"
+)
+
+func TestCalcStats(t *testing.T) {
+	now := time.Now()
+	var in1, in2 [16]float64
+	in1[0], in2[0] = 60, 70
+
+	entries := []historyEntry{
+		{time: now, frame: datalogger.UVR42Frame{Temperature1: 20, Temperature2: 30}},
+		{time: now, frame: datalogger.UVR1611Frame{Inputs: in1}},
+		{time: now, frame: datalogger.UVR42Frame{Temperature1: 22, Temperature2: 40}},
+		{time: now, frame: datalogger.UVR1611Frame{Inputs: in2}},
+	}
+
+	stats := calcStats(entries)
+	if len(stats) != 4+16 {
+		t.Fatalf("got %v sensor stats, want 20", len(stats))
+	}
+
+	// the sensors of the devices aren't merged, uvr1611 is ordered before uvr42
+	want := map[int]sensorStats{
+		0:  {Device: "uvr1611", Sensor: 1, Min: 60, Max: 70, Avg: 65},
+		16: {Device: "uvr42", Sensor: 1, Min: 20, Max: 22, Avg: 21},
+		17: {Device: "uvr42", Sensor: 2, Min: 30, Max: 40, Avg: 35},
+	}
+	for i, w := range want {
+		if stats[i] != w {
+			t.Errorf("got stats[%v] %+v, want %+v", i, stats[i], w)
+		}
+	}
+}
+
+func TestCalcStatsEmpty(t *testing.T) {
+	if stats := calcStats(nil); stats == nil || len(stats) != 0 {
+		t.Errorf("got %#v, want an empty list (json [])", stats)
+	}
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"tadl/pkg/datalogger"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/womat/debug"
+)
+
+// HandleTestFrame injects a synthetic data frame (json body) to test the output path without a controller,
+// e.g. POST /test/frame?device=uvr42 (default: datalogger.type, the device is required by the datalogger type auto).
+//  The frame is stored and published as a received data frame, but it's flagged as synthetic.
+//  The request must be authorized by the token (webserver.token).
+func (app *App) HandleTestFrame() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		debug.DebugLog.Print("web request test frame")
+
+		app.bus.Lock()
+		defer app.bus.Unlock()
+
+		if !app.authorized(ctx) {
+			ctx.Status(http.StatusUnauthorized)
+			return ctx.JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		device := ctx.Query("device", app.config.DataLogger.Type)
+		if device == "auto" {
+			ctx.Status(http.StatusBadRequest)
+			return ctx.JSON(fiber.Map{"error": "device is required by the datalogger type auto, e.g. ?device=uvr42"})
+		}
+
+		f, err := syntheticFrame(device, ctx.Body())
+		if err != nil {
+			ctx.Status(http.StatusBadRequest)
+			return ctx.JSON(fiber.Map{"error": err.Error()})
+		}
+
+		debug.InfoLog.Printf("synthetic frame: %v", f)
+		app.store(f)
+		return ctx.JSON(f)
+	}
+}
+
+// authorized returns true, if the request contains the bearer token (webserver.token).
+//  Without a configured token, no request is authorized. The config must be locked by the caller.
+func (app *App) authorized(ctx *fiber.Ctx) bool {
+	token := app.config.Webserver.Token
+	if token == "" {
+		return false
+	}
+
+	got := strings.TrimPrefix(ctx.Get(fiber.HeaderAuthorization), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// syntheticFrame decodes the json data frame b of the device and flags it as synthetic.
+//  A missing timestamp is set to the current time.
+func syntheticFrame(device string, b []byte) (interface{}, error) {
+	var err error
+	switch device {
+	case "uvr42":
+		var f datalogger.UVR42Frame
+		err = json.Unmarshal(b, &f)
+		f.TimeStamp, f.Synthetic = timestamp(f.TimeStamp), true
+		return f, err
+	case "uvr31":
+		var f datalogger.UVR31Frame
+		err = json.Unmarshal(b, &f)
+		f.TimeStamp, f.Synthetic = timestamp(f.TimeStamp), true
+		return f, err
+	case "uvr1611":
+		var f datalogger.UVR1611Frame
+		err = json.Unmarshal(b, &f)
+		f.TimeStamp, f.Synthetic = timestamp(f.TimeStamp), true
+		return f, err
+	case "raw":
+		var f datalogger.RawFrame
+		err = json.Unmarshal(b, &f)
+		f.TimeStamp, f.Synthetic = timestamp(f.TimeStamp), true
+		return f, err
+	}
+
+	return nil, fmt.Errorf("unsupported device: %q", device)
+}
+
+// timestamp returns t or the current time, if t is zero.
+func timestamp(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tadl/pkg/datalogger"
+)
+
+func TestHandleTestFrame(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	app.config.Webserver.Token = "secret"
+	app.web.Post("/test/frame", app.HandleTestFrame())
+	app.web.Get("/data", app.HandleData())
+
+	post := func(token, query, body string) int {
+		t.Helper()
+
+		req := httptest.NewRequest("POST", "/test/frame"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := app.web.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	const frame = `{"Temperature1":45.5,"Out1":true,"Outputs":1}`
+	for _, token := range []string{"", "wrong"} {
+		if got := post(token, "", frame); got != http.StatusUnauthorized {
+			t.Errorf("got status %v of token %q, want %v", got, token, http.StatusUnauthorized)
+		}
+	}
+	if got := post("secret", "?device=uvr64", frame); got != http.StatusBadRequest {
+		t.Errorf("got status %v of an unsupported device, want %v", got, http.StatusBadRequest)
+	}
+	if got := post("secret", "", "{"); got != http.StatusBadRequest {
+		t.Errorf("got status %v of an invalid frame, want %v", got, http.StatusBadRequest)
+	}
+	if m := b.Messages(); len(m) != 0 {
+		t.Fatalf("got published messages %+v of rejected frames, want none", m)
+	}
+
+	if got := post("secret", "", frame); got != http.StatusOK {
+		t.Fatalf("got status %v, want %v", got, http.StatusOK)
+	}
+
+	// the synthetic frame is published ...
+	var published datalogger.UVR42Frame
+	m := waitMessages(t, b, "tadl", 1)[0]
+	if err := json.Unmarshal(m.Payload, &published); err != nil {
+		t.Fatalf("invalid json payload %s: %v", m.Payload, err)
+	}
+	if !published.Synthetic || published.Temperature1 != 45.5 || !published.Out1 || published.TimeStamp.IsZero() {
+		t.Errorf("got published frame %+v, want the synthetic frame", published)
+	}
+
+	// ... and stored as latest frame
+	resp, err := app.web.Test(httptest.NewRequest("GET", "/data", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var data datalogger.UVR42Frame
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		t.Fatal(err)
+	}
+	if !data.Synthetic || data.Temperature1 != 45.5 || !data.TimeStamp.Equal(published.TimeStamp) {
+		t.Errorf("got data %+v, want the synthetic frame %+v", data, published)
+	}
+}
+
+func TestHandleTestFrameWithoutToken(t *testing.T) {
+	app, b := newTestApp(t, "uvr42")
+	app.web.Post("/test/frame", app.HandleTestFrame())
+
+	// without a configured token, no request is authorized, even with an empty bearer token
+	req := httptest.NewRequest("POST", "/test/frame", strings.NewReader(`{"Temperature1":45.5}`))
+	req.Header.Set("Authorization", "Bearer ")
+	resp, err := app.web.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || len(b.Messages()) != 0 {
+		t.Errorf("got status %v and %v messages, want %v and none", resp.StatusCode, len(b.Messages()), http.StatusUnauthorized)
+	}
+}
+
+func TestHandleTestFrameAuto(t *testing.T) {
+	app, b := newTestApp(t, "auto")
+	app.config.Webserver.Token = "secret"
+	app.web.Post("/test/frame", app.HandleTestFrame())
+
+	post := func(query string) (int, string) {
+		t.Helper()
+
+		req := httptest.NewRequest("POST", "/test/frame"+query, strings.NewReader(`{"Temperature1":45.5}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := app.web.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var body struct{ Error string }
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body.Error
+	}
+
+	// the device of a shared dl-bus isn't known without the query
+	if got, msg := post(""); got != http.StatusBadRequest || !strings.Contains(msg, "device is required") {
+		t.Errorf("got status %v (%q) without device, want %v and device is required", got, msg, http.StatusBadRequest)
+	}
+
+	if got, msg := post("?device=uvr42"); got != http.StatusOK {
+		t.Fatalf("got status %v (%q), want %v", got, msg, http.StatusOK)
+	}
+	var f datalogger.UVR42Frame
+	if err := json.Unmarshal(waitMessages(t, b, "tadl/uvr42", 1)[0].Payload, &f); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Synthetic || f.Temperature1 != 45.5 {
+		t.Errorf("got published frame %+v, want the synthetic frame", f)
+	}
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeFormat is the format of the time stamps of the mqtt messages (see mqtt.timeformat and mqtt.timezone).
+//  The zero value keeps the default json format (RFC 3339 with nanoseconds in the location of the time stamp).
+type timeFormat struct {
+	// layout is the layout of time.Format, it's ignored if unix is set.
+	layout string
+	// unix is the resolution of the unix time stamp (time.Second or time.Millisecond), 0 formats by layout.
+	unix time.Duration
+	// location is the time zone of the time stamps, nil keeps the location of the time stamp.
+	location *time.Location
+}
+
+// newTimeFormat returns the time format of the format name and the time zone.
+//  rfc3339:     2021-11-07T10:00:00+01:00
+//  rfc3339nano: 2021-11-07T10:00:00.123456789+01:00 (default)
+//  unix:        1636275600 (seconds since 1970-01-01 UTC, the time zone is ignored)
+//  unixms:      1636275600123 (milliseconds since 1970-01-01 UTC)
+//  any other format is a layout of time.Format, e.g. "2006-01-02 15:04:05"
+// The zone is the name of the time zone, e.g. UTC, Local or Europe/Vienna, the value "" keeps the zone of the time stamp.
+func newTimeFormat(format, zone string) (timeFormat, error) {
+	var f timeFormat
+
+	switch strings.ToLower(format) {
+	case "", "rfc3339nano":
+		f.layout = time.RFC3339Nano
+	case "rfc3339":
+		f.layout = time.RFC3339
+	case "unix":
+		f.unix = time.Second
+	case "unixms":
+		f.unix = time.Millisecond
+	default:
+		// a layout without any element of the reference time would format every time stamp to the same text
+		if probe := time.Date(1999, 12, 31, 23, 58, 59, 0, time.UTC); probe.Format(format) == format {
+			return f, fmt.Errorf("invalid time format: %q", format)
+		}
+		f.layout = format
+	}
+
+	if zone != "" {
+		l, err := time.LoadLocation(zone)
+		if err != nil {
+			return f, fmt.Errorf("invalid time zone %q: %w", zone, err)
+		}
+		f.location = l
+	}
+
+	return f, nil
+}
+
+// isDefault returns true, if the time format is the default json format.
+func (f timeFormat) isDefault() bool {
+	return f.unix == 0 && f.location == nil && (f.layout == "" || f.layout == time.RFC3339Nano)
+}
+
+// format returns the json value of the time stamp t.
+func (f timeFormat) format(t time.Time) []byte {
+	if f.unix > 0 {
+		if t.IsZero() {
+			return []byte("0")
+		}
+		return []byte(strconv.FormatInt(t.UnixNano()/int64(f.unix), 10))
+	}
+
+	// the zero time (e.g. no data frame received yet) isn't converted, it has no reasonable offset in a time zone
+	if f.location != nil && !t.IsZero() {
+		t = t.In(f.location)
+	}
+	layout := f.layout
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	return []byte(strconv.Quote(t.Format(layout)))
+}
+
+// formattedTime is a time stamp, which is marshaled by its time format.
+type formattedTime struct {
+	time.Time
+	f timeFormat
+}
+
+// MarshalJSON encodes the time stamp by the time format.
+func (t formattedTime) MarshalJSON() ([]byte, error) {
+	return t.f.format(t.Time), nil
+}
+
+// timeType and formattedTimeType are the types of the replaced time stamps (see apply).
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	formattedTimeType = reflect.TypeOf(formattedTime{})
+)
+
+// apply returns a copy of the message struct msg, whose time.Time fields are replaced by formatted time stamps.
+//  Only the (exported) fields of the struct itself are replaced, the json tags and the order of the fields are kept.
+//  Other messages (e.g. a struct without time stamps or with embedded fields) are returned unchanged.
+func (f timeFormat) apply(msg interface{}) interface{} {
+	if f.isDefault() {
+		return msg
+	}
+
+	v := reflect.ValueOf(msg)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return msg
+	}
+
+	t := v.Type()
+	fields := make([]reflect.StructField, 0, t.NumField())
+	index := make([]int, 0, t.NumField())
+	times := false
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous {
+			return msg
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if sf.Type == timeType {
+			sf.Type = formattedTimeType
+			times = true
+		}
+		fields = append(fields, sf)
+		index = append(index, i)
+	}
+	if !times {
+		return msg
+	}
+
+	c := reflect.New(reflect.StructOf(fields)).Elem()
+	for i, j := range index {
+		if fields[i].Type == formattedTimeType {
+			c.Field(i).Set(reflect.ValueOf(formattedTime{Time: v.Field(j).Interface().(time.Time), f: f}))
+			continue
+		}
+		c.Field(i).Set(v.Field(j))
+	}
+	return c.Interface()
+}
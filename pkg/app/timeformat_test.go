@@ -0,0 +1,100 @@
+package app
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	// the time zone of the tests doesn't depend on the zoneinfo of the host
+	_ "time/tzdata"
+
+	"tadl/pkg/datalogger"
+)
+
+func TestTimeFormat(t *testing.T) {
+	ts := time.Date(2021, 11, 7, 9, 0, 0, 123456789, time.UTC)
+
+	tests := []struct {
+		format, zone string
+		want         string
+	}{
+		{"", "", `"2021-11-07T09:00:00.123456789Z"`},
+		{"rfc3339nano", "", `"2021-11-07T09:00:00.123456789Z"`},
+		{"RFC3339", "", `"2021-11-07T09:00:00Z"`},
+		{"rfc3339", "Europe/Vienna", `"2021-11-07T10:00:00+01:00"`},
+		{"unix", "", `1636275600`},
+		// the time zone doesn't change a unix time stamp
+		{"unix", "Europe/Vienna", `1636275600`},
+		{"unixms", "", `1636275600123`},
+		{"2006-01-02 15:04:05", "Europe/Vienna", `"2021-11-07 10:00:00"`},
+		{"2006-01-02 15:04:05 MST", "UTC", `"2021-11-07 09:00:00 UTC"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format+" "+tt.zone, func(t *testing.T) {
+			f, err := newTimeFormat(tt.format, tt.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(f.format(ts)); got != tt.want {
+				t.Errorf("got time stamp %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeFormatZero(t *testing.T) {
+	for format, want := range map[string]string{"unix": "0", "rfc3339": `"0001-01-01T00:00:00Z"`} {
+		f, err := newTimeFormat(format, "Europe/Vienna")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(f.format(time.Time{})); got != want {
+			t.Errorf("got zero time stamp %v of format %v, want %v", got, format, want)
+		}
+	}
+}
+
+func TestTimeFormatInvalid(t *testing.T) {
+	for _, tt := range []struct{ format, zone string }{{"iso", ""}, {"rfc3339", "Mars/Olympus"}} {
+		if _, err := newTimeFormat(tt.format, tt.zone); err == nil {
+			t.Errorf("got no error of format %q zone %q, want an error", tt.format, tt.zone)
+		}
+	}
+}
+
+func TestSendMQTTTimeFormat(t *testing.T) {
+	ts := time.Date(2021, 11, 7, 9, 0, 0, 0, time.UTC)
+	f := datalogger.UVR42Frame{TimeStamp: ts, Temperature1: 45.5, Out1: true, Outputs: 1}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"rfc3339", `"2021-11-07T10:00:00+01:00"`},
+		{"unix", `1636275600`},
+		{"unixms", `1636275600000`},
+		{"02.01.2006 15:04", `"07.11.2021 10:00"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			app, b := newTestApp(t, "uvr42")
+			var err error
+			if app.timeFormat, err = newTimeFormat(tt.format, "Europe/Vienna"); err != nil {
+				t.Fatal(err)
+			}
+			app.sendMQTT("tadl", f)
+
+			m := waitMessages(t, b, "tadl", 1)[0]
+			var got map[string]json.RawMessage
+			if err = json.Unmarshal(m.Payload, &got); err != nil {
+				t.Fatalf("invalid json payload %s: %v", m.Payload, err)
+			}
+			if s := string(got["TimeStamp"]); s != tt.want {
+				t.Errorf("got time stamp %v, want %v", s, tt.want)
+			}
+			// the other fields are kept
+			if string(got["Temperature1"]) != "45.5" || string(got["Out1"]) != "true" || string(got["Outputs"]) != "1" {
+				t.Errorf("got payload %s, want the fields of the frame", m.Payload)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"tadl/pkg/port"
+
+	"github.com/womat/debug"
+)
+
+// watchpoint keeps the latest line events (edges) in a ring buffer and writes them to the trace file,
+// when its condition becomes true (e.g. to analyze intermittent faults).
+// The ring buffer grows up to size events, bounded by the memory budget, which is shared with the history.
+// The trace file has the format of the capture file (csv: timestamp in nanoseconds, edge rising|falling).
+//  condition examples:
+//   temperature1 > 90
+//   resync or out2 == 1
+type watchpoint struct {
+	sync.Mutex
+	// condition is the list of clauses, the condition is true if any clause is true.
+	condition []clause
+	// file is the trace file.
+	file string
+	// events is the ring buffer of the latest line events.
+	events []port.Event
+	// size is the max count of events of the ring buffer.
+	size int
+	// budget is the memory budget of the ring buffer.
+	budget *memoryBudget
+	// next is the index of the next event in the ring buffer, if it's full.
+	next int
+	// full is true, if the ring buffer doesn't grow anymore (size or budget reached).
+	full bool
+	// evictions is the count of overwritten (or dropped) events.
+	evictions uint64
+	// triggered is true, while the condition is true (the trace is written only once per trigger).
+	triggered bool
+	// resyncs is the resync count of the decoder at the last check.
+	resyncs uint64
+	// checked is true after the first check (the first synchronization at startup isn't a resync).
+	checked bool
+}
+
+// clause is a single comparison of a condition.
+type clause struct {
+	// resync is true for the clause "resync", which is true, if the decoder synchronized since the last frame.
+	resync bool
+	// output is true for an output (out<n>), false for a value (temperature<n>, input<n>).
+	output bool
+	// index is the index of the value or output (n-1).
+	index int
+	// op is the comparison operator (>, <, >=, <=, ==, !=).
+	op string
+	// threshold is the value to compare with.
+	threshold float64
+}
+
+// newWatchpoint parses the condition and returns a watchpoint with a ring buffer of size events,
+// the memory usage of the events is bounded by the budget.
+func newWatchpoint(condition, file string, size int, budget *memoryBudget) (*watchpoint, error) {
+	c, err := parseCondition(condition)
+	if err != nil {
+		return nil, err
+	}
+
+	debug.InfoLog.Printf("watchpoint armed: %q", condition)
+	return &watchpoint{condition: c, file: file, size: size, budget: budget}, nil
+}
+
+// parseCondition parses the clauses of the condition, which are separated by "or".
+//  clause: resync | <name><n> <op> <value>
+//  name: temperature | input | out, op: > | < | >= | <= | == | !=
+func parseCondition(s string) ([]clause, error) {
+	var clauses []clause
+
+	for _, c := range strings.Split(strings.ToLower(s), " or ") {
+		f := strings.Fields(c)
+		if len(f) == 1 && f[0] == "resync" {
+			clauses = append(clauses, clause{resync: true})
+			continue
+		}
+		if len(f) != 3 {
+			return nil, fmt.Errorf("invalid watchpoint clause: %q", c)
+		}
+
+		var cl clause
+		var name string
+		for _, n := range []string{"temperature", "input", "out"} {
+			if strings.HasPrefix(f[0], n) {
+				name = n
+				break
+			}
+		}
+		i, err := strconv.Atoi(strings.TrimPrefix(f[0], name))
+		if name == "" || err != nil || i < 1 {
+			return nil, fmt.Errorf("invalid watchpoint value: %q", f[0])
+		}
+		cl.output, cl.index = name == "out", i-1
+
+		switch f[1] {
+		case ">", "<", ">=", "<=", "==", "!=":
+			cl.op = f[1]
+		default:
+			return nil, fmt.Errorf("invalid watchpoint operator: %q", f[1])
+		}
+
+		if cl.threshold, err = strconv.ParseFloat(f[2], 64); err != nil {
+			return nil, fmt.Errorf("invalid watchpoint threshold: %q", f[2])
+		}
+		clauses = append(clauses, cl)
+	}
+
+	return clauses, nil
+}
+
+// tap forwards the events of channel in to the returned channel and keeps the events in the ring buffer.
+func (w *watchpoint) tap(in chan port.Event) chan port.Event {
+	out := make(chan port.Event, 100)
+
+	go func() {
+		defer close(out)
+
+		for evt := range in {
+			w.add(evt)
+			out <- evt
+		}
+	}()
+
+	return out
+}
+
+// add adds the event to the ring buffer, the oldest event is overwritten if the ring buffer is full.
+// The event is dropped, if the budget is exhausted without any event (e.g. used by the history).
+func (w *watchpoint) add(evt port.Event) {
+	w.Lock()
+	defer w.Unlock()
+
+	if !w.full {
+		if len(w.events) < w.size && w.budget.reserve(eventSize) {
+			w.events = append(w.events, evt)
+			return
+		}
+		if len(w.events) == 0 {
+			w.evictions++
+			return
+		}
+		w.full = true
+	}
+
+	w.events[w.next] = evt
+	w.next = (w.next + 1) % len(w.events)
+	w.evictions++
+}
+
+// usage returns the count of events, the memory usage of the events and the count of evictions.
+func (w *watchpoint) usage() (events, bytes int, evictions uint64) {
+	w.Lock()
+	defer w.Unlock()
+	return len(w.events), len(w.events) * eventSize, w.evictions
+}
+
+// eventSize is the memory usage of an event of the ring buffer.
+var eventSize = int(reflect.TypeOf(port.Event{}).Size())
+
+// check evaluates the condition with the data frame and the resync count of the decoder,
+// the trace file is written if the condition becomes true.
+func (w *watchpoint) check(d interface{}, resyncs uint64) {
+	w.Lock()
+	defer w.Unlock()
+
+	// a restarted decoder starts counting from 0
+	resynced := w.checked && resyncs > w.resyncs
+	w.resyncs, w.checked = resyncs, true
+
+	values, outputs := frameValues(d)
+	match := false
+	for _, c := range w.condition {
+		match = match || c.match(values, outputs, resynced)
+	}
+
+	if match && !w.triggered {
+		debug.WarningLog.Printf("watchpoint triggered by frame %v, write trace to %q", d, w.file)
+		if err := w.write(); err != nil {
+			debug.ErrorLog.Printf("can't write watchpoint trace: %v", err)
+		}
+	}
+	w.triggered = match
+}
+
+// match returns true, if the clause is true for the values and outputs of a data frame.
+func (c clause) match(values []float64, outputs []bool, resynced bool) bool {
+	if c.resync {
+		return resynced
+	}
+
+	var v float64
+	switch {
+	case c.output && c.index < len(outputs):
+		if outputs[c.index] {
+			v = 1
+		}
+	case !c.output && c.index < len(values):
+		v = values[c.index]
+	default:
+		return false
+	}
+
+	switch c.op {
+	case ">":
+		return v > c.threshold
+	case "<":
+		return v < c.threshold
+	case ">=":
+		return v >= c.threshold
+	case "<=":
+		return v <= c.threshold
+	case "==":
+		return v == c.threshold
+	}
+	return v != c.threshold
+}
+
+// write writes the ring buffer (oldest event first) to the trace file, the lock must be held by the caller.
+func (w *watchpoint) write() error {
+	f, err := os.Create(w.file)
+	if err != nil {
+		return err
+	}
+
+	events := w.events
+	if w.full {
+		events = append(append([]port.Event{}, w.events[w.next:]...), w.events[:w.next]...)
+	}
+
+	b := bufio.NewWriter(f)
+	for _, evt := range events {
+		edge := "rising"
+		if evt.Type == port.FallingEdge {
+			edge = "falling"
+		}
+		if _, err = fmt.Fprintf(b, "%d,%s\n", evt.Timestamp.Nanoseconds(), edge); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+
+	if err = b.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tadl/pkg/datalogger"
+	"tadl/pkg/port"
+)
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		condition string
+		want      []clause
+		err       bool
+	}{
+		{"temperature1 > 90", []clause{{index: 0, op: ">", threshold: 90}}, false},
+		{"Resync or OUT2 == 1", []clause{{resync: true}, {output: true, index: 1, op: "==", threshold: 1}}, false},
+		{"input16 <= -10.5", []clause{{index: 15, op: "<=", threshold: -10.5}}, false},
+		{"temperature0 > 90", nil, true},
+		{"flow1 > 90", nil, true},
+		{"temperature1 => 90", nil, true},
+		{"temperature1 > hot", nil, true},
+		{"temperature1 > 90 and out1 == 1", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			got, err := parseCondition(tt.condition)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got clauses %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got clause %+v, want %+v", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWatchpoint(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "trace.csv")
+	w, err := newWatchpoint("temperature1 > 90 or resync", file, 3, newMemoryBudget(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the edges at 1..5 ms, the ring buffer keeps the window of the latest 3 edges
+	for i := 1; i <= 5; i++ {
+		typ := port.RisingEdge
+		if i%2 == 0 {
+			typ = port.FallingEdge
+		}
+		w.add(port.Event{Timestamp: time.Duration(i) * time.Millisecond, Type: typ})
+	}
+	const window = "3000000,rising\n4000000,falling\n5000000,rising\n"
+
+	// trace returns the trace file and removes it, "" is returned if the trace isn't written
+	trace := func() string {
+		t.Helper()
+
+		b, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			return ""
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Remove(file); err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	checks := []struct {
+		name    string
+		temp    float64
+		resyncs uint64
+		want    string
+	}{
+		// the first synchronization at startup isn't a resync
+		{"startup", 80, 1, ""},
+		{"triggered", 95, 1, window},
+		{"still triggered", 96, 1, ""},
+		{"released", 85, 1, ""},
+		{"resync", 85, 2, window},
+		{"still triggered by the temperature", 95, 2, ""},
+		{"restarted decoder", 80, 0, ""},
+	}
+	for _, c := range checks {
+		w.check(datalogger.UVR42Frame{Temperature1: c.temp}, c.resyncs)
+		if got := trace(); got != c.want {
+			t.Errorf("%v: got trace %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestWatchpointTap(t *testing.T) {
+	w, err := newWatchpoint("out1 == 1", filepath.Join(t.TempDir(), "trace.csv"), 10, newMemoryBudget(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := make(chan port.Event, 2)
+	out := w.tap(in)
+	in <- port.Event{Timestamp: time.Millisecond, Type: port.RisingEdge}
+	in <- port.Event{Timestamp: 2 * time.Millisecond, Type: port.FallingEdge}
+	close(in)
+
+	// the events are forwarded unchanged and kept in the ring buffer
+	var n int
+	for e := range out {
+		if n++; e.Timestamp != time.Duration(n)*time.Millisecond {
+			t.Errorf("got forwarded event %+v, want the event at %vms", e, n)
+		}
+	}
+	if events, _, _ := w.usage(); n != 2 || events != 2 {
+		t.Errorf("got %v forwarded and %v buffered events, want 2", n, events)
+	}
+}
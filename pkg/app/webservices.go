@@ -1,6 +1,12 @@
 package app
 
 import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/womat/debug"
 )
@@ -9,9 +15,11 @@ import (
 //  It's designed to run in a separate go function to not block the main go function.
 //  e.g.: go runWebServer()
 //  See app.Run()
+//  The web server is stopped by Close (the error of the stopped listener isn't logged).
 func (app *App) runWebServer() {
-	err := app.web.Listen(app.urlParsed.Host)
-	debug.ErrorLog.Print(err)
+	if err := app.web.Listen(app.urlParsed.Host); err != nil && app.ctx.Err() == nil {
+		debug.ErrorLog.Print(err)
+	}
 }
 
 // HandleData returns the data frame of the controller.
@@ -19,8 +27,60 @@ func (app *App) HandleData() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		debug.DebugLog.Print("web request data")
 
-		app.DataFrame.Lock()
-		defer app.DataFrame.Unlock()
-		return ctx.JSON(app.DataFrame.data)
+		f, _ := app.LatestFrame()
+		if app.runtime == nil || f == nil {
+			return ctx.JSON(f)
+		}
+
+		// add the on-time of the outputs to the data frame
+		b, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		data := map[string]interface{}{}
+		if err = json.Unmarshal(b, &data); err != nil {
+			return err
+		}
+		data["Runtime"] = app.runtime.status(frameDevice(f))
+		return ctx.JSON(data)
+	}
+}
+
+// HandleHistory returns the data frames of the in-memory history as json array (from the oldest to the newest frame),
+// optionally filtered by the receive time, e.g. /history?since=2021-11-07T10:00:00+01:00 or /history?since=15m.
+func (app *App) HandleHistory() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		debug.DebugLog.Print("web request history")
+
+		since, err := parseSince(ctx.Query("since"))
+		if err != nil {
+			ctx.Status(http.StatusBadRequest)
+			return ctx.JSON(fiber.Map{"error": "invalid since"})
+		}
+
+		entries := app.history.since(since)
+		frames := make([]interface{}, 0, len(entries))
+		for _, e := range entries {
+			frames = append(frames, e.frame)
+		}
+		return ctx.JSON(frames)
+	}
+}
+
+// parseSince parses the since parameter, which is a RFC 3339 time or a duration before now (e.g. 15m).
+//  The empty string returns the zero time (all frames).
+func parseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	// an unescaped + of the zone offset is decoded as space by the query
+	if t, err := time.Parse(time.RFC3339, strings.ReplaceAll(s, " ", "+")); err == nil {
+		return t, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, errors.New("invalid since")
 	}
+	return time.Now().Add(-d), nil
 }
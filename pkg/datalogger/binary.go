@@ -0,0 +1,73 @@
+package datalogger
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// uvr42BinarySize is the size of the binary format of the UVR42Frame.
+const uvr42BinarySize = 15
+
+// noRotationSpeed is the value of the rotation speed in the binary format, if the frame has no rotation speed.
+const noRotationSpeed = 0xff
+
+// MarshalBinary encodes the frame to a compact binary format (e.g. for bandwidth-constrained links):
+//  byte 0:     device id (0x10)
+//  byte 1..4:  timestamp (unix time in seconds, uint32 little endian)
+//  byte 5..12: Temperature1..4 (0.1 °C, int16 little endian)
+//  byte 13:    Outputs (bitmask)
+//  byte 14:    RotationSpeed (0xff: no rotation speed)
+// The sensor types aren't encoded, a frame of another unit than °C (see SetScale) returns ErrUnsupportedUnit.
+func (f UVR42Frame) MarshalBinary() ([]byte, error) {
+	if f.Unit != "" && f.Unit != Celsius {
+		return nil, fmt.Errorf("%w of the binary format: %v", ErrUnsupportedUnit, f.Unit)
+	}
+
+	b := make([]byte, uvr42BinarySize)
+
+	b[0] = uvr42
+	binary.LittleEndian.PutUint32(b[1:5], uint32(f.TimeStamp.Unix()))
+	for i, t := range []float64{f.Temperature1, f.Temperature2, f.Temperature3, f.Temperature4} {
+		binary.LittleEndian.PutUint16(b[5+2*i:7+2*i], uint16(int16(math.Round(t*10))))
+	}
+	b[13] = byte(f.Outputs)
+	b[14] = noRotationSpeed
+	if f.RotationSpeed != nil {
+		b[14] = byte(*f.RotationSpeed)
+	}
+
+	return b, nil
+}
+
+// UnmarshalBinary decodes the binary format of MarshalBinary, it's the decoder for the consumers.
+func (f *UVR42Frame) UnmarshalBinary(b []byte) error {
+	if len(b) != uvr42BinarySize {
+		return ErrInvalidSize
+	}
+
+	if b[0] != uvr42 {
+		return UnsupportedDeviceError{Got: b[0]}
+	}
+
+	*f = UVR42Frame{}
+	f.TimeStamp = time.Unix(int64(binary.LittleEndian.Uint32(b[1:5])), 0)
+
+	var t [4]float64
+	for i := range t {
+		t[i] = float64(int16(binary.LittleEndian.Uint16(b[5+2*i:7+2*i]))) / 10
+	}
+	f.Temperature1, f.Temperature2, f.Temperature3, f.Temperature4 = t[0], t[1], t[2], t[3]
+
+	f.Outputs = uint(b[13])
+	f.Out1 = f.Outputs&1 > 0
+	f.Out2 = f.Outputs&2 > 0
+
+	if b[14] != noRotationSpeed {
+		s := int(b[14])
+		f.RotationSpeed = &s
+	}
+
+	return nil
+}
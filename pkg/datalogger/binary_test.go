@@ -0,0 +1,73 @@
+package datalogger
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUVR42BinaryRoundTrip(t *testing.T) {
+	speed := 20
+	tests := []struct {
+		name string
+		f    UVR42Frame
+	}{
+		{"without rotation speed", UVR42Frame{TimeStamp: time.Unix(1636275600, 0), Temperature1: 45.5, Temperature2: -3.5,
+			Temperature3: 0, Temperature4: 120.1, Out2: true, Outputs: 2}},
+		{"with rotation speed", UVR42Frame{TimeStamp: time.Unix(1636275601, 0), Temperature1: 21, Out1: true, Out2: true,
+			Outputs: 3, RotationSpeed: &speed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.f.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) != uvr42BinarySize || b[0] != uvr42 {
+				t.Fatalf("got binary frame %x, want %v bytes of device %#x", b, uvr42BinarySize, uvr42)
+			}
+
+			var got UVR42Frame
+			if err = got.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			if !got.TimeStamp.Equal(tt.f.TimeStamp) {
+				t.Errorf("got timestamp %v, want %v", got.TimeStamp, tt.f.TimeStamp)
+			}
+			got.TimeStamp = tt.f.TimeStamp
+			if !reflect.DeepEqual(got, tt.f) {
+				t.Errorf("got frame %+v, want %+v", got, tt.f)
+			}
+		})
+	}
+}
+
+func TestUVR42BinaryLayout(t *testing.T) {
+	f := UVR42Frame{TimeStamp: time.Unix(0x61879d10, 0), Temperature1: 45.5, Temperature2: -3.5, Outputs: 1}
+	b, _ := f.MarshalBinary()
+
+	want := []byte{0x10, 0x10, 0x9d, 0x87, 0x61, 0xc7, 0x01, 0xdd, 0xff, 0, 0, 0, 0, 1, 0xff}
+	if !reflect.DeepEqual(b, want) {
+		t.Errorf("got binary frame %x, want %x", b, want)
+	}
+
+	var got UVR42Frame
+	if err := got.UnmarshalBinary(b[:len(b)-1]); !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("got error %v of a short frame, want %v", err, ErrInvalidSize)
+	}
+	b[0] = uvr31
+	if err := got.UnmarshalBinary(b); !errors.Is(err, UnsupportedDeviceError{Got: uvr31}) {
+		t.Errorf("got error %v of an uvr31 frame, want %v", err, UnsupportedDeviceError{Got: uvr31})
+	}
+}
+
+func TestUVR42BinaryUnit(t *testing.T) {
+	// the temperatures are encoded in 0.1 °C
+	if _, err := (UVR42Frame{Temperature1: 45.5, Unit: Celsius}).MarshalBinary(); err != nil {
+		t.Errorf("got error %v of a °C frame, want nil", err)
+	}
+	if _, err := (UVR42Frame{Temperature1: 113.9, Unit: Fahrenheit}).MarshalBinary(); !errors.Is(err, ErrUnsupportedUnit) {
+		t.Errorf("got error %v of a °F frame, want %v", err, ErrUnsupportedUnit)
+	}
+}
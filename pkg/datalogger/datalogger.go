@@ -2,15 +2,37 @@ package datalogger
 
 import (
 	"errors"
+	"fmt"
 	"io"
 )
 
 var (
-	ErrInvalidSize        = errors.New("invalid frame size")
-	ErrInvalidTemperature = errors.New("invalid temperature")
-	ErrUnsupportedDevice  = errors.New("unsupported device id")
+	ErrInvalidSize          = errors.New("invalid frame size")
+	ErrInvalidTemperature   = errors.New("invalid temperature")
+	ErrUnsupportedDevice    = errors.New("unsupported device id")
+	ErrNotConnected         = errors.New("handler not connected")
+	ErrInvalidRotationSpeed = errors.New("invalid rotation speed")
+	ErrInvalidDelta         = errors.New("difference to the last value exceeds max delta")
+	ErrUnsupportedUnit      = errors.New("unsupported unit")
 )
 
+// UnsupportedDeviceError is returned if the device id of the frame isn't supported by the handler.
+// It wraps ErrUnsupportedDevice, so errors.Is(err, ErrUnsupportedDevice) is true.
+type UnsupportedDeviceError struct {
+	// Got is the device id of the frame.
+	Got byte
+}
+
+// Error returns the message incl. the device id.
+func (e UnsupportedDeviceError) Error() string {
+	return fmt.Sprintf("%v: 0x%02x", ErrUnsupportedDevice, e.Got)
+}
+
+// Unwrap returns ErrUnsupportedDevice.
+func (e UnsupportedDeviceError) Unwrap() error {
+	return ErrUnsupportedDevice
+}
+
 // DL is the interface implemented by a data logger type
 type DL interface {
 	// Connect use the defined io.ReadWriterCloser.
@@ -19,17 +41,52 @@ type DL interface {
 	// and checks weather the values of temperature values are valid:
 	//  * the current values are within a temperature range
 	//  * and the difference to the last measured values are less than maxDelta
+	// A handler of several devices (MultiHandler) returns the frame of any device tagged with its device id (DeviceFrame).
 	Get() (interface{}, error)
+	// Restart discards the stale data frames of the handler, the next Get returns a newly received data frame.
+	// The ReadCloser isn't reopened: if it implements Reset() (e.g. dlbus.ReadCloser), Reset is called
+	// to discard the queued frames, otherwise the ReadCloser is kept as it is.
+	Restart() error
 	// Close the handler (ReadCloser).
 	Close() error
 }
 
+// resetter is implemented by a ReadCloser, which can discard its queued data frames.
+type resetter interface {
+	Reset()
+}
+
+// restart discards the queued data frames of the ReadCloser, see DL.Restart.
+func restart(r io.ReadCloser) error {
+	if r == nil {
+		return ErrNotConnected
+	}
+	if r, ok := r.(resetter); ok {
+		r.Reset()
+	}
+	return nil
+}
+
 const (
 	// device Id
-	uvr31 = 0x30
-	uvr42 = 0x10
+	uvr31   = 0x30
+	uvr42   = 0x10
+	uvr1611 = 0x80
 
 	// max temperature range
 	tMax = 300
 	tMin = -50
+
+	// maxSpeedStep is the maximum speed step of an output with speed control
+	maxSpeedStep = 30
 )
+
+// outputMask returns the output states as bitmask, bit 0 is the state of the first output, bit 1 of the second output, etc.
+func outputMask(outputs ...bool) (mask uint) {
+	for i, o := range outputs {
+		if o {
+			mask |= 1 << i
+		}
+	}
+	return mask
+}
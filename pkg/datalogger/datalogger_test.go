@@ -0,0 +1,45 @@
+package datalogger
+
+import (
+	"testing"
+)
+
+func TestOutputMask(t *testing.T) {
+	tests := []struct {
+		outputs []bool
+		want    uint
+	}{
+		{nil, 0},
+		{[]bool{false, false}, 0},
+		{[]bool{true, false}, 1},
+		{[]bool{false, true}, 2},
+		{[]bool{true, true}, 3},
+		{[]bool{true, false, true, false, false, false, false, false, false, false, false, false, true}, 1<<0 | 1<<2 | 1<<12},
+	}
+	for _, tt := range tests {
+		if got := outputMask(tt.outputs...); got != tt.want {
+			t.Errorf("got mask %b of %v, want %b", got, tt.outputs, tt.want)
+		}
+	}
+}
+
+func TestOutputsBitmask(t *testing.T) {
+	// output byte: bit 5 Out1, bit 6 Out2
+	for _, b := range []byte{0, 1 << 5, 1 << 6, 1<<5 | 1<<6, 0x9f} {
+		f, err := decodeUVR42(uvr42Frame(200, 200, 200, 200, b), uvr42Size, false, nil, DefaultScale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Outputs != outputMask(f.Out1, f.Out2) || f.Out1 != (b&(1<<5) > 0) || f.Out2 != (b&(1<<6) > 0) {
+			t.Errorf("uvr42 byte %08b: got Out1 %v Out2 %v Outputs %b", b, f.Out1, f.Out2, f.Outputs)
+		}
+
+		u, err := decodeUVR31([]byte{uvr31, 200, 0, 200, 0, 200, 0, b}, 8, DefaultScale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Outputs != outputMask(u.Out1) || u.Out1 != (b&(1<<5) > 0) {
+			t.Errorf("uvr31 byte %08b: got Out1 %v Outputs %b", b, u.Out1, u.Outputs)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package datalogger
+
+import (
+	"io"
+	"sync"
+)
+
+// MultiHandler is the handler to read the dataframes of several controllers of a shared dl-bus.
+// Each dataframe is dispatched by its device id (first byte) to the registered handler of the device.
+//  Get doesn't return the frame structure of a single controller type (e.g. UVR42Frame),
+//  but a DeviceFrame, which is tagged with the device id. Each call returns the next frame of any device,
+//  so consecutive calls may return the frames of different devices.
+type MultiHandler struct {
+	io.ReadCloser
+	// handlers contains the registered handlers by device id.
+	handlers map[byte]*multiEntry
+	// hl protects handlers
+	hl sync.Mutex
+	// delimiter is the self-delimitation of the frames, see SetDelimiter.
+	delimiter Delimiter
+}
+
+// multiEntry is a registered handler with its frame source.
+type multiEntry struct {
+	dl DL
+	r  *frameReader
+}
+
+// DeviceFrame is the dataframe returned by MultiHandler.Get.
+// Frame is the dataframe returned by the handler of the device (e.g. UVR42Frame).
+type DeviceFrame struct {
+	DeviceID byte
+	Frame    interface{}
+}
+
+// NewMulti generate a new handler struct without any registered handlers, see Register.
+func NewMulti() *MultiHandler {
+	return &MultiHandler{handlers: map[byte]*multiEntry{}}
+}
+
+// NewAuto generate a new handler struct, which decodes the dataframes of all supported controllers
+// (uvr42, uvr31, uvr1611) by device id.
+func NewAuto() *MultiHandler {
+	h := NewMulti()
+	_ = h.Register(uvr42, NewUVR42())
+	_ = h.Register(uvr31, NewUVR31())
+	_ = h.Register(uvr1611, NewUVR1611())
+	return h
+}
+
+// Register defines the handler dl for the frames with device id.
+// The handler is connected to the frames of the device, an already registered handler of the device is replaced.
+func (h *MultiHandler) Register(id byte, dl DL) error {
+	r := &frameReader{}
+	if err := dl.Connect(r); err != nil {
+		return err
+	}
+
+	h.hl.Lock()
+	defer h.hl.Unlock()
+	h.handlers[id] = &multiEntry{dl: dl, r: r}
+	return nil
+}
+
+// SetDelimiter defines the self-delimitation of the received frames (see Delimiter), which is checked and removed
+// before the frame is dispatched to the handler of the device. The default disables the check.
+func (h *MultiHandler) SetDelimiter(d Delimiter) {
+	h.delimiter = d
+}
+
+// Connect defines the io.ReadWriterCloser
+func (h *MultiHandler) Connect(readCloser io.ReadCloser) error {
+	h.ReadCloser = readCloser
+	return nil
+}
+
+// Get reads the DL buffer and converts the buffer by the registered handler of the device.
+// The result is a DeviceFrame, the error is the error of the handler.
+//  If no handler is registered for the device id, an UnsupportedDeviceError is returned.
+func (h *MultiHandler) Get() (interface{}, error) {
+	b := make([]byte, 256)
+
+	n, err := h.Read(b)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if b, err = h.delimiter.check(b[:n]); err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 {
+		return nil, ErrInvalidSize
+	}
+
+	h.hl.Lock()
+	e, ok := h.handlers[b[0]]
+	h.hl.Unlock()
+
+	if !ok {
+		return DeviceFrame{DeviceID: b[0]}, UnsupportedDeviceError{Got: b[0]}
+	}
+
+	e.r.set(b)
+	f, err := e.dl.Get()
+	return DeviceFrame{DeviceID: b[0], Frame: f}, err
+}
+
+// Restart discards the stale data frames, see DL.Restart.
+// The registered handlers are restarted too (e.g. to reset the last measured values).
+func (h *MultiHandler) Restart() error {
+	if err := restart(h.ReadCloser); err != nil {
+		return err
+	}
+
+	h.hl.Lock()
+	defer h.hl.Unlock()
+	for _, e := range h.handlers {
+		if err := e.dl.Restart(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close the ReadCloser handler and the registered handlers.
+func (h *MultiHandler) Close() error {
+	h.hl.Lock()
+	defer h.hl.Unlock()
+
+	var err error
+	for _, e := range h.handlers {
+		if e := e.dl.Close(); e != nil {
+			err = e
+		}
+	}
+	if h.ReadCloser != nil {
+		if e := h.ReadCloser.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// frameReader is the ReadCloser of a registered handler, it contains the dispatched dataframe.
+type frameReader struct {
+	frame []byte
+}
+
+// set defines the next dataframe.
+func (r *frameReader) set(b []byte) {
+	r.frame = b
+}
+
+// Read copies the dataframe to b, io.EOF is returned, if the dataframe is already read.
+func (r *frameReader) Read(b []byte) (int, error) {
+	if r.frame == nil {
+		return 0, io.EOF
+	}
+
+	n := copy(b, r.frame)
+	r.frame = nil
+	return n, nil
+}
+
+// Reset discards the dataframe.
+func (r *frameReader) Reset() {
+	r.frame = nil
+}
+
+// Close has nothing to do.
+func (r *frameReader) Close() error {
+	return nil
+}
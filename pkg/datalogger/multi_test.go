@@ -0,0 +1,69 @@
+package datalogger
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAutoHandler(t *testing.T) {
+	uvr31Frame := []byte{uvr31, 0xc7, 0x01, 0xd2, 0x00, 0xdd, 0xff, 1 << 5}
+
+	h := NewAuto()
+	if err := h.Connect(&framesReader{frames: [][]byte{
+		uvr42Frame(455, 210, 210, 210, 1<<5),
+		uvr31Frame,
+		uvr42Frame(300, 210, 210, 210, 0),
+		{0x42, 0, 0},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// interleaved frames are decoded by the handler of their device id
+	for i, want := range []struct {
+		id   byte
+		temp float64
+	}{{uvr42, 45.5}, {uvr31, 45.5}, {uvr42, 30}} {
+		f, err := h.Get()
+		if err != nil {
+			t.Fatalf("frame %v: %v", i, err)
+		}
+		d, ok := f.(DeviceFrame)
+		if !ok || d.DeviceID != want.id {
+			t.Fatalf("frame %v: got %+v, want a device frame of device 0x%02x", i, f, want.id)
+		}
+
+		switch f := d.Frame.(type) {
+		case UVR42Frame:
+			if want.id != uvr42 || f.Temperature1 != want.temp || f.Out1 != (want.temp == 45.5) {
+				t.Errorf("frame %v: got uvr42 frame %+v, want temperature %v", i, f, want.temp)
+			}
+		case UVR31Frame:
+			if want.id != uvr31 || f.Temperature1 != want.temp || f.Temperature2 != 21 || f.Temperature3 != -3.5 || !f.Out1 {
+				t.Errorf("frame %v: got uvr31 frame %+v, want temperatures 45.5 21 -3.5", i, f)
+			}
+		default:
+			t.Errorf("frame %v: got frame %T, want the frame of device 0x%02x", i, f, want.id)
+		}
+	}
+
+	if _, err := h.Get(); !errors.As(err, &UnsupportedDeviceError{}) {
+		t.Errorf("got error %v of an unknown device, want UnsupportedDeviceError", err)
+	}
+}
+
+func TestMultiHandlerClose(t *testing.T) {
+	h := NewAuto()
+	// closing an unconnected handler closes the registered handlers only
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &framesReader{}
+	_ = h.Connect(r)
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !r.closed {
+		t.Error("got an open ReadCloser after close, want closed")
+	}
+}
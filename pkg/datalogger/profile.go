@@ -0,0 +1,300 @@
+package datalogger
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidProfile is returned if the profile fields exceed the frame or overlap illegally.
+var ErrInvalidProfile = errors.New("invalid profile")
+
+// FieldKind is the kind of profile field.
+type FieldKind int
+
+const (
+	// Analog is a signed little endian integer (1, 2 or 4 bytes), which is multiplied by the scale factor.
+	Analog FieldKind = iota
+	// Digital is a single bit of a byte.
+	Digital
+	// Input is a 2 byte input of a controller (little endian), which is scaled according to its sensor type
+	// (see inputValue). The sensor type is transmitted in bit 12..14, if the profile has TypedInputs (see decodeInput).
+	Input
+	// Unsigned is an unsigned little endian integer (1 or 2 bytes), e.g. a speed step.
+	Unsigned
+	// Time is a time stamp, it's always derived (e.g. the receive time of the frame).
+	Time
+	// Text is a string, it's always derived (e.g. the unit of the temperatures).
+	Text
+)
+
+// String returns the name of the field kind.
+func (k FieldKind) String() string {
+	switch k {
+	case Analog:
+		return "analog"
+	case Digital:
+		return "digital"
+	case Input:
+		return "input"
+	case Unsigned:
+		return "unsigned"
+	case Time:
+		return "time"
+	case Text:
+		return "text"
+	}
+	return fmt.Sprintf("FieldKind(%d)", int(k))
+}
+
+// Field describes a value of a data frame.
+type Field struct {
+	// Name is the name of the value, e.g. Temperature1.
+	Name string
+	// Kind of the value (e.g. Analog/Digital).
+	Kind FieldKind
+	// Offset is the byte offset in the frame (byte 0 is the device id).
+	Offset int
+	// Size is the count of bytes of an analog (1, 2 or 4) or unsigned value (1 or 2), an input has always 2 bytes.
+	Size int
+	// Scale is the factor of an analog value, e.g. 0.1. An input is scaled by the scale of the handler (see SetScale).
+	Scale float64
+	// Bit is the bit index (0..7) of a digital value.
+	Bit int
+	// Unit is the unit of an analog value, e.g. °C.
+	Unit string
+	// Optional is true, if the field is only transmitted by some firmware versions (e.g. the rotation speed of the uvr42).
+	// The optional fields follow the other fields, a frame without the optional fields ends before the first optional field.
+	// An optional derived field may be missing in the decoded frame structure (e.g. Synthetic).
+	Optional bool
+	// Derived is true, if the value isn't decoded from the frame bytes, but set by the handler
+	// (e.g. the time stamp or a value calculated from several fields). The offset of a derived field is unused,
+	// the field only describes the decoded frame structure (see the schema of the app).
+	Derived bool
+}
+
+// Profile describes the layout of the data frame of a device.
+//  Analog and input fields are decoded to float64, digital fields to bool and unsigned fields to int,
+//  derived fields are skipped by Decode.
+//  Fields may not overlap, except several digital fields within one byte with different bits.
+type Profile struct {
+	// DeviceID is the device id (byte 0 of the frame).
+	DeviceID byte
+	// Length is the count of bytes of the frame (incl. device id and optional fields, without the delimiter bytes).
+	Length int
+	// Fields are the values of the frame.
+	Fields []Field
+	// Delimiter makes the frame self-delimiting to detect a mis-framed byte (e.g. by a bit slip), see Delimiter.
+	Delimiter Delimiter
+	// TypedInputs is true, if the inputs transmit the sensor type in bit 12..14 (see decodeInput),
+	// otherwise the inputs are signed 16 bit values.
+	TypedInputs bool
+}
+
+// Delimiter describes the self-delimitation of a frame.
+//  The frame is mis-framed, if the length byte doesn't match the size of the received frame
+//  or the last byte isn't the terminator. The delimiter bytes aren't part of the frame (Length, Offset),
+//  they are removed by the check before the frame is decoded.
+type Delimiter struct {
+	// LengthOffset is the byte offset of the length byte (count of bytes of the received frame incl. the delimiter bytes),
+	// the following bytes of the frame are shifted by the length byte. The value 0 disables the length byte.
+	LengthOffset int
+	// Terminated enables the terminator, which is the last byte of the received frame.
+	Terminated bool
+	// Terminator is the value of the terminator.
+	Terminator byte
+}
+
+// ErrMisframed is returned if the frame doesn't match the length byte or the terminator of the profile.
+var ErrMisframed = errors.New("mis-framed frame")
+
+// Validate checks that all fields are within the frame and don't overlap illegally.
+func (p Profile) Validate() error {
+	// analog contains the analog field name of each byte, digital contains the used bits of each byte
+	analog := make([]string, p.Length)
+	digital := make([]byte, p.Length)
+
+	// the optional fields follow the other fields, min is the size of a frame without the optional fields
+	min := p.minLength()
+
+	// the length byte follows the device id and must be received by a frame without the optional fields
+	if o := p.Delimiter.LengthOffset; o < 0 || o > min {
+		return fmt.Errorf("%w: length byte is out of frame", ErrInvalidProfile)
+	}
+
+	for _, f := range p.Fields {
+		if f.Derived {
+			if f.Kind < Analog || f.Kind > Text {
+				return fmt.Errorf("%w: field %q has an unknown kind", ErrInvalidProfile, f.Name)
+			}
+			continue
+		}
+
+		switch f.Kind {
+		case Analog, Input, Unsigned:
+			size := f.Size
+			if f.Kind == Input {
+				size = 2
+			}
+			if !validSize(f.Kind, size) || f.Offset < 1 || f.Offset+size > p.Length {
+				return fmt.Errorf("%w: field %q is out of frame", ErrInvalidProfile, f.Name)
+			}
+			if !f.Optional && f.Offset+size > min {
+				return fmt.Errorf("%w: field %q overlaps the optional fields", ErrInvalidProfile, f.Name)
+			}
+
+			for i := f.Offset; i < f.Offset+size; i++ {
+				if analog[i] != "" || digital[i] != 0 {
+					return fmt.Errorf("%w: field %q overlaps byte %v", ErrInvalidProfile, f.Name, i)
+				}
+				analog[i] = f.Name
+			}
+
+		case Digital:
+			if f.Bit < 0 || f.Bit > 7 || f.Offset < 1 || f.Offset >= p.Length {
+				return fmt.Errorf("%w: field %q is out of frame", ErrInvalidProfile, f.Name)
+			}
+			if !f.Optional && f.Offset >= min {
+				return fmt.Errorf("%w: field %q overlaps the optional fields", ErrInvalidProfile, f.Name)
+			}
+
+			if analog[f.Offset] != "" || digital[f.Offset]&(1<<f.Bit) != 0 {
+				return fmt.Errorf("%w: field %q overlaps byte %v bit %v", ErrInvalidProfile, f.Name, f.Offset, f.Bit)
+			}
+			digital[f.Offset] |= 1 << f.Bit
+
+		case Time, Text:
+			return fmt.Errorf("%w: field %q of kind %v must be derived", ErrInvalidProfile, f.Name, f.Kind)
+
+		default:
+			return fmt.Errorf("%w: field %q has an unknown kind", ErrInvalidProfile, f.Name)
+		}
+	}
+
+	return nil
+}
+
+// validSize returns true, if size is a valid count of bytes of a field of kind k.
+func validSize(k FieldKind, size int) bool {
+	return size == 1 || size == 2 || k == Analog && size == 4
+}
+
+// minLength returns the size of a frame without the optional fields, which is the offset of the first optional field.
+func (p Profile) minLength() int {
+	min := p.Length
+	for _, f := range p.Fields {
+		if f.Optional && !f.Derived && f.Offset < min {
+			min = f.Offset
+		}
+	}
+	return min
+}
+
+// Decode walks through the profile fields and decodes the values of the frame.
+// A self-delimiting frame (see Delimiter) is checked first, so a mis-framed frame returns ErrMisframed.
+// The inputs are scaled by DefaultScale, an input out of range returns ErrInvalidTemperature with the decoded values.
+func (p Profile) Decode(b []byte) (map[string]interface{}, error) {
+	d, err := p.decode(b, nil, DefaultScale)
+	return d.values, err
+}
+
+// decoded contains the decoded values of a frame, see Profile.decode.
+type decoded struct {
+	// values contains the values by field name, an optional field, which isn't transmitted, is missing.
+	values map[string]interface{}
+	// sensors contains the transmitted sensor types of the inputs in the order of the fields (nil without TypedInputs).
+	sensors []SensorType
+}
+
+// decode walks through the profile fields and decodes the values of the frame b.
+// The inputs are scaled by s according to their sensor type, types are the configured sensor types of the inputs
+// (see inputValue). An input out of range returns its error with the decoded values.
+func (p Profile) decode(b []byte, types []SensorType, s Scale) (decoded, error) {
+	b, err := p.Delimiter.check(b)
+	if err != nil {
+		return decoded{}, err
+	}
+
+	if len(b) != p.Length && len(b) != p.minLength() {
+		return decoded{}, ErrInvalidSize
+	}
+
+	if b[0] != p.DeviceID {
+		return decoded{}, UnsupportedDeviceError{Got: b[0]}
+	}
+
+	d := decoded{values: make(map[string]interface{}, len(p.Fields))}
+	var inputErr error
+	input := 0
+
+	for _, f := range p.Fields {
+		if f.Derived || f.Optional && f.Offset >= len(b) {
+			continue
+		}
+
+		switch f.Kind {
+		case Analog:
+			var v int
+			switch f.Size {
+			case 1:
+				v = int(int8(b[f.Offset]))
+			case 2:
+				v = int(int16(binary.LittleEndian.Uint16(b[f.Offset : f.Offset+2])))
+			default:
+				v = int(int32(binary.LittleEndian.Uint32(b[f.Offset : f.Offset+4])))
+			}
+			d.values[f.Name] = float64(v) * f.Scale
+
+		case Digital:
+			d.values[f.Name] = b[f.Offset]&(1<<f.Bit) > 0
+
+		case Input:
+			var raw int16
+			var t SensorType
+			if p.TypedInputs {
+				raw, t = decodeInput(b[f.Offset : f.Offset+2])
+				d.sensors = append(d.sensors, t)
+			} else {
+				raw = decodeUntypedInput(b[f.Offset : f.Offset+2])
+			}
+
+			v, err := inputValue(raw, t, sensorType(types, input), s)
+			if err != nil {
+				inputErr = err
+			}
+			d.values[f.Name] = v
+			input++
+
+		case Unsigned:
+			if f.Size == 1 {
+				d.values[f.Name] = int(b[f.Offset])
+			} else {
+				d.values[f.Name] = int(binary.LittleEndian.Uint16(b[f.Offset : f.Offset+2]))
+			}
+		}
+	}
+
+	return d, inputErr
+}
+
+// check checks the length byte and the terminator of the received frame b and returns the frame without them.
+//  The frame b isn't modified.
+func (d Delimiter) check(b []byte) ([]byte, error) {
+	n := len(b)
+
+	if d.Terminated {
+		if n == 0 || b[n-1] != d.Terminator {
+			return nil, fmt.Errorf("%w: missing terminator 0x%02x", ErrMisframed, d.Terminator)
+		}
+		b = b[:n-1]
+	}
+
+	if o := d.LengthOffset; o != 0 {
+		if o >= len(b) || int(b[o]) != n {
+			return nil, fmt.Errorf("%w: length byte doesn't match frame size %v", ErrMisframed, n)
+		}
+		b = append(b[:o:o], b[o+1:]...)
+	}
+
+	return b, nil
+}
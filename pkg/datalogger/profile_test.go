@@ -0,0 +1,298 @@
+package datalogger
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// mixedProfile has two analog and three digital fields, two digital fields share a byte.
+var mixedProfile = Profile{
+	DeviceID: 0x70,
+	Length:   6,
+	Fields: []Field{
+		{Name: "Temperature", Kind: Analog, Offset: 1, Size: 2, Scale: 0.1, Unit: "°C"},
+		{Name: "Pump", Kind: Digital, Offset: 3, Bit: 0},
+		{Name: "Valve", Kind: Digital, Offset: 3, Bit: 5},
+		{Name: "Level", Kind: Analog, Offset: 4, Size: 1, Scale: 1},
+		{Name: "Alarm", Kind: Digital, Offset: 5, Bit: 7},
+	},
+}
+
+func TestProfileDecode(t *testing.T) {
+	if err := mixedProfile.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+		want map[string]interface{}
+	}{
+		{"values", []byte{0x70, 0xc7, 0x01, 1<<5 | 1<<3, 0xfe, 1 << 7},
+			map[string]interface{}{"Temperature": 45.5, "Pump": false, "Valve": true, "Level": -2.0, "Alarm": true}},
+		{"negative temperature", []byte{0x70, 0xdd, 0xff, 1, 12, 1 << 6},
+			map[string]interface{}{"Temperature": -3.5, "Pump": true, "Valve": false, "Level": 12.0, "Alarm": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mixedProfile.Decode(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := mixedProfile.Decode([]byte{0x70, 0, 0, 0, 0}); !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("got error %v of a short frame, want %v", err, ErrInvalidSize)
+	}
+	if _, err := mixedProfile.Decode([]byte{0x10, 0, 0, 0, 0, 0}); !errors.As(err, &UnsupportedDeviceError{}) {
+		t.Errorf("got error %v of another device, want UnsupportedDeviceError", err)
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []Field
+		valid  bool
+	}{
+		{"digital fields of one byte", []Field{{Name: "a", Kind: Digital, Offset: 1, Bit: 0}, {Name: "b", Kind: Digital, Offset: 1, Bit: 1}}, true},
+		{"adjacent analog fields", []Field{{Name: "a", Kind: Analog, Offset: 1, Size: 2}, {Name: "b", Kind: Analog, Offset: 3, Size: 1}}, true},
+		{"overlapping analog fields", []Field{{Name: "a", Kind: Analog, Offset: 1, Size: 2}, {Name: "b", Kind: Analog, Offset: 2, Size: 2}}, false},
+		{"digital field within analog field", []Field{{Name: "a", Kind: Analog, Offset: 1, Size: 2}, {Name: "b", Kind: Digital, Offset: 2, Bit: 3}}, false},
+		{"analog field over digital field", []Field{{Name: "a", Kind: Digital, Offset: 2, Bit: 3}, {Name: "b", Kind: Analog, Offset: 1, Size: 2}}, false},
+		{"same bit", []Field{{Name: "a", Kind: Digital, Offset: 1, Bit: 4}, {Name: "b", Kind: Digital, Offset: 1, Bit: 4}}, false},
+		{"device id byte", []Field{{Name: "a", Kind: Analog, Offset: 0, Size: 1}}, false},
+		{"analog field out of frame", []Field{{Name: "a", Kind: Analog, Offset: 4, Size: 2}}, false},
+		{"invalid analog size", []Field{{Name: "a", Kind: Analog, Offset: 1, Size: 3}}, false},
+		{"invalid bit", []Field{{Name: "a", Kind: Digital, Offset: 1, Bit: 8}}, false},
+		{"input", []Field{{Name: "a", Kind: Input, Offset: 1}, {Name: "b", Kind: Unsigned, Offset: 3, Size: 1}}, true},
+		{"input out of frame", []Field{{Name: "a", Kind: Input, Offset: 4}}, false},
+		{"overlapping input", []Field{{Name: "a", Kind: Input, Offset: 1}, {Name: "b", Kind: Unsigned, Offset: 2, Size: 1}}, false},
+		{"invalid unsigned size", []Field{{Name: "a", Kind: Unsigned, Offset: 1}}, false},
+		{"optional field", []Field{{Name: "a", Kind: Input, Offset: 1}, {Name: "b", Kind: Unsigned, Offset: 3, Size: 2, Optional: true}}, true},
+		{"optional field before a field", []Field{{Name: "a", Kind: Input, Offset: 1, Optional: true}, {Name: "b", Kind: Digital, Offset: 3}}, false},
+		{"unknown kind", []Field{{Name: "a", Kind: FieldKind(99), Offset: 1}}, false},
+		{"4 byte analog field", []Field{{Name: "a", Kind: Analog, Offset: 1, Size: 4}}, true},
+		{"4 byte unsigned field", []Field{{Name: "a", Kind: Unsigned, Offset: 1, Size: 4}}, false},
+		{"derived fields", []Field{{Name: "a", Kind: Time, Derived: true}, {Name: "b", Kind: Analog, Offset: 1, Size: 2},
+			{Name: "c", Kind: Analog, Derived: true}, {Name: "d", Kind: Text, Derived: true, Optional: true}}, true},
+		{"text field", []Field{{Name: "a", Kind: Text, Offset: 1}}, false},
+		{"derived unknown kind", []Field{{Name: "a", Kind: FieldKind(99), Derived: true}}, false},
+	}
+	for name, p := range map[string]Profile{"uvr42": UVR42Profile, "uvr31": UVR31Profile, "uvr1611": UVR1611Profile, "raw": RawProfile} {
+		if err := p.Validate(); err != nil {
+			t.Errorf("got error %v of the %v profile, want valid profile", err, name)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Profile{DeviceID: 0x70, Length: 5, Fields: tt.fields}.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("got error %v, want valid profile", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidProfile) {
+				t.Errorf("got error %v, want %v", err, ErrInvalidProfile)
+			}
+		})
+	}
+}
+
+func TestProfileInputs(t *testing.T) {
+	p := Profile{
+		DeviceID: 0x70,
+		Length:   6,
+		Fields: []Field{
+			{Name: "Input1", Kind: Input, Offset: 1},
+			{Name: "Input2", Kind: Input, Offset: 3},
+			{Name: "Speed", Kind: Unsigned, Offset: 5, Size: 1, Optional: true},
+		},
+		TypedInputs: true,
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// temperature 45.5 °C (sensor type 2), flow 25 (sensor type 3, 100 l/h), speed step 20
+	d, err := p.decode([]byte{0x70, 0xc7, 0x21, 0x19, 0x30, 20}, nil, DefaultScale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"Input1": 45.5, "Input2": 100.0, "Speed": 20}; !reflect.DeepEqual(d.values, want) {
+		t.Errorf("got values %v, want %v", d.values, want)
+	}
+	if want := []SensorType{SensorTemperature, SensorFlow}; !reflect.DeepEqual(d.sensors, want) {
+		t.Errorf("got sensor types %v, want %v", d.sensors, want)
+	}
+
+	// the optional field isn't transmitted, the configured type overrides the transmitted type
+	if d, err = p.decode([]byte{0x70, 0xc7, 0x21, 0x19, 0x30}, []SensorType{SensorRadiation}, DefaultScale); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"Input1": 455.0, "Input2": 100.0}; !reflect.DeepEqual(d.values, want) {
+		t.Errorf("got values %v of the frame without the optional field, want %v", d.values, want)
+	}
+
+	// an input out of range returns the error with the decoded values
+	p.TypedInputs = false
+	if d, err = p.decode([]byte{0x70, 0x10, 0x27, 0, 0}, nil, DefaultScale); !errors.Is(err, ErrInvalidTemperature) || d.values["Input1"] != 1000.0 {
+		t.Errorf("got values %v (%v), want input 1000 and %v", d.values, err, ErrInvalidTemperature)
+	}
+	if _, err = p.decode([]byte{0x70, 0xc7, 0x21, 0x19}, nil, DefaultScale); !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("got error %v of a short frame, want %v", err, ErrInvalidSize)
+	}
+}
+
+func TestProfileDelimiter(t *testing.T) {
+	// the delimiter bytes aren't part of the frame: the length byte follows the device id, the terminator the pump
+	p := Profile{
+		DeviceID: 0x70,
+		Length:   4,
+		Fields: []Field{
+			{Name: "Temperature", Kind: Analog, Offset: 1, Size: 2, Scale: 0.1},
+			{Name: "Pump", Kind: Digital, Offset: 3, Bit: 0},
+		},
+		Delimiter: Delimiter{LengthOffset: 1, Terminated: true, Terminator: 0x55},
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	frame := []byte{0x70, 6, 0xc7, 0x01, 1, 0x55}
+	// slipped returns the frame after a lost bit behind the device id: the following bits (LSB first) shift by one
+	slipped := func(b []byte) []byte {
+		s := append([]byte{}, b...)
+		for i := 1; i < len(s); i++ {
+			s[i] = b[i] >> 1
+			if i+1 < len(b) {
+				s[i] |= b[i+1] << 7
+			}
+		}
+		return s
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{"valid", frame, nil},
+		{"bit slip", slipped(frame), ErrMisframed},
+		{"missing byte", append(append([]byte{}, frame[:2]...), frame[3:]...), ErrMisframed},
+		{"extra byte", append(append([]byte{}, frame[:5]...), 0, 0x55), ErrMisframed},
+		{"missing terminator", append(append([]byte{}, frame[:5]...), 0x54), ErrMisframed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := p.Decode(tt.b)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err == nil && (v["Temperature"] != 45.5 || v["Pump"] != true) {
+				t.Errorf("got values %v, want Temperature 45.5 and Pump true", v)
+			}
+		})
+	}
+
+	// the received frame isn't modified by the check
+	if b, _ := p.Delimiter.check(frame); len(b) != 4 || frame[1] != 6 || frame[2] != 0xc7 {
+		t.Errorf("got frame %x without delimiter bytes of the received frame %x, want 70c70101", b, frame)
+	}
+
+	// the length byte must be received by a frame without the optional fields
+	p.Length++
+	p.Fields = append(p.Fields, Field{Name: "Level", Kind: Unsigned, Offset: 4, Size: 1, Optional: true})
+	p.Delimiter.LengthOffset = 4
+	if err := p.Validate(); err != nil {
+		t.Errorf("got error %v of the length byte before the optional fields, want valid profile", err)
+	}
+	p.Delimiter.LengthOffset = 5
+	if err := p.Validate(); !errors.Is(err, ErrInvalidProfile) {
+		t.Errorf("got error %v of the length byte within the optional fields, want %v", err, ErrInvalidProfile)
+	}
+}
+
+func TestProfileUVR1611(t *testing.T) {
+	v, err := UVR1611Profile.Decode(uvr1611Bytes(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the derived fields aren't decoded
+	want := map[string]interface{}{"Inputs1": 45.5, "Inputs6": 800.0, "Outputs": 0x13, "SpeedSteps2": 0x80,
+		"HeatMeters1.Active": true, "HeatMeters1.Power": 12.5, "HeatMeters2.Power": 0.0}
+	for name, w := range want {
+		if v[name] != w {
+			t.Errorf("got %v %v, want %v", name, v[name], w)
+		}
+	}
+	for _, name := range []string{"TimeStamp", "SensorTypes1", "HeatMeters1.Energy"} {
+		if _, ok := v[name]; ok {
+			t.Errorf("got derived value %v, want none", name)
+		}
+	}
+}
+
+// delimited returns the frame b with the length byte after the device id and the terminator 0x55.
+func delimited(b []byte) []byte {
+	d := append([]byte{b[0], byte(len(b) + 2)}, b[1:]...)
+	return append(d, 0x55)
+}
+
+// delimitedDL is a handler of self-delimiting frames.
+type delimitedDL interface {
+	DL
+	SetDelimiter(Delimiter)
+}
+
+func TestHandlerDelimiter(t *testing.T) {
+	uvr31Frame := []byte{uvr31, 0xc7, 0x01, 0xd2, 0x00, 0xdd, 0xff, 1 << 5}
+
+	tests := []struct {
+		name  string
+		h     delimitedDL
+		frame []byte
+	}{
+		{"uvr42", NewUVR42(), uvr42Frame(455, 210, 210, 210, 1<<5)},
+		{"uvr31", NewUVR31(), uvr31Frame},
+		{"uvr1611", NewUVR1611(), uvr1611Bytes(t)},
+		{"raw", NewRaw(), uvr31Frame},
+		{"auto", NewAuto(), uvr31Frame},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the second frame lost a byte (e.g. by a bit slip), which is detected by the length byte
+			b := delimited(tt.frame)
+			slipped := append(append([]byte{}, b[:4]...), b[5:]...)
+
+			tt.h.SetDelimiter(Delimiter{LengthOffset: 1, Terminated: true, Terminator: 0x55})
+			if err := tt.h.Connect(&framesReader{frames: [][]byte{b, slipped}}); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := tt.h.Get(); err != nil {
+				t.Errorf("got error %v of the delimited frame, want nil", err)
+			}
+			if _, err := tt.h.Get(); !errors.Is(err, ErrMisframed) {
+				t.Errorf("got error %v of the slipped frame, want %v", err, ErrMisframed)
+			}
+		})
+	}
+
+	// the raw frame doesn't contain the delimiter bytes
+	h := NewRaw()
+	h.SetDelimiter(Delimiter{LengthOffset: 1, Terminated: true, Terminator: 0x55})
+	_ = h.Connect(&framesReader{frames: [][]byte{delimited(uvr31Frame)}})
+	f, err := h.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := f.(RawFrame); f.Length != len(uvr31Frame) || f.Data != "30c701d200ddff20" {
+		t.Errorf("got raw frame %+v, want the frame without delimiter bytes", f)
+	}
+}
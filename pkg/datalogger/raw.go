@@ -0,0 +1,91 @@
+package datalogger
+
+import (
+	"encoding/hex"
+	"io"
+	"time"
+)
+
+// RawHandler is the handler to read the raw dataframes of any device, e.g. to reverse-engineer new devices.
+type RawHandler struct {
+	io.ReadCloser
+	// delimiter is the self-delimitation of the frames, see SetDelimiter.
+	delimiter Delimiter
+}
+
+// RawFrame is the raw dataframe of a device without any interpretation.
+// Data contains all bytes of the frame (incl. device id, without the delimiter bytes) as hex string.
+// Synthetic is true for an injected test frame, which wasn't received from the device.
+type RawFrame struct {
+	TimeStamp time.Time
+	DeviceID  byte
+	Length    int
+	Data      string
+	Synthetic bool `json:",omitempty"`
+}
+
+// RawProfile describes the raw dataframe (RawFrame), all fields are derived, because the bytes of the frame aren't decoded.
+var RawProfile = Profile{
+	Fields: []Field{
+		{Name: "TimeStamp", Kind: Time, Derived: true},
+		{Name: "DeviceID", Kind: Unsigned, Derived: true},
+		{Name: "Length", Kind: Unsigned, Derived: true},
+		{Name: "Data", Kind: Text, Derived: true},
+		{Name: "Synthetic", Kind: Digital, Derived: true, Optional: true},
+	},
+}
+
+// NewRaw generate a new handler struct for raw dataframes.
+func NewRaw() *RawHandler {
+	return &RawHandler{}
+}
+
+// SetDelimiter defines the self-delimitation of the received frames (see Delimiter), which is checked and removed
+// before the frame is decoded. The default disables the check.
+func (h *RawHandler) SetDelimiter(d Delimiter) {
+	h.delimiter = d
+}
+
+// Connect defines the io.ReadWriterCloser
+func (h *RawHandler) Connect(readCloser io.ReadCloser) error {
+	h.ReadCloser = readCloser
+	return nil
+}
+
+// Get reads the DL buffer and returns the raw dataframe.
+func (h *RawHandler) Get() (interface{}, error) {
+	var f RawFrame
+
+	b := make([]byte, 256)
+
+	n, err := h.Read(b)
+
+	if err != nil {
+		return f, err
+	}
+
+	if b, err = h.delimiter.check(b[:n]); err != nil {
+		return f, err
+	}
+
+	if len(b) == 0 {
+		return f, ErrInvalidSize
+	}
+
+	f.TimeStamp = time.Now()
+	f.DeviceID = b[0]
+	f.Length = len(b)
+	f.Data = hex.EncodeToString(b)
+
+	return f, nil
+}
+
+// Restart discards the stale data frames, see DL.Restart.
+func (h *RawHandler) Restart() error {
+	return restart(h.ReadCloser)
+}
+
+// Close the ReadCloser handler.
+func (h *RawHandler) Close() error {
+	return nil
+}
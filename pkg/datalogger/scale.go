@@ -0,0 +1,67 @@
+package datalogger
+
+import (
+	"fmt"
+)
+
+// Unit is the temperature unit of the values transmitted by a controller.
+type Unit string
+
+const (
+	// Celsius is the unit °C.
+	Celsius Unit = "C"
+	// Fahrenheit is the unit °F.
+	Fahrenheit Unit = "F"
+	// Kelvin is the unit K.
+	Kelvin Unit = "K"
+)
+
+// Scale defines the scaling of the transmitted temperatures: the value is the transmitted value * Factor in Unit.
+type Scale struct {
+	Factor float64
+	Unit   Unit
+}
+
+// DefaultScale is the scaling of the TA controllers (0.1 °C).
+var DefaultScale = Scale{Factor: 0.1, Unit: Celsius}
+
+// ParseUnit returns the unit of the name (C, F or K).
+func ParseUnit(name string) (Unit, error) {
+	switch u := Unit(name); u {
+	case Celsius, Fahrenheit, Kelvin:
+		return u, nil
+	}
+	return "", fmt.Errorf("unsupported unit: %q", name)
+}
+
+// Symbol returns the symbol of the unit (°C, °F or K), the empty unit is °C (see DefaultScale).
+func (u Unit) Symbol() string {
+	switch u {
+	case Fahrenheit:
+		return "°F"
+	case Kelvin:
+		return "K"
+	}
+	return "°C"
+}
+
+// temperature returns the scaled temperature of the transmitted value v.
+// A temperature out of range (tMin, tMax in °C) returns ErrInvalidTemperature.
+func (s Scale) temperature(v int16) (float64, error) {
+	value := float64(v) * s.Factor
+	if c := s.celsius(value); c > tMax || c < tMin {
+		return value, ErrInvalidTemperature
+	}
+	return value, nil
+}
+
+// celsius converts the temperature v of the unit to °C.
+func (s Scale) celsius(v float64) float64 {
+	switch s.Unit {
+	case Fahrenheit:
+		return (v - 32) * 5 / 9
+	case Kelvin:
+		return v - 273.15
+	}
+	return v
+}
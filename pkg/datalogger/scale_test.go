@@ -0,0 +1,62 @@
+package datalogger
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestScaleResolution(t *testing.T) {
+	tests := []struct {
+		name  string
+		scale Scale
+		raw   uint16
+		want  float64
+		err   error
+	}{
+		{"default 0.1 °C", DefaultScale, 455, 45.5, nil},
+		{"0.5 °C", Scale{Factor: 0.5, Unit: Celsius}, 91, 45.5, nil},
+		{"0.5 °C negative", Scale{Factor: 0.5, Unit: Celsius}, 0xfff6, -5, nil},
+		{"0.1 K", Scale{Factor: 0.1, Unit: Kelvin}, 3186, 318.6, nil},
+		{"0.1 K out of range", Scale{Factor: 0.1, Unit: Kelvin}, 455, 45.5, ErrInvalidTemperature},
+		{"1 °F", Scale{Factor: 1, Unit: Fahrenheit}, 114, 114, nil},
+		{"1 °F out of range", Scale{Factor: 1, Unit: Fahrenheit}, 600, 600, ErrInvalidTemperature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, d := range []struct {
+				device string
+				frame  []byte
+				decode func(b []byte) (float64, Unit, error)
+			}{
+				{"uvr42", uvr42Frame(tt.raw, tt.raw, tt.raw, tt.raw, 0), func(b []byte) (float64, Unit, error) {
+					f, err := decodeUVR42(b, len(b), false, nil, tt.scale)
+					return f.Temperature1, f.Unit, err
+				}},
+				{"uvr31", []byte{uvr31, byte(tt.raw), byte(tt.raw >> 8), byte(tt.raw), byte(tt.raw >> 8), byte(tt.raw), byte(tt.raw >> 8), 0},
+					func(b []byte) (float64, Unit, error) {
+						f, err := decodeUVR31(b, len(b), tt.scale)
+						return f.Temperature1, f.Unit, err
+					}},
+			} {
+				v, u, err := d.decode(d.frame)
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("%v: got error %v, want %v", d.device, err, tt.err)
+				}
+				if diff := v - tt.want; diff > 1e-9 || diff < -1e-9 || u != tt.scale.Unit {
+					t.Errorf("%v: got %v %v, want %v %v", d.device, v, u, tt.want, tt.scale.Unit)
+				}
+			}
+		})
+	}
+}
+
+func TestUnitSymbol(t *testing.T) {
+	for u, want := range map[Unit]string{Celsius: "°C", Fahrenheit: "°F", Kelvin: "K", "": "°C"} {
+		if got := u.Symbol(); got != want {
+			t.Errorf("got symbol %q of %q, want %q", got, u, want)
+		}
+	}
+	if _, err := ParseUnit("X"); err == nil {
+		t.Error("got no error of an unsupported unit")
+	}
+}
@@ -0,0 +1,130 @@
+package datalogger
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// SensorType is the type of sensor an input is configured for.
+// It's transmitted in bit 12..14 of the input value by controllers with typed inputs (see Profile.TypedInputs),
+// the value 0 indicates an unused input or a controller, which doesn't transmit the sensor type.
+type SensorType int
+
+const (
+	// SensorNone is an unused input or the sensor type isn't transmitted.
+	SensorNone SensorType = 0
+	// SensorDigital is a digital input (on/off).
+	SensorDigital SensorType = 1
+	// SensorTemperature is a temperature sensor (°C).
+	SensorTemperature SensorType = 2
+	// SensorFlow is a volume flow encoder (l/h).
+	SensorFlow SensorType = 3
+	// SensorRadiation is a radiation sensor (W/m²).
+	SensorRadiation SensorType = 6
+	// SensorRoom is a room sensor (°C).
+	SensorRoom SensorType = 7
+)
+
+// String returns the name of the sensor type.
+func (t SensorType) String() string {
+	switch t {
+	case SensorNone:
+		return "none"
+	case SensorDigital:
+		return "digital"
+	case SensorTemperature:
+		return "temperature"
+	case SensorFlow:
+		return "flow"
+	case SensorRadiation:
+		return "radiation"
+	case SensorRoom:
+		return "room"
+	}
+	return fmt.Sprintf("SensorType(%d)", int(t))
+}
+
+// Unit returns the unit of the scaled values of the sensor type (see inputValue), u is the unit of the temperatures.
+// A digital input has no unit (0: off, 1: on).
+func (t SensorType) Unit(u Unit) string {
+	switch t {
+	case SensorFlow:
+		return "l/h"
+	case SensorRadiation:
+		return "W/m²"
+	case SensorDigital:
+		return ""
+	}
+	return u.Symbol()
+}
+
+// ParseSensorType returns the sensor type of the name (see String).
+func ParseSensorType(name string) (SensorType, error) {
+	for _, t := range []SensorType{SensorNone, SensorDigital, SensorTemperature, SensorFlow, SensorRadiation, SensorRoom} {
+		if t.String() == name {
+			return t, nil
+		}
+	}
+	return SensorNone, fmt.Errorf("unsupported sensor type: %q", name)
+}
+
+// MarshalText encodes the sensor type by its name (e.g. in JSON).
+func (t SensorType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// decodeInput decodes the 2 byte input value (little endian):
+//  bit 0..11:  value
+//  bit 12..14: sensor type
+//  bit 15:     sign, the value is negative (two's complement)
+func decodeInput(b []byte) (value int16, t SensorType) {
+	v := uint16(b[0]) | uint16(b[1])<<8
+	t = SensorType(v >> 12 & 0x07)
+
+	if v&0x8000 > 0 {
+		v |= 0xf000
+	} else {
+		v &= 0x0fff
+	}
+
+	return int16(v), t
+}
+
+// decodeUntypedInput decodes the 2 byte input value (little endian) of a controller without typed inputs,
+// it's a signed 16 bit value, e.g. 0xffce is -50 (-5.0 °C).
+func decodeUntypedInput(b []byte) int16 {
+	return int16(binary.LittleEndian.Uint16(b))
+}
+
+// inputValue returns the scaled value of the input depending on the sensor type.
+// The configured type overrides the transmitted type, if it isn't SensorNone.
+//  * temperature, room and unknown sensors: scaled by s (default 0.1 °C)
+//  * flow: 4 l/h
+//  * radiation: 1 W/m²
+//  * digital: 0 (off) or 1 (on)
+// A temperature out of range (tMin, tMax) returns ErrInvalidTemperature, other types aren't range checked.
+func inputValue(v int16, transmitted, configured SensorType, s Scale) (float64, error) {
+	t := transmitted
+	if configured != SensorNone {
+		t = configured
+	}
+
+	switch t {
+	case SensorFlow:
+		return float64(v) * 4, nil
+	case SensorRadiation:
+		return float64(v), nil
+	case SensorDigital:
+		return float64(v & 1), nil
+	}
+
+	return s.temperature(v)
+}
+
+// sensorType returns the i-th sensor type of the configured sensor types, or SensorNone.
+func sensorType(types []SensorType, i int) SensorType {
+	if i < len(types) {
+		return types[i]
+	}
+	return SensorNone
+}
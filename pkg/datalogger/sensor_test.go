@@ -0,0 +1,97 @@
+package datalogger
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   []byte
+		value int16
+		typ   SensorType
+	}{
+		{"temperature", []byte{0xc7, 0x21}, 455, SensorTemperature},
+		{"negative temperature", []byte{0xce, 0xaf}, -50, SensorTemperature},
+		{"negative room", []byte{0xec, 0xff}, -20, SensorRoom},
+		{"flow", []byte{0x19, 0x30}, 25, SensorFlow},
+		{"unused", []byte{0x00, 0x00}, 0, SensorNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v, typ := decodeInput(tt.raw); v != tt.value || typ != tt.typ {
+				t.Errorf("got %v %v, want %v %v", v, typ, tt.value, tt.typ)
+			}
+		})
+	}
+}
+
+func TestInputValue(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         int16
+		transmitted SensorType
+		configured  SensorType
+		want        float64
+		err         error
+	}{
+		{"temperature", 455, SensorTemperature, SensorNone, 45.5, nil},
+		{"negative temperature", -50, SensorNone, SensorNone, -5, nil},
+		{"room", -20, SensorRoom, SensorNone, -2, nil},
+		{"flow", 1200, SensorFlow, SensorNone, 4800, nil},
+		{"radiation", 3500, SensorRadiation, SensorNone, 3500, nil},
+		{"digital on", 1, SensorDigital, SensorNone, 1, nil},
+		{"digital off", 0, SensorDigital, SensorNone, 0, nil},
+		// configured type overrides the transmitted type
+		{"configured flow", 3500, SensorNone, SensorFlow, 14000, nil},
+		{"configured radiation", 3500, SensorTemperature, SensorRadiation, 3500, nil},
+		{"out of range", 3500, SensorNone, SensorNone, 350, ErrInvalidTemperature},
+		{"below range", -600, SensorTemperature, SensorNone, -60, ErrInvalidTemperature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := inputValue(tt.raw, tt.transmitted, tt.configured, DefaultScale)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if d := v - tt.want; d > 1e-9 || d < -1e-9 {
+				t.Errorf("got %v, want %v", v, tt.want)
+			}
+		})
+	}
+}
+
+func TestUVR42MixedInputs(t *testing.T) {
+	// temperature -5.0, flow 3500 (14000 l/h), radiation 900 W/m², digital on
+	b := uvr42Frame(0xffce, 3500, 900, 1, 0)
+
+	h := NewUVR42()
+	_ = h.Connect(&framesReader{frames: [][]byte{b, b}})
+
+	// without configured types all inputs are temperatures, the flow is out of range
+	if _, err := h.Get(); !errors.Is(err, ErrInvalidTemperature) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidTemperature)
+	}
+
+	h.SetInputTypes(SensorNone, SensorFlow, SensorRadiation, SensorDigital)
+	v, err := h.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := v.(UVR42Frame)
+	if f.Temperature1 != -5 || f.Temperature2 != 14000 || f.Temperature3 != 900 || f.Temperature4 != 1 {
+		t.Errorf("got %v %v %v %v, want -5 14000 900 1", f.Temperature1, f.Temperature2, f.Temperature3, f.Temperature4)
+	}
+}
+
+func TestParseSensorType(t *testing.T) {
+	for _, typ := range []SensorType{SensorNone, SensorDigital, SensorTemperature, SensorFlow, SensorRadiation, SensorRoom} {
+		if got, err := ParseSensorType(typ.String()); err != nil || got != typ {
+			t.Errorf("got %v %v of %q, want %v", got, err, typ.String(), typ)
+		}
+	}
+	if _, err := ParseSensorType("pt1000"); err == nil {
+		t.Error("got no error of an unsupported sensor type")
+	}
+}
@@ -0,0 +1,199 @@
+package datalogger
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// UVR1611Handler is the handler to read an uvr1611 dataframe.
+type UVR1611Handler struct {
+	io.ReadCloser
+	// inputTypes are the configured sensor types of the inputs, see SetInputTypes.
+	inputTypes []SensorType
+	// scale is the scaling of the temperatures, see SetScale.
+	scale Scale
+	// delimiter is the self-delimitation of the frames, see SetDelimiter.
+	delimiter Delimiter
+}
+
+// UVR1611Frame is the dataframe of an uvr1611 controller.
+// Inputs contains the scaled values of the inputs 1..16 (e.g. temperatures in °C, see SetInputTypes), unused inputs are 0.
+// SensorTypes contains the sensor type of each input.
+// Outputs contains the states of all outputs as bitmask (bit 0: output 1, ..., bit 12: output 13).
+// SpeedSteps contains the speed steps (0..30) of the outputs 1, 2, 6 and 7, the value -1 indicates an inactive speed control.
+// Unit is the unit of the temperatures, see SetScale.
+// Synthetic is true for an injected test frame, which wasn't received from the controller.
+type UVR1611Frame struct {
+	TimeStamp   time.Time
+	Inputs      [uvr1611Inputs]float64
+	SensorTypes [uvr1611Inputs]SensorType
+	Outputs     uint
+	SpeedSteps  [4]int
+	HeatMeters  [2]UVR1611HeatMeter
+	Unit        Unit `json:",omitempty"`
+	Synthetic   bool `json:",omitempty"`
+}
+
+// UVR1611HeatMeter is the heat meter of an uvr1611 controller.
+type UVR1611HeatMeter struct {
+	Active bool
+	// Power is the current power in kW.
+	Power float64
+	// Energy is the meter reading in kWh.
+	Energy float64
+}
+
+const (
+	// uvr1611Inputs is the count of inputs of the uvr1611
+	uvr1611Inputs = 16
+	// uvr1611Outputs is the count of outputs of the uvr1611
+	uvr1611Outputs = 13
+	// uvr1611Size is the frame size of the uvr1611 dataframe (incl. checksum)
+	uvr1611Size = 57
+)
+
+// UVR1611Profile describes the layout of the uvr1611 dataframe (UVR1611Frame), the elements of the arrays are numbered
+// from 1 (e.g. Inputs1, HeatMeters1.Power). The outputs are masked to the outputs 1..13 and the speed steps (bit 7: inactive)
+// are decoded by the handler, the checksum isn't a field of the frame.
+var UVR1611Profile = uvr1611Profile()
+
+// uvr1611Profile returns the profile of the uvr1611 dataframe, see decodeUVR1611.
+func uvr1611Profile() Profile {
+	p := Profile{DeviceID: uvr1611, Length: uvr1611Size, TypedInputs: true}
+	p.Fields = append(p.Fields, Field{Name: "TimeStamp", Kind: Time, Derived: true})
+	for i := 0; i < uvr1611Inputs; i++ {
+		p.Fields = append(p.Fields, Field{Name: fmt.Sprintf("Inputs%d", i+1), Kind: Input, Offset: 1 + 2*i})
+	}
+	for i := 0; i < uvr1611Inputs; i++ {
+		p.Fields = append(p.Fields, Field{Name: fmt.Sprintf("SensorTypes%d", i+1), Kind: Text, Derived: true})
+	}
+	p.Fields = append(p.Fields, Field{Name: "Outputs", Kind: Unsigned, Offset: 33, Size: 2})
+	for i := 0; i < 4; i++ {
+		p.Fields = append(p.Fields, Field{Name: fmt.Sprintf("SpeedSteps%d", i+1), Kind: Unsigned, Offset: 35 + i, Size: 1})
+	}
+	for i := 0; i < 2; i++ {
+		m := fmt.Sprintf("HeatMeters%d.", i+1)
+		p.Fields = append(p.Fields,
+			Field{Name: m + "Active", Kind: Digital, Offset: 39, Bit: i},
+			Field{Name: m + "Power", Kind: Analog, Offset: 40 + 8*i, Size: 4, Scale: 0.1, Unit: "kW"},
+			Field{Name: m + "Energy", Kind: Analog, Derived: true, Unit: "kWh"})
+	}
+	p.Fields = append(p.Fields,
+		Field{Name: "Unit", Kind: Text, Derived: true, Optional: true},
+		Field{Name: "Synthetic", Kind: Digital, Derived: true, Optional: true})
+	return p
+}
+
+// NewUVR1611 generate a new handler struct for UVR1611.
+func NewUVR1611() *UVR1611Handler {
+	return &UVR1611Handler{scale: DefaultScale}
+}
+
+// SetInputTypes defines the sensor types of the inputs 1..16, which override the transmitted sensor types.
+// The type SensorNone keeps the transmitted sensor type.
+func (h *UVR1611Handler) SetInputTypes(types ...SensorType) {
+	h.inputTypes = types
+}
+
+// SetScale defines the scaling of the transmitted temperatures, the default is DefaultScale.
+func (h *UVR1611Handler) SetScale(s Scale) {
+	h.scale = s
+}
+
+// SetDelimiter defines the self-delimitation of the received frames (see Delimiter), which is checked and removed
+// before the frame is decoded. The default disables the check.
+func (h *UVR1611Handler) SetDelimiter(d Delimiter) {
+	h.delimiter = d
+}
+
+// Connect defines the io.ReadWriterCloser
+func (h *UVR1611Handler) Connect(readCloser io.ReadCloser) error {
+	h.ReadCloser = readCloser
+	return nil
+}
+
+// Get reads the DL buffer, convert the buffer to an uvr1611 structure and check the values.
+// The temperature values are valid, if the current values are within a temperature range (tMax, tMin).
+func (h *UVR1611Handler) Get() (interface{}, error) {
+	b := make([]byte, 64)
+
+	n, err := h.Read(b)
+
+	if err != nil {
+		return UVR1611Frame{}, err
+	}
+
+	if b, err = h.delimiter.check(b[:n]); err != nil {
+		return UVR1611Frame{}, err
+	}
+
+	return decodeUVR1611(b, len(b), h.inputTypes, h.scale)
+}
+
+// decodeUVR1611 converts the read buffer b with a frame of size n to an uvr1611 structure and checks the values.
+// The values of the inputs are scaled and checked according to their sensor type (see inputValue),
+// types are the configured sensor types.
+//  byte 0:      device id
+//  byte 1..32:  inputs 1..16, 2 bytes each (little endian):
+//               bit 0..11: value, bit 12..14: sensor type, bit 15: sign (see decodeInput)
+//  byte 33..34: output states (little endian bitmask)
+//  byte 35..38: speed steps of the outputs 1, 2, 6 and 7 (bit 7: inactive)
+//  byte 39:     heat meter register (bit 0: heat meter 1 active, bit 1: heat meter 2 active)
+//  byte 40..47: heat meter 1: power (4 bytes, signed, 0.1 kW), energy (2 bytes 0.1 kWh, 2 bytes MWh)
+//  byte 48..55: heat meter 2
+//  byte 56:     checksum
+func decodeUVR1611(b []byte, n int, types []SensorType, s Scale) (UVR1611Frame, error) {
+	var f UVR1611Frame
+
+	if n != uvr1611Size {
+		return f, ErrInvalidSize
+	}
+
+	if b[0] != uvr1611 {
+		return f, UnsupportedDeviceError{Got: b[0]}
+	}
+
+	f.TimeStamp = time.Now()
+	f.Unit = s.Unit
+
+	var inputErr error
+	for i := range f.Inputs {
+		var raw int16
+		var err error
+		raw, f.SensorTypes[i] = decodeInput(b[1+2*i : 3+2*i])
+		if f.Inputs[i], err = inputValue(raw, f.SensorTypes[i], sensorType(types, i), s); err != nil {
+			inputErr = err
+		}
+	}
+
+	f.Outputs = uint(binary.LittleEndian.Uint16(b[33:35])) & (1<<uvr1611Outputs - 1)
+
+	for i := range f.SpeedSteps {
+		if s := b[35+i]; s&0x80 > 0 {
+			f.SpeedSteps[i] = -1
+		} else {
+			f.SpeedSteps[i] = int(s & 0x1f)
+		}
+	}
+
+	for i := range f.HeatMeters {
+		m := b[40+8*i : 48+8*i]
+		f.HeatMeters[i].Active = b[39]&(1<<i) > 0
+		f.HeatMeters[i].Power = float64(int32(binary.LittleEndian.Uint32(m[0:4]))) / 10
+		f.HeatMeters[i].Energy = float64(binary.LittleEndian.Uint16(m[4:6]))/10 + float64(binary.LittleEndian.Uint16(m[6:8]))*1000
+	}
+
+	return f, inputErr
+}
+
+// Restart discards the stale data frames, see DL.Restart.
+func (h *UVR1611Handler) Restart() error {
+	return restart(h.ReadCloser)
+}
+
+// Close the ReadCloser handler.
+func (h *UVR1611Handler) Close() error {
+	return nil
+}
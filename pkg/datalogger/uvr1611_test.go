@@ -0,0 +1,113 @@
+package datalogger
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// uvr1611Hex is an uvr1611 data frame in the layout of the DL-Bus specification (see decodeUVR1611).
+// It isn't a captured frame: no uvr1611 controller is available to capture a frame (e.g. by datalogger type raw),
+// so the frame is built from the layout of the specification, incl. its checksum, and has to be replaced by a capture
+// as soon as one is available.
+//  inputs 45.5 °C, 21.0 °C, -3.5 °C, 60.2 °C, 100 l/h, 800 W/m², digital on, room 22.5 °C, inputs 9..16 unused,
+//  outputs 1, 2 and 5, speed steps 30, inactive, 15, inactive,
+//  heat meter 1 active with 12.5 kW and 12345.6 kWh, heat meter 2 inactive, checksum
+const uvr1611Hex = `80 c7 21 d2 20 dd af 5a 22 19 30 20 63 01 10 e1 70 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+	13 00 1e 80 0f 80 01 7d 00 00 00 80 0d 0c 00 00 00 00 00 00 00 00 00 e7`
+
+// uvr1611Bytes returns the data frame of uvr1611Hex.
+func uvr1611Bytes(t *testing.T) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(strings.Join(strings.Fields(uvr1611Hex), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestUVR1611Handler(t *testing.T) {
+	b := uvr1611Bytes(t)
+	if len(b) != uvr1611Size {
+		t.Fatalf("got frame size %v, want %v", len(b), uvr1611Size)
+	}
+
+	h := NewUVR1611()
+	if err := h.Connect(&framesReader{frames: [][]byte{b}}); err != nil {
+		t.Fatal(err)
+	}
+	d, err := h.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, ok := d.(UVR1611Frame)
+	if !ok {
+		t.Fatalf("got frame %T, want UVR1611Frame", d)
+	}
+
+	wantInputs := [uvr1611Inputs]float64{45.5, 21, -3.5, 60.2, 100, 800, 1, 22.5}
+	if f.Inputs != wantInputs {
+		t.Errorf("got inputs %v, want %v", f.Inputs, wantInputs)
+	}
+	wantTypes := [uvr1611Inputs]SensorType{SensorTemperature, SensorTemperature, SensorTemperature, SensorTemperature,
+		SensorFlow, SensorRadiation, SensorDigital, SensorRoom}
+	if f.SensorTypes != wantTypes {
+		t.Errorf("got sensor types %v, want %v", f.SensorTypes, wantTypes)
+	}
+	if f.Outputs != 1<<0|1<<1|1<<4 {
+		t.Errorf("got outputs %013b, want outputs 1, 2 and 5", f.Outputs)
+	}
+	if want := [4]int{30, -1, 15, -1}; f.SpeedSteps != want {
+		t.Errorf("got speed steps %v, want %v", f.SpeedSteps, want)
+	}
+	if want := (UVR1611HeatMeter{Active: true, Power: 12.5, Energy: 12345.6}); f.HeatMeters[0] != want {
+		t.Errorf("got heat meter 1 %+v, want %+v", f.HeatMeters[0], want)
+	}
+	if f.HeatMeters[1] != (UVR1611HeatMeter{}) {
+		t.Errorf("got heat meter 2 %+v, want inactive", f.HeatMeters[1])
+	}
+
+	// the last byte is the checksum: the sum of all preceding bytes modulo 256
+	var sum byte
+	for _, v := range b[:len(b)-1] {
+		sum += v
+	}
+	if sum != b[len(b)-1] {
+		t.Errorf("got checksum 0x%02x, want 0x%02x", b[len(b)-1], sum)
+	}
+}
+
+func TestUVR1611InputTypes(t *testing.T) {
+	b := uvr1611Bytes(t)
+
+	// the configured type of input 5 overrides the transmitted flow sensor: the raw value 25 is 2.5 °C
+	f, err := decodeUVR1611(b, len(b), []SensorType{SensorNone, SensorNone, SensorNone, SensorNone, SensorTemperature}, DefaultScale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Inputs[0] != 45.5 || f.Inputs[4] != 2.5 {
+		t.Errorf("got inputs %v, want the configured temperature 2.5 of input 5", f.Inputs)
+	}
+}
+
+func TestDecodeUVR1611Errors(t *testing.T) {
+	b := uvr1611Bytes(t)
+
+	if _, err := decodeUVR1611(b, len(b)-1, nil, DefaultScale); !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("got error %v of a short frame, want %v", err, ErrInvalidSize)
+	}
+
+	other := append([]byte{uvr42}, b[1:]...)
+	if _, err := decodeUVR1611(other, len(other), nil, DefaultScale); !errors.As(err, &UnsupportedDeviceError{}) {
+		t.Errorf("got error %v of another device, want UnsupportedDeviceError", err)
+	}
+
+	// input 1: 310 °C is out of range
+	hot := append([]byte{}, b...)
+	hot[1], hot[2] = 0x1c, 0x2c
+	if _, err := decodeUVR1611(hot, len(hot), nil, DefaultScale); !errors.Is(err, ErrInvalidTemperature) {
+		t.Errorf("got error %v of a temperature out of range, want %v", err, ErrInvalidTemperature)
+	}
+}
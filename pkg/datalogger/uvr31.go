@@ -1,28 +1,48 @@
 package datalogger
 
 import (
-	"encoding/binary"
 	"io"
 	"time"
 )
 
-// UVR31Handler is the handler to read an uvr42 dataframe.
+// UVR31Handler is the handler to read an uvr31 dataframe.
 type UVR31Handler struct {
 	io.ReadCloser
+	// scale is the scaling of the temperatures, see SetScale.
+	scale Scale
+	// delimiter is the self-delimitation of the frames, see SetDelimiter.
+	delimiter Delimiter
 }
 
-// UVR31Frame is the dataframe of an uvr42 controller.
+// UVR31Frame is the dataframe of an uvr31 controller.
+// Outputs contains the states of all outputs as bitmask (bit 0: Out1).
+// Unit is the unit of the temperatures, see SetScale.
+// Synthetic is true for an injected test frame, which wasn't received from the controller.
 type UVR31Frame struct {
 	TimeStamp    time.Time
 	Temperature1 float64
 	Temperature2 float64
 	Temperature3 float64
 	Out1         bool
+	Outputs      uint
+	Unit         Unit `json:",omitempty"`
+	Synthetic    bool `json:",omitempty"`
 }
 
 // NewUVR31 generate a new handler struct for UVR31
-func NewUVR31() *UVR42Handler {
-	return &UVR42Handler{}
+func NewUVR31() *UVR31Handler {
+	return &UVR31Handler{scale: DefaultScale}
+}
+
+// SetScale defines the scaling of the transmitted temperatures, the default is DefaultScale.
+func (h *UVR31Handler) SetScale(s Scale) {
+	h.scale = s
+}
+
+// SetDelimiter defines the self-delimitation of the received frames (see Delimiter), which is checked and removed
+// before the frame is decoded. The default disables the check.
+func (h *UVR31Handler) SetDelimiter(d Delimiter) {
+	h.delimiter = d
 }
 
 // Connect defines the io.ReadWriterCloser
@@ -35,38 +55,63 @@ func (h *UVR31Handler) Connect(handler io.ReadCloser) error {
 // The temperature values are valid, if the current values are within a temperature range (tMax, tMin) and
 // the difference to the last measured values are less than maxDelta.
 func (h *UVR31Handler) Get() (interface{}, error) {
-	var f UVR31Frame
-	// bitmask of Out1
-	const out1 = 1 << 5
-
 	b := make([]byte, 64)
 
 	n, err := h.Read(b)
 
 	if err != nil {
-		return f, err
+		return UVR31Frame{}, err
 	}
 
-	if n != 8 {
-		return f, ErrInvalidSize
+	if b, err = h.delimiter.check(b[:n]); err != nil {
+		return UVR31Frame{}, err
 	}
 
-	if b[0] != uvr31 {
-		return f, ErrUnsupportedDevice
+	return decodeUVR31(b, len(b), h.scale)
+}
+
+// UVR31Profile describes the layout of the uvr31 dataframe (UVR31Frame), it's used by the handler to decode the frame.
+var UVR31Profile = Profile{
+	DeviceID: uvr31,
+	Length:   8,
+	Fields: []Field{
+		{Name: "TimeStamp", Kind: Time, Derived: true},
+		{Name: "Temperature1", Kind: Input, Offset: 1},
+		{Name: "Temperature2", Kind: Input, Offset: 3},
+		{Name: "Temperature3", Kind: Input, Offset: 5},
+		{Name: "Out1", Kind: Digital, Offset: 7, Bit: 5},
+		{Name: "Outputs", Kind: Unsigned, Derived: true},
+		{Name: "Unit", Kind: Text, Derived: true, Optional: true},
+		{Name: "Synthetic", Kind: Digital, Derived: true, Optional: true},
+	},
+}
+
+// decodeUVR31 converts the read buffer b with a frame of size n to an uvr31 structure by UVR31Profile and checks the values.
+//  byte 0:    device id
+//  byte 1..6: temperatures 1..3, 2 bytes each (little endian, scaled by s, default 0.1 °C)
+//  byte 7:    output states (bit 5: Out1)
+func decodeUVR31(b []byte, n int, s Scale) (UVR31Frame, error) {
+	var f UVR31Frame
+
+	d, tempErr := UVR31Profile.decode(b[:n], nil, s)
+	if d.values == nil {
+		return f, tempErr
 	}
 
 	f.TimeStamp = time.Now()
-	f.Temperature1 = float64(int16(binary.LittleEndian.Uint16(b[1:3]))) / 10
-	f.Temperature2 = float64(int16(binary.LittleEndian.Uint16(b[3:5]))) / 10
-	f.Temperature3 = float64(int16(binary.LittleEndian.Uint16(b[5:7]))) / 10
-	f.Out1 = b[9]&out1 > 0
-
-	if f.Temperature1 > tMax || f.Temperature2 > tMax || f.Temperature3 > tMax ||
-		f.Temperature1 < tMin || f.Temperature2 < tMin || f.Temperature3 < tMin {
-		return f, ErrInvalidTemperature
-	}
+	f.Unit = s.Unit
+	f.Temperature1 = d.values["Temperature1"].(float64)
+	f.Temperature2 = d.values["Temperature2"].(float64)
+	f.Temperature3 = d.values["Temperature3"].(float64)
+	f.Out1 = d.values["Out1"].(bool)
+	f.Outputs = outputMask(f.Out1)
+
+	return f, tempErr
+}
 
-	return f, nil
+// Restart discards the stale data frames, see DL.Restart.
+func (h *UVR31Handler) Restart() error {
+	return restart(h.ReadCloser)
 }
 
 // Close the ReadCloser handler.
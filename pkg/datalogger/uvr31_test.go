@@ -0,0 +1,58 @@
+package datalogger
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeUVR31Outputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       []byte
+		out1    bool
+		outputs uint
+	}{
+		// device id, temperatures 45.5, 21.0, -3.5 °C and the output byte
+		{"Out1 high", []byte{0x30, 0xc7, 0x01, 0xd2, 0x00, 0xdd, 0xff, 1 << 5}, true, 1},
+		{"Out1 low", []byte{0x30, 0xc7, 0x01, 0xd2, 0x00, 0xdd, 0xff, 0}, false, 0},
+		// the other bits of the output byte don't belong to Out1
+		{"other bits", []byte{0x30, 0xc7, 0x01, 0xd2, 0x00, 0xdd, 0xff, ^byte(1 << 5)}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewUVR31()
+			_ = h.Connect(&framesReader{frames: [][]byte{tt.b}})
+
+			v, err := h.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := v.(UVR31Frame)
+			if f.Out1 != tt.out1 || f.Outputs != tt.outputs {
+				t.Errorf("got Out1 %v outputs %v, want %v %v", f.Out1, f.Outputs, tt.out1, tt.outputs)
+			}
+			if f.Temperature1 != 45.5 || f.Temperature2 != 21 || f.Temperature3 != -3.5 {
+				t.Errorf("got temperatures %v %v %v, want 45.5 21 -3.5", f.Temperature1, f.Temperature2, f.Temperature3)
+			}
+		})
+	}
+}
+
+func TestDecodeUVR31Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{"without output byte", []byte{0x30, 0xc7, 0x01, 0xd2, 0x00, 0xdd, 0xff}, ErrInvalidSize},
+		{"too long", []byte{0x30, 0xc7, 0x01, 0xd2, 0x00, 0xdd, 0xff, 0, 0}, ErrInvalidSize},
+		{"uvr42 device", []byte{0x10, 0xc7, 0x01, 0xd2, 0x00, 0xdd, 0xff, 0}, UnsupportedDeviceError{Got: 0x10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeUVR31(tt.b, len(tt.b), DefaultScale); !errors.Is(err, tt.err) {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -1,18 +1,41 @@
 package datalogger
 
 import (
-	"encoding/binary"
-	"github.com/womat/debug"
 	"io"
+	"math"
 	"time"
+
+	"github.com/womat/debug"
 )
 
 // UVR42Handler is the handler to read an uvr42 dataframe.
 type UVR42Handler struct {
 	io.ReadCloser
+	// inputTypes are the configured sensor types of the inputs, see SetInputTypes.
+	inputTypes []SensorType
+	// maxDelta is the maximum difference of the values to the last values, see SetMaxDelta.
+	maxDelta float64
+	// scale is the scaling of the temperatures, see SetScale.
+	scale Scale
+	// typedInputs enables the decoding of the sensor types, see SetTypedInputs.
+	typedInputs bool
+	// delimiter is the self-delimitation of the frames, see SetDelimiter.
+	delimiter Delimiter
+	// last contains the values of the last accepted frame (nil if no frame has been read yet).
+	last []float64
+	// pending contains the values of the last rejected frame, which confirm a real step with the next frame.
+	pending []float64
 }
 
 // UVR42Frame is the dataframe of an uvr42 controller.
+// Outputs contains the states of all outputs as bitmask (bit 0: Out1, bit 1: Out2).
+// RotationSpeed is the speed step (0..30) of Out1, it's only transmitted by firmware versions with speed control
+// (frame size 11) and is nil otherwise or if the speed control is inactive.
+// SensorTypes contains the sensor type of the inputs 1..4, if typed inputs are enabled (see SetTypedInputs), otherwise it's nil.
+// Temperature1..4 are the scaled values of the inputs 1..4, which aren't temperatures for other sensor types
+// (e.g. volume flow in l/h), see SetInputTypes.
+// Unit is the unit of the temperatures, see SetScale.
+// Synthetic is true for an injected test frame, which wasn't received from the controller.
 type UVR42Frame struct {
 	TimeStamp     time.Time
 	Temperature1  float64
@@ -21,12 +44,78 @@ type UVR42Frame struct {
 	Temperature4  float64
 	Out1          bool
 	Out2          bool
-	RotationSpeed int
+	Outputs       uint
+	RotationSpeed *int         `json:",omitempty"`
+	SensorTypes   []SensorType `json:",omitempty"`
+	Unit          Unit         `json:",omitempty"`
+	Synthetic     bool         `json:",omitempty"`
+}
+
+// frame sizes of the uvr42 dataframe without and with rotation speed
+const (
+	uvr42Size      = 10
+	uvr42SpeedSize = 11
+)
+
+// UVR42Profile describes the layout of the uvr42 dataframe (UVR42Frame), it's used by the handler to decode the frame.
+// The speed byte of Out1 (bit 7: inactive speed control) is only transmitted by firmware versions with speed control.
+var UVR42Profile = Profile{
+	DeviceID: uvr42,
+	Length:   uvr42SpeedSize,
+	Fields: []Field{
+		{Name: "TimeStamp", Kind: Time, Derived: true},
+		{Name: "Temperature1", Kind: Input, Offset: 1},
+		{Name: "Temperature2", Kind: Input, Offset: 3},
+		{Name: "Temperature3", Kind: Input, Offset: 5},
+		{Name: "Temperature4", Kind: Input, Offset: 7},
+		{Name: "Out1", Kind: Digital, Offset: 9, Bit: 5},
+		{Name: "Out2", Kind: Digital, Offset: 9, Bit: 6},
+		{Name: "Outputs", Kind: Unsigned, Derived: true},
+		{Name: "RotationSpeed", Kind: Unsigned, Offset: 10, Size: 1, Optional: true},
+		{Name: "SensorTypes1", Kind: Text, Derived: true, Optional: true},
+		{Name: "SensorTypes2", Kind: Text, Derived: true, Optional: true},
+		{Name: "SensorTypes3", Kind: Text, Derived: true, Optional: true},
+		{Name: "SensorTypes4", Kind: Text, Derived: true, Optional: true},
+		{Name: "Unit", Kind: Text, Derived: true, Optional: true},
+		{Name: "Synthetic", Kind: Digital, Derived: true, Optional: true},
+	},
 }
 
 // NewUVR42 generate a new handler struct for UVR42.
 func NewUVR42() *UVR42Handler {
-	return &UVR42Handler{}
+	return &UVR42Handler{scale: DefaultScale, typedInputs: UVR42Profile.TypedInputs}
+}
+
+// SetTypedInputs enables the decoding of the sensor types in bit 12..14 of the inputs (see decodeInput),
+// which is only valid for firmware versions transmitting the sensor types. The default of UVR42Profile is disabled,
+// the inputs are signed 16 bit values.
+func (h *UVR42Handler) SetTypedInputs(enabled bool) {
+	h.typedInputs = enabled
+}
+
+// SetInputTypes defines the sensor types of the inputs 1..4, which override the transmitted sensor types.
+// The type SensorNone keeps the transmitted sensor type.
+func (h *UVR42Handler) SetInputTypes(types ...SensorType) {
+	h.inputTypes = types
+}
+
+// SetScale defines the scaling of the transmitted temperatures, the default is DefaultScale.
+func (h *UVR42Handler) SetScale(s Scale) {
+	h.scale = s
+}
+
+// SetMaxDelta defines the maximum difference of the values to the last values, the value 0 disables the check.
+// A frame with a larger difference (e.g. a single frame glitch) is rejected and the reference stays unchanged,
+// so a single glitch drops only one frame. A real step is accepted with the next frame, which is within maxDelta
+// to the rejected frame.
+func (h *UVR42Handler) SetMaxDelta(d float64) {
+	h.maxDelta = d
+}
+
+// SetDelimiter defines the self-delimitation of the received frames (see Delimiter), which is checked and removed
+// before the frame is decoded. The default disables the check.
+func (h *UVR42Handler) SetDelimiter(d Delimiter) {
+	h.delimiter = d
 }
 
 // Connect defines the io.ReadWriterCloser
@@ -39,45 +128,95 @@ func (h *UVR42Handler) Connect(readCloser io.ReadCloser) error {
 // The temperature values are valid, if the current values are within a temperature range (tMax, tMin) and
 // the difference to the last measured values are less than maxDelta.
 func (h *UVR42Handler) Get() (interface{}, error) {
-	var f UVR42Frame
-	// bitmask of Out1 and Out2
-	const out1 = 1 << 5
-	const out2 = 1 << 6
-
 	b := make([]byte, 64)
 
 	n, err := h.Read(b)
 
+	if err != nil {
+		return UVR42Frame{}, err
+	}
+
+	if b, err = h.delimiter.check(b[:n]); err != nil {
+		return UVR42Frame{}, err
+	}
+
+	f, err := decodeUVR42(b, len(b), h.typedInputs, h.inputTypes, h.scale)
 	if err != nil {
 		return f, err
 	}
 
-	if n != 10 {
-		return f, ErrInvalidSize
+	values := []float64{f.Temperature1, f.Temperature2, f.Temperature3, f.Temperature4}
+
+	if h.maxDelta > 0 && h.last != nil && exceedsDelta(values, h.last, h.maxDelta) {
+		// the step isn't confirmed by the rejected frame before
+		if h.pending == nil || exceedsDelta(values, h.pending, h.maxDelta) {
+			h.pending = values
+			debug.ErrorLog.Printf("difference to the last value exceeds %v: %+v", h.maxDelta, f)
+			return f, ErrInvalidDelta
+		}
+	}
+
+	h.last, h.pending = values, nil
+	return f, nil
+}
+
+// exceedsDelta returns true, if the difference of any value to the reference value exceeds max.
+func exceedsDelta(values, ref []float64, max float64) bool {
+	for i, v := range values {
+		if math.Abs(v-ref[i]) > max {
+			return true
+		}
 	}
+	return false
+}
+
+// decodeUVR42 converts the read buffer b with a frame of size n to an uvr42 structure by UVR42Profile and checks the values.
+// The values of the inputs are scaled and checked according to their sensor type (see inputValue),
+// the transmitted sensor types are only decoded if typed is true, types are the configured sensor types.
+func decodeUVR42(b []byte, n int, typed bool, types []SensorType, s Scale) (UVR42Frame, error) {
+	var f UVR42Frame
 
-	if b[0] != uvr42 {
-		return f, ErrUnsupportedDevice
+	p := UVR42Profile
+	p.TypedInputs = typed
+	d, inputErr := p.decode(b[:n], types, s)
+	if d.values == nil {
+		return f, inputErr
 	}
 
 	f.TimeStamp = time.Now()
-	f.Temperature1 = float64(int16(binary.LittleEndian.Uint16(b[1:3]))) / 10
-	f.Temperature2 = float64(int16(binary.LittleEndian.Uint16(b[3:5]))) / 10
-	f.Temperature3 = float64(int16(binary.LittleEndian.Uint16(b[5:7]))) / 10
-	f.Temperature4 = float64(int16(binary.LittleEndian.Uint16(b[7:9]))) / 10
-
-	f.Out1 = b[9]&out1 > 0
-	f.Out2 = b[9]&out2 > 0
+	f.Unit = s.Unit
+	f.Temperature1 = d.values["Temperature1"].(float64)
+	f.Temperature2 = d.values["Temperature2"].(float64)
+	f.Temperature3 = d.values["Temperature3"].(float64)
+	f.Temperature4 = d.values["Temperature4"].(float64)
+	f.SensorTypes = d.sensors
+
+	f.Out1 = d.values["Out1"].(bool)
+	f.Out2 = d.values["Out2"].(bool)
+	f.Outputs = outputMask(f.Out1, f.Out2)
+
+	// bit 7 of the speed byte indicates an inactive speed control
+	if s, ok := d.values["RotationSpeed"].(int); ok && s&0x80 == 0 {
+		if s > maxSpeedStep {
+			return f, ErrInvalidRotationSpeed
+		}
+		f.RotationSpeed = &s
+	}
 
-	if f.Temperature1 > tMax || f.Temperature2 > tMax || f.Temperature3 > tMax || f.Temperature4 > tMax ||
-		f.Temperature1 < tMin || f.Temperature2 < tMin || f.Temperature3 < tMin || f.Temperature4 < tMin {
+	if inputErr != nil {
 		debug.ErrorLog.Printf("%+v", f)
-		return f, ErrInvalidTemperature
+		return f, inputErr
 	}
 
 	return f, nil
 }
 
+// Restart discards the stale data frames and the last values, see DL.Restart.
+func (h *UVR42Handler) Restart() error {
+	h.last, h.pending = nil, nil
+	return restart(h.ReadCloser)
+}
+
 // Close the ReadCloser handler.
 func (h *UVR42Handler) Close() error {
 	return nil
@@ -0,0 +1,247 @@
+package datalogger
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// framesReader is an io.ReadCloser, which returns one of the data frames per Read.
+type framesReader struct {
+	frames [][]byte
+	// closed is true, if the reader is closed.
+	closed bool
+}
+
+func (r *framesReader) Read(b []byte) (int, error) {
+	if len(r.frames) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, r.frames[0])
+	r.frames = r.frames[1:]
+	return n, nil
+}
+
+func (r *framesReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+// uvr42Frame returns an uvr42 data frame of the raw input values and the output byte.
+func uvr42Frame(in1, in2, in3, in4 uint16, outputs byte) []byte {
+	b := []byte{uvr42}
+	for _, v := range []uint16{in1, in2, in3, in4} {
+		b = append(b, byte(v), byte(v>>8))
+	}
+	return append(b, outputs)
+}
+
+func TestDecodeUVR42TypedInputs(t *testing.T) {
+	// temperature 45.5, flow 25 (100 l/h), radiation 800, temperature -2.0 (sign bit + 12 bit two's complement)
+	b := uvr42Frame(0x2000|455, 0x3000|25, 0x6000|800, 0x8000|0x2000|0x0fec, 1<<5)
+
+	f, err := decodeUVR42(b, len(b), true, nil, DefaultScale)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SensorType{SensorTemperature, SensorFlow, SensorRadiation, SensorTemperature}
+	if !reflect.DeepEqual(f.SensorTypes, want) {
+		t.Errorf("got sensor types %v, want %v", f.SensorTypes, want)
+	}
+	if got := []float64{f.Temperature1, f.Temperature2, f.Temperature3, f.Temperature4}; !reflect.DeepEqual(got, []float64{45.5, 100, 800, -2}) {
+		t.Errorf("got values %v, want [45.5 100 800 -2]", got)
+	}
+	if !f.Out1 || f.Out2 || f.Outputs != 1 {
+		t.Errorf("got outputs %v %v %v, want true false 1", f.Out1, f.Out2, f.Outputs)
+	}
+}
+
+func TestDecodeUVR42UntypedInputs(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   uint16
+		scale Scale
+		want  float64
+	}{
+		{"positive", 455, DefaultScale, 45.5},
+		{"negative", 0xffce, DefaultScale, -5},
+		{"negative small", 0xfffb, DefaultScale, -0.5},
+		// value with more than 12 bits, it's valid in kelvin (163.85 °C)
+		{"above 12 bit", 0x1112, Scale{Factor: 0.1, Unit: Kelvin}, 437},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := uvr42Frame(tt.raw, tt.raw, tt.raw, tt.raw, 0)
+			f, err := decodeUVR42(b, len(b), false, nil, tt.scale)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := f.Temperature1 - tt.want; d > 1e-9 || d < -1e-9 {
+				t.Errorf("got %v, want %v", f.Temperature1, tt.want)
+			}
+			if f.SensorTypes != nil {
+				t.Errorf("got sensor types %v, want nil", f.SensorTypes)
+			}
+		})
+	}
+}
+
+func TestUVR42HandlerTypedInputs(t *testing.T) {
+	// -5.0 °C is room (type 7) if decoded as typed input
+	b := uvr42Frame(0xffce, 0, 0, 0, 0)
+
+	h := NewUVR42()
+	_ = h.Connect(&framesReader{frames: [][]byte{b, b}})
+
+	v, err := h.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := v.(UVR42Frame); f.Temperature1 != -5 || f.SensorTypes != nil {
+		t.Errorf("got %v %v by default, want -5 without sensor types", f.Temperature1, f.SensorTypes)
+	}
+
+	h.SetTypedInputs(true)
+	if v, err = h.Get(); err != nil {
+		t.Fatal(err)
+	}
+	if f := v.(UVR42Frame); f.SensorTypes[0] != SensorRoom {
+		t.Errorf("got sensor type %v with typed inputs, want %v", f.SensorTypes[0], SensorRoom)
+	}
+}
+
+func TestUVR42HandlerRotationSpeed(t *testing.T) {
+	frame := func(speed byte) []byte { return append(uvr42Frame(455, 210, 210, 210, 1<<5), speed) }
+
+	h := NewUVR42()
+	_ = h.Connect(&framesReader{frames: [][]byte{frame(0), frame(maxSpeedStep), frame(maxSpeedStep + 1), frame(0x7f)}})
+
+	// the speed steps 0..30 are valid
+	for _, want := range []int{0, maxSpeedStep} {
+		v, err := h.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f := v.(UVR42Frame); f.RotationSpeed == nil || *f.RotationSpeed != want {
+			t.Errorf("got rotation speed %v, want %v", f.RotationSpeed, want)
+		}
+	}
+
+	for _, speed := range []int{maxSpeedStep + 1, 0x7f} {
+		if _, err := h.Get(); !errors.Is(err, ErrInvalidRotationSpeed) {
+			t.Errorf("got error %v of rotation speed %v, want %v", err, speed, ErrInvalidRotationSpeed)
+		}
+	}
+}
+
+func TestDecodeUVR42Errors(t *testing.T) {
+	b := uvr42Frame(455, 0, 0, 0, 0)
+	if _, err := decodeUVR42(b, 9, false, nil, DefaultScale); !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("got error %v of a short frame, want %v", err, ErrInvalidSize)
+	}
+
+	b[0] = uvr31
+	var e UnsupportedDeviceError
+	if _, err := decodeUVR42(b, len(b), false, nil, DefaultScale); !errors.As(err, &e) || e.Got != uvr31 {
+		t.Errorf("got error %v of a foreign device, want UnsupportedDeviceError", err)
+	}
+}
+
+func TestDecodeUVR42RotationSpeed(t *testing.T) {
+	speed := func(s int) *int { return &s }
+
+	tests := []struct {
+		name  string
+		b     []byte
+		speed *int
+		err   error
+	}{
+		{"without rotation speed", uvr42Frame(455, 210, 210, 210, 1<<5), nil, nil},
+		{"with rotation speed", append(uvr42Frame(455, 210, 210, 210, 1<<5), 17), speed(17), nil},
+		{"with rotation speed 0", append(uvr42Frame(455, 210, 210, 210, 1<<5), 0), speed(0), nil},
+		{"inactive speed control", append(uvr42Frame(455, 210, 210, 210, 1<<5), 0x80|17), nil, nil},
+		{"invalid rotation speed", append(uvr42Frame(455, 210, 210, 210, 1<<5), 31), nil, ErrInvalidRotationSpeed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := decodeUVR42(tt.b, len(tt.b), false, nil, DefaultScale)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(f.RotationSpeed, tt.speed) {
+				t.Errorf("got rotation speed %v, want %v", f.RotationSpeed, tt.speed)
+			}
+
+			b, err := json.Marshal(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var m map[string]interface{}
+			if err = json.Unmarshal(b, &m); err != nil {
+				t.Fatal(err)
+			}
+			v, ok := m["RotationSpeed"]
+			switch {
+			case tt.speed == nil && ok:
+				t.Errorf("got rotation speed %v in %s, want the field omitted", v, b)
+			case tt.speed != nil && v != float64(*tt.speed):
+				t.Errorf("got rotation speed %v in %s, want %v", v, b, *tt.speed)
+			}
+		})
+	}
+}
+
+func TestUVR42MaxDelta(t *testing.T) {
+	// values in 0.1 °C of the temperature 1
+	tests := []struct {
+		name   string
+		values []uint16
+		errs   []error
+	}{
+		{"stable", []uint16{400, 410, 420}, []error{nil, nil, nil}},
+		{"single glitch", []uint16{400, 900, 405, 410}, []error{nil, ErrInvalidDelta, nil, nil}},
+		{"real step", []uint16{400, 900, 905, 910}, []error{nil, ErrInvalidDelta, nil, nil}},
+		{"two glitches", []uint16{400, 900, 100, 405}, []error{nil, ErrInvalidDelta, ErrInvalidDelta, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &framesReader{}
+			for _, v := range tt.values {
+				r.frames = append(r.frames, uvr42Frame(v, 0, 0, 0, 0))
+			}
+
+			h := NewUVR42()
+			h.SetMaxDelta(10)
+			_ = h.Connect(r)
+
+			for i, want := range tt.errs {
+				if _, err := h.Get(); !errors.Is(err, want) {
+					t.Errorf("frame %v: got error %v, want %v", i, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUVR42MaxDeltaRestart(t *testing.T) {
+	h := NewUVR42()
+	h.SetMaxDelta(10)
+	_ = h.Connect(&framesReader{frames: [][]byte{uvr42Frame(400, 0, 0, 0, 0), uvr42Frame(900, 0, 0, 0, 0)}})
+
+	if _, err := h.Get(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	// the restart discards the last values, the first frame after the restart is accepted
+	if _, err := h.Get(); err != nil {
+		t.Errorf("got error %v after restart, want nil", err)
+	}
+}
@@ -4,7 +4,9 @@ package dlbus
 import (
 	"io"
 	"sync"
+	"sync/atomic"
 	"tadl/pkg/port"
+	"time"
 
 	"github.com/womat/debug"
 )
@@ -16,90 +18,287 @@ const (
 	synchronized
 )
 
+const (
+	// syncBits is the count of high bits of a sync sequence.
+	syncBits = 16
+	// framesBuffer is the number of completed frames buffered in the frames channel.
+	framesBuffer = 4
+	// defaultQueueSize is the default number of completed frames queued for Read.
+	defaultQueueSize = 8
+	// defaultMaxFrameLen is the default maximum size of a frame in bytes.
+	defaultMaxFrameLen = 64
+)
+
+// BitOrder is the order of the data bits within a byte.
+type BitOrder int
+
+const (
+	// LSBFirst sends the least significant bit first (default of the DL-Bus).
+	LSBFirst BitOrder = iota
+	// MSBFirst sends the most significant bit first.
+	MSBFirst
+)
+
+// FrameFormat defines the polarity of the framing bits.
+// The sync sequence (idle line) has the level of the stop bit.
+type FrameFormat struct {
+	// StartBit is the level of the start bit.
+	StartBit port.StateType
+	// StopBit is the level of the stop bit and the sync sequence.
+	StopBit port.StateType
+}
+
+var (
+	// DefaultFrameFormat is the frame format of the DL-Bus: start bit low, stop bit and sync high.
+	DefaultFrameFormat = FrameFormat{StartBit: port.Low, StopBit: port.High}
+	// InvertedFrameFormat is the frame format with inverted polarity: start bit high, stop bit and sync low.
+	InvertedFrameFormat = FrameFormat{StartBit: port.High, StopBit: port.Low}
+)
+
+// valid checks that the start and the stop bit are different levels.
+func (f FrameFormat) valid() bool {
+	return (f.StartBit == port.Low || f.StartBit == port.High) && (f.StopBit == port.Low || f.StopBit == port.High) &&
+		f.StartBit != f.StopBit
+}
+
 // stateType represents the state of the decoding process.
 type stateType int
 
 // ReadCloser contains the handler to read data from the dl bus.
 type ReadCloser struct {
+	// rejected is the count of frames rejected by the checksum validation, updated atomically.
+	// It's the first field to guarantee the 64-bit alignment on 32-bit platforms.
+	rejected uint64
+	// syncTimeouts is the count of sync timeouts, updated atomically.
+	syncTimeouts uint64
+	// dropped is the count of frames dropped from the full queue, updated atomically.
+	dropped uint64
+	// frameCount is the count of received frames, updated atomically.
+	frameCount uint64
+	// syncTimeout resets the decoding, if no complete frame is received within the timeout (0 disables the timeout).
+	syncTimeout time.Duration
+	// syncTimer is the timer of the sync timeout, it's only accessed by the run() goroutine.
+	syncTimer *time.Timer
+	// frameTimeout discards a partial frame, if no bit is received within the timeout (0 disables the timeout).
+	frameTimeout time.Duration
+	// frameTimer is the timer of the frame timeout, it's only accessed by the run() goroutine.
+	frameTimer *time.Timer
+	// checksum enables the checksum validation of the frames.
+	checksum bool
+	// maxFrameLen is the maximum size of a frame in bytes.
+	maxFrameLen int
+	// bitOrder is the order of the data bits within a byte.
+	bitOrder BitOrder
+	// format is the polarity of the framing bits.
+	format FrameFormat
 	// syncCounter is the count of consecutive high bits.
 	syncCounter int
 	// state contains the current decoding state (synchronizing/synchronized).
+	// It's only accessed by the run() goroutine.
 	state stateType
+	// synced is 1 if the state is synchronized, it's read atomically by Status.
+	synced int32
 	// rx channel receives data stream from manchester code.
 	rx chan port.StateType
 	// rxBit is the number of the currently received bit of the rxRegister.
 	rxBit int
 	// rxRegister is the buffer of the currently received byte.
 	rxRegister byte
-	// rxBuffer is the received data record between two syncs.
+	// rxBuffer is the received data record between two syncs, it's only accessed by the run() goroutine.
 	rxBuffer []byte
-	// rl lock the rxBuffer until data are received.
-	rl sync.Mutex
+	// queue contains the completed frames (oldest first), which are not read yet.
+	queue [][]byte
+	// queueSize is the maximum number of queued frames.
+	queueSize int
+	// lastFrame is the receive time of the last frame, it's locked by ql.
+	lastFrame time.Time
+	// ql locks the queue.
+	ql sync.Mutex
+	// frames delivers a copy of each completed frame.
+	frames chan []byte
 	// quit stops the handler
-	quit chan bool
+	quit chan struct{}
+	// closeOnce guarantees that quit is closed only once.
+	closeOnce sync.Once
 	// done signals that handler is stopped
-	done chan bool
+	done chan struct{}
 }
 
 // NewReader initials a new dlbus handler
 func NewReader(c chan port.StateType) *ReadCloser {
+	r, _ := NewReaderWithOptions(c)
+	return r
+}
+
+// NewReaderWithOptions initials a new dlbus handler configured by options.
+func NewReaderWithOptions(c chan port.StateType, opts ...Option) (*ReadCloser, error) {
 	h := ReadCloser{
-		state:    synchronizing,
-		rxBuffer: []byte{},
-		rl:       sync.Mutex{},
-		rx:       c,
-		done:     make(chan bool),
-		quit:     make(chan bool),
+		state:       synchronizing,
+		maxFrameLen: defaultMaxFrameLen,
+		format:      DefaultFrameFormat,
+		rxBuffer:    []byte{},
+		queueSize:   defaultQueueSize,
+		rx:          c,
+		frames:      make(chan []byte, framesBuffer),
+		done:        make(chan struct{}),
+		quit:        make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		if err := opt(&h); err != nil {
+			return nil, err
+		}
 	}
 
 	go h.run()
 
-	return &h
+	return &h, nil
+}
+
+// Rejected returns the count of frames rejected by the checksum validation.
+func (r *ReadCloser) Rejected() uint64 {
+	return atomic.LoadUint64(&r.rejected)
+}
+
+// SyncTimeouts returns the count of sync timeouts, see WithSyncTimeout.
+func (r *ReadCloser) SyncTimeouts() uint64 {
+	return atomic.LoadUint64(&r.syncTimeouts)
+}
+
+// Frames returns a channel, which delivers a copy of each completed frame as soon as the trailing sync is detected.
+//  If the consumer is too slow and the channel buffer is full, the frame is dropped from the channel
+//  (it's still queued for Read). The channel is closed, if the handler is closed.
+func (r *ReadCloser) Frames() <-chan []byte {
+	return r.frames
+}
+
+// Status returns whether the dlbus is synchronized, the receive time of the last frame and the count of received frames.
+// It is safe to call Status concurrently to the running handler.
+func (r *ReadCloser) Status() (synced bool, lastFrame time.Time, frameCount uint64) {
+	r.ql.Lock()
+	lastFrame = r.lastFrame
+	r.ql.Unlock()
+
+	return atomic.LoadInt32(&r.synced) == 1, lastFrame, atomic.LoadUint64(&r.frameCount)
 }
 
-// Read the current dlbus frame (data before last sync).
+// setState sets the decoding state.
+func (r *ReadCloser) setState(s stateType) {
+	r.state = s
+
+	var synced int32
+	if s == synchronized {
+		synced = 1
+	}
+	atomic.StoreInt32(&r.synced, synced)
+}
+
+// Dropped returns the count of frames dropped from the full queue, see WithQueueSize.
+func (r *ReadCloser) Dropped() uint64 {
+	return atomic.LoadUint64(&r.dropped)
+}
+
+// Read the oldest completed dlbus frame, which is not read yet.
+//  If no frame is queued, io.EOF is returned.
 func (r *ReadCloser) Read(b []byte) (int, error) {
-	r.rl.Lock()
-	defer r.rl.Unlock()
+	r.ql.Lock()
+	defer r.ql.Unlock()
 
-	if len(r.rxBuffer) == 0 {
+	if len(r.queue) == 0 {
 		return 0, io.EOF
 	}
-	n := copy(b, r.rxBuffer)
-	r.rxBuffer = r.rxBuffer[0:0]
+	n := copy(b, r.queue[0])
+	r.queue = r.queue[1:]
 
 	return n, nil
 }
 
-// Close stops listening dl bus >> stop watching raspberry pin and stops m.service() because of close(m.rx) channel.
-func (r *ReadCloser) Close() error {
-	r.rxBuffer = []byte{}
+// Reset discards all queued frames, which are not read yet.
+func (r *ReadCloser) Reset() {
+	r.ql.Lock()
+	defer r.ql.Unlock()
+	r.queue = nil
+}
+
+// enqueue adds a completed frame to the queue.
+//  If the queue is full, the oldest frame is dropped, so the decoding is never blocked by a slow reader
+//  and the reader always gets the most recent frames.
+func (r *ReadCloser) enqueue(frame []byte) {
+	atomic.AddUint64(&r.frameCount, 1)
 
-	if r.state == synchronized {
-		r.rl.Unlock()
+	r.ql.Lock()
+	defer r.ql.Unlock()
+
+	r.lastFrame = time.Now()
+	if len(r.queue) >= r.queueSize {
+		debug.WarningLog.Print("dlbus frame queue is full, oldest frame dropped")
+		atomic.AddUint64(&r.dropped, 1)
+		r.queue = r.queue[1:]
 	}
+	r.queue = append(r.queue, frame)
+}
 
-	r.quit <- true
+// Close stops listening dl bus. It signals run() to stop and waits until run() is terminated.
+//  Close can be called several times.
+func (r *ReadCloser) Close() error {
+	r.closeOnce.Do(func() { close(r.quit) })
 
 	// wait until run() is terminated
 	<-r.done
-	close(r.quit)
-	close(r.done)
+
+	r.ql.Lock()
+	r.queue = nil
+	r.ql.Unlock()
 
 	return nil
 }
 
 // run receives incoming bits on channel rx. Handle the sync sequence and receive byte for byte to rxBuffer.
+//  run stops, if the handler is closed or the channel rx is closed.
 func (r *ReadCloser) run() {
+	defer func() {
+		if r.syncTimer != nil {
+			r.syncTimer.Stop()
+		}
+		if r.frameTimer != nil {
+			r.frameTimer.Stop()
+		}
+		close(r.frames)
+		close(r.done)
+	}()
+
+	// timeout is nil (blocks forever), if the sync timeout is disabled
+	var timeout <-chan time.Time
+	if r.syncTimeout > 0 {
+		r.syncTimer = time.NewTimer(r.syncTimeout)
+		timeout = r.syncTimer.C
+	}
+
+	// frameTimeout is nil (blocks forever), if the frame timeout is disabled
+	var frameTimeout <-chan time.Time
+	if r.frameTimeout > 0 {
+		r.frameTimer = time.NewTimer(r.frameTimeout)
+		frameTimeout = r.frameTimer.C
+	}
+
 	for {
 		select {
 		case <-r.quit:
-			r.done <- true
 			return
+		case <-timeout:
+			debug.WarningLog.Printf("no dlbus frame received within %v, wait for dlbus sync", r.syncTimeout)
+			atomic.AddUint64(&r.syncTimeouts, 1)
+			r.reset()
+			r.syncTimer.Reset(r.syncTimeout)
+		case <-frameTimeout:
+			// the timer is restarted by the next bit
+			if r.state == synchronized {
+				debug.WarningLog.Printf("dlbus frame stalled for %v, partial frame discarded: %v", r.frameTimeout, r.rxBuffer)
+				r.reset()
+			}
 		case b, open := <-r.rx:
 			if !open {
-				r.quit <- true
-				continue
+				return
 			}
 
 			switch b {
@@ -109,6 +308,10 @@ func (r *ReadCloser) run() {
 			case port.High, port.Low:
 				r.decoder(b)
 			}
+
+			if r.frameTimer != nil {
+				restartTimer(r.frameTimer, r.frameTimeout)
+			}
 		}
 	}
 }
@@ -118,73 +321,127 @@ func (r *ReadCloser) reset() {
 	r.rxBuffer = r.rxBuffer[0:0]
 	r.syncCounter = 0
 
-	if r.state == synchronized {
-		r.rl.Unlock()
-		r.state = synchronizing
-	}
+	r.setState(synchronizing)
 }
 
 // decoder decodes the dlbus dataframe
 //  the dataframe starts and ends with 16 high bits (sync).
-//  each data byte consists of one start bit (low), eight dat bits (LSB first) and one stop bit (high)
+//  each data byte consists of one start bit (low), eight dat bits (LSB first, see WithBitOrder) and one stop bit (high)
+//  The polarity of the sync, start and stop bits is defined by the frame format (see WithFrameFormat).
 func (r *ReadCloser) decoder(bit port.StateType) {
 	switch r.state {
 	case synchronizing:
 		switch bit {
-		case port.High:
+		case r.format.StopBit:
 			r.syncCounter++
-		case port.Low:
-			if r.syncCounter < 16 {
+		case r.format.StartBit:
+			if r.syncCounter < syncBits {
 				r.syncCounter = 0
 				return
 			}
 
 			// it looks like a start bit after sync
-			r.rl.Lock()
-			r.state = synchronized
+			r.setState(synchronized)
 			r.rxBit = 0
 			r.rxBuffer = r.rxBuffer[0:0]
-			r.low()
+			r.low(bit)
 		}
 
 	case synchronized:
 		switch bit {
-		case port.High:
-			r.high()
-		case port.Low:
-			r.low()
+		case r.format.StopBit:
+			r.high(bit)
+		case r.format.StartBit:
+			r.low(bit)
 		}
 	}
 }
 
-// high handles high data bits, stop bits and recognizes a starting sync sequence.
+// high handles data bits with the level of the stop bit (high by default), stop bits
+// and recognizes a starting sync sequence.
 // data bits fills the rxRegister.
 // The stop bit competes the rxRegister and add it to the rxBuffer.
 // If a sync sequence starts, the rxBuffer is competed.
-func (r *ReadCloser) high() {
+func (r *ReadCloser) high(bit port.StateType) {
 	switch r.rxBit {
 	case 0:
 		// if the first bit is high (no start bit), the dataframe is complete and a new sync sequence starts
-		// release (unlock) the rxBuffer for reader.
+		// queue the rxBuffer for reader.
 		debug.TraceLog.Printf("rxBuffer: %v", r.rxBuffer)
-		r.state = synchronizing
+		if r.checksum && !validChecksum(r.rxBuffer) {
+			debug.ErrorLog.Printf("invalid checksum, frame dropped: %v", r.rxBuffer)
+			atomic.AddUint64(&r.rejected, 1)
+			r.rxBuffer = r.rxBuffer[0:0]
+		}
+		r.setState(synchronizing)
 		r.syncCounter = 1
-		r.rl.Unlock()
+		if len(r.rxBuffer) > 0 {
+			frame := append([]byte(nil), r.rxBuffer...)
+			r.enqueue(frame)
+			r.notify(frame)
+		}
 	case 9:
 		// stop bit received
+		if len(r.rxBuffer) >= r.maxFrameLen {
+			debug.ErrorLog.Printf("frame exceeds %v bytes, wait for dlbus sync", r.maxFrameLen)
+			r.reset()
+			return
+		}
 		r.rxBuffer = append(r.rxBuffer, r.rxRegister)
 		r.rxBit = 0
 	default:
-		// data bit received and set bit in register
-		r.rxRegister |= 1 << (r.rxBit - 1)
-		r.rxBit++
+		r.data(bit)
+	}
+}
+
+// data sets the received data bit in the register.
+func (r *ReadCloser) data(bit port.StateType) {
+	if bit == port.High {
+		r.rxRegister |= 1 << bitIndex(r.bitOrder, r.rxBit-1)
+	}
+	r.rxBit++
+}
+
+// notify sends a completed frame to the frames channel without blocking the decoding.
+func (r *ReadCloser) notify(frame []byte) {
+	if len(frame) == 0 {
+		return
+	}
+
+	if r.syncTimer != nil {
+		restartTimer(r.syncTimer, r.syncTimeout)
+	}
+
+	select {
+	case r.frames <- frame:
+	default:
+		debug.WarningLog.Print("frames channel is full, frame notification dropped")
 	}
 }
 
-// low handles start bits and low data bits.
+// bitIndex returns the index of the i-th received data bit (0..7) in the byte.
+func bitIndex(o BitOrder, i int) uint {
+	if o == MSBFirst {
+		return uint(7 - i)
+	}
+	return uint(i)
+}
+
+// restartTimer stops the timer, drains its channel and restarts it with the duration d.
+func restartTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+// low handles start bits and data bits with the level of the start bit (low by default).
 // data bits fills the rxRegister.
 // the start bit clears the rxRegister
-func (r *ReadCloser) low() {
+func (r *ReadCloser) low(bit port.StateType) {
 	switch r.rxBit {
 	case 0:
 		// start bit received
@@ -195,6 +452,21 @@ func (r *ReadCloser) low() {
 		debug.WarningLog.Print("missing stop bit, wait for dlbus sync")
 		r.reset()
 	default:
-		r.rxBit++
+		r.data(bit)
+	}
+}
+
+// validChecksum checks the checksum (last byte) of the frame,
+// the checksum is the sum of all preceding bytes modulo 256.
+func validChecksum(frame []byte) bool {
+	if len(frame) < 2 {
+		return false
 	}
+
+	var sum byte
+	for _, b := range frame[:len(frame)-1] {
+		sum += b
+	}
+
+	return sum == frame[len(frame)-1]
 }
@@ -0,0 +1,252 @@
+package dlbus
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"tadl/pkg/port"
+)
+
+// frameBits returns the bit stream of the data frame b (incl. the leading and trailing sync), see WriteCloser.
+func frameBits(t *testing.T, b []byte) []port.StateType {
+	t.Helper()
+
+	c := make(chan port.StateType, 2*syncBits+10*len(b))
+	w := NewWriter(c)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+
+	var bits []port.StateType
+	for s := range c {
+		bits = append(bits, s)
+	}
+	return bits
+}
+
+// readFrames returns the frames, which are read within the timeout.
+func readFrames(r *ReadCloser, timeout time.Duration) [][]byte {
+	var frames [][]byte
+	b := make([]byte, 64)
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if n, err := r.Read(b); err == nil {
+			frames = append(frames, append([]byte(nil), b[:n]...))
+		}
+	}
+	return frames
+}
+
+func TestFrameTimeout(t *testing.T) {
+	a := []byte{0x10, 1, 2, 3, 4, 5}
+	b := []byte{0x10, 11, 12, 13, 14, 15}
+	c := []byte{0x10, 21, 22, 23, 24, 25}
+
+	// the frame a stalls after 3 bytes, the line continues with the tail of frame b
+	head := frameBits(t, a)[:syncBits+3*10]
+	tail := frameBits(t, b)[syncBits+3*10:]
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		want    [][]byte
+	}{
+		{"with frame timeout", 20 * time.Millisecond, [][]byte{c}},
+		// the partial frame is completed by the tail of another frame
+		{"without frame timeout", 0, [][]byte{{0x10, 1, 2, 13, 14, 15}, c}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rx := make(chan port.StateType)
+			r, err := NewReaderWithOptions(rx, WithFrameTimeout(tt.timeout))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			for _, s := range head {
+				rx <- s
+			}
+			time.Sleep(3 * tt.timeout / 2)
+			if tt.timeout > 0 {
+				// the partial frame is discarded by the stalled line
+				if synced, _, _ := r.Status(); synced {
+					t.Error("got synchronized after the frame timeout, want waiting for sync")
+				}
+			}
+			for _, s := range append(tail, frameBits(t, c)...) {
+				rx <- s
+			}
+
+			if got := readFrames(r, 50*time.Millisecond); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got frames %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCloserStress(t *testing.T) {
+	frame := []byte{0x10, 0xc7, 0x01, 0xd2, 0x00, 0xd2, 0x00, 0xd2, 0x00, 0}
+
+	// the live bit stream is written continuously, while the readers are opened and closed
+	c := make(chan port.StateType)
+	w := NewWriter(c)
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for {
+			if _, err := w.Write(frame); err != nil {
+				return
+			}
+		}
+	}()
+
+	var frames uint64
+	for i := 0; i < 50; i++ {
+		r := NewReader(c)
+
+		var wg sync.WaitGroup
+		stop := make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := make([]byte, 64)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_, _ = r.Read(b)
+				_, _, _ = r.Status()
+				r.Reset()
+				time.Sleep(10 * time.Microsecond)
+			}
+		}()
+
+		time.Sleep(5 * time.Millisecond)
+
+		// concurrent and repeated calls of Close
+		wg.Add(2)
+		for j := 0; j < 2; j++ {
+			go func() {
+				defer wg.Done()
+				_ = r.Close()
+			}()
+		}
+		_ = r.Close()
+		close(stop)
+		wg.Wait()
+
+		for range r.Frames() {
+			// the frames channel is closed by Close
+		}
+		_, _, n := r.Status()
+		frames += n
+	}
+
+	_ = w.Close()
+	<-written
+	if frames == 0 {
+		t.Error("got no decoded frame of the live bit stream")
+	}
+}
+
+func TestBitOrder(t *testing.T) {
+	frame := []byte{0x10, 0x01, 0xc7}
+
+	tests := []struct {
+		name   string
+		writer BitOrder
+		reader BitOrder
+		want   []byte
+	}{
+		{"lsb first", LSBFirst, LSBFirst, frame},
+		{"msb first", MSBFirst, MSBFirst, frame},
+		// the bits of each byte are reversed by the other order
+		{"msb first read as lsb first", MSBFirst, LSBFirst, []byte{0x08, 0x80, 0xe3}},
+		{"lsb first read as msb first", LSBFirst, MSBFirst, []byte{0x08, 0x80, 0xe3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := make(chan port.StateType)
+			r, err := NewReaderWithOptions(c, WithBitOrder(tt.reader))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			w := NewWriter(c)
+			w.SetBitOrder(tt.writer)
+			if _, err = w.Write(frame); err != nil {
+				t.Fatal(err)
+			}
+			_ = w.Close()
+
+			if got := readFrames(r, 20*time.Millisecond); !reflect.DeepEqual(got, [][]byte{tt.want}) {
+				t.Errorf("got frames %v, want %v", got, [][]byte{tt.want})
+			}
+		})
+	}
+
+	if _, err := NewReaderWithOptions(make(chan port.StateType), WithBitOrder(BitOrder(2))); err == nil {
+		t.Error("got no error of an unknown bit order")
+	}
+}
+
+func TestFrameFormat(t *testing.T) {
+	const L, H = port.Low, port.High
+	sync := func(s port.StateType) []port.StateType {
+		var bits []port.StateType
+		for i := 0; i < syncBits; i++ {
+			bits = append(bits, s)
+		}
+		return bits
+	}
+
+	// the data bits (LSB first) of 0x10 and 0xc7
+	data := [][]port.StateType{{L, L, L, L, H, L, L, L}, {H, H, H, L, L, L, H, H}}
+	// frame returns the bit stream of the data bytes with the polarity of the start bit and the stop bit (sync)
+	frame := func(start, stop port.StateType) []port.StateType {
+		bits := sync(stop)
+		for _, d := range data {
+			bits = append(append(append(bits, start), d...), stop)
+		}
+		return append(bits, sync(stop)...)
+	}
+
+	tests := []struct {
+		name   string
+		format FrameFormat
+		bits   []port.StateType
+		want   [][]byte
+	}{
+		{"default", DefaultFrameFormat, frame(L, H), [][]byte{{0x10, 0xc7}}},
+		{"inverted", FrameFormat{StartBit: H, StopBit: L}, frame(H, L), [][]byte{{0x10, 0xc7}}},
+		// the inverted sync isn't recognized by the default format
+		{"inverted frame of the default format", DefaultFrameFormat, frame(H, L), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := make(chan port.StateType)
+			r, err := NewReaderWithOptions(c, WithFrameFormat(tt.format))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			for _, s := range tt.bits {
+				c <- s
+			}
+			if got := readFrames(r, 20*time.Millisecond); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got frames %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewReaderWithOptions(make(chan port.StateType), WithFrameFormat(FrameFormat{StartBit: H, StopBit: H})); err == nil {
+		t.Error("got no error of a frame format with start bit and stop bit of the same level")
+	}
+}
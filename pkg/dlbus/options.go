@@ -0,0 +1,98 @@
+package dlbus
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidOption is returned by NewReaderWithOptions if an option has an invalid value.
+var ErrInvalidOption = errors.New("invalid dlbus option")
+
+// Option configures the ReadCloser, see NewReaderWithOptions.
+type Option func(*ReadCloser) error
+
+// WithChecksum enables the checksum validation of the frames.
+// The last byte of the frame is the checksum: the sum of all preceding bytes (incl. device id) modulo 256.
+// Frames with an invalid checksum are dropped.
+func WithChecksum() Option {
+	return func(r *ReadCloser) error {
+		r.checksum = true
+		return nil
+	}
+}
+
+// WithMaxFrameLen defines the maximum size of a frame in bytes.
+// If the frame exceeds the size (e.g. the bus is chattering garbage), the frame is dropped and the dlbus resyncs.
+func WithMaxFrameLen(n int) Option {
+	return func(r *ReadCloser) error {
+		if n < 1 {
+			return ErrInvalidOption
+		}
+
+		r.maxFrameLen = n
+		return nil
+	}
+}
+
+// WithSyncTimeout resets the decoding, if no complete frame is received within the timeout
+// (e.g. the manchester decoder is locked, but the byte framing never aligns). The value 0 disables the timeout.
+func WithSyncTimeout(timeout time.Duration) Option {
+	return func(r *ReadCloser) error {
+		if timeout < 0 {
+			return ErrInvalidOption
+		}
+
+		r.syncTimeout = timeout
+		return nil
+	}
+}
+
+// WithFrameTimeout discards a partially received frame and resyncs, if no bit is received within the timeout
+// (e.g. the line goes quiet in the middle of a byte). The value 0 disables the timeout.
+func WithFrameTimeout(timeout time.Duration) Option {
+	return func(r *ReadCloser) error {
+		if timeout < 0 {
+			return ErrInvalidOption
+		}
+
+		r.frameTimeout = timeout
+		return nil
+	}
+}
+
+// WithQueueSize defines the maximum number of completed frames, which are queued for Read.
+// If the queue is full, the oldest frame is dropped (see Dropped).
+func WithQueueSize(n int) Option {
+	return func(r *ReadCloser) error {
+		if n < 1 {
+			return ErrInvalidOption
+		}
+
+		r.queueSize = n
+		return nil
+	}
+}
+
+// WithBitOrder defines the order of the data bits within a byte, the default is LSBFirst.
+func WithBitOrder(o BitOrder) Option {
+	return func(r *ReadCloser) error {
+		if o != LSBFirst && o != MSBFirst {
+			return ErrInvalidOption
+		}
+
+		r.bitOrder = o
+		return nil
+	}
+}
+
+// WithFrameFormat defines the polarity of the framing bits, the default is DefaultFrameFormat.
+func WithFrameFormat(f FrameFormat) Option {
+	return func(r *ReadCloser) error {
+		if !f.valid() {
+			return ErrInvalidOption
+		}
+
+		r.format = f
+		return nil
+	}
+}
@@ -0,0 +1,129 @@
+package dlbus
+
+import (
+	"errors"
+	"sync"
+	"tadl/pkg/port"
+)
+
+// ErrClosed is returned by Write, if the WriteCloser is closed.
+var ErrClosed = errors.New("dlbus writer closed")
+
+// WriteCloser contains the handler to write data frames to the dl bus.
+// It's the counterpart of the ReadCloser and produces the bitstream (e.g. for the manchester encoding or for tests).
+type WriteCloser struct {
+	// tx channel sends the bitstream.
+	tx chan port.StateType
+	// bitOrder is the order of the data bits within a byte.
+	bitOrder BitOrder
+	// format is the polarity of the framing bits.
+	format FrameFormat
+	// wl serializes the writes of frames.
+	wl sync.Mutex
+	// closed is true, if the handler is closed.
+	closed bool
+	// quit stops a blocked write
+	quit chan struct{}
+	// closeOnce guarantees that quit is closed only once.
+	closeOnce sync.Once
+}
+
+// NewWriter initials a new dlbus writer, which sends the bitstream to channel c.
+// The channel c is closed by Close.
+func NewWriter(c chan port.StateType) *WriteCloser {
+	return &WriteCloser{
+		tx:     c,
+		format: DefaultFrameFormat,
+		quit:   make(chan struct{}),
+	}
+}
+
+// Write sends the data frame b as bitstream, Write blocks until the bitstream is sent.
+//  the dataframe starts and ends with 16 high bits (sync).
+//  each data byte consists of one start bit (low), eight dat bits (LSB first, see SetBitOrder) and one stop bit (high)
+//  The polarity of the sync, start and stop bits is defined by the frame format (see SetFrameFormat).
+func (w *WriteCloser) Write(b []byte) (int, error) {
+	w.wl.Lock()
+	defer w.wl.Unlock()
+
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	if err := w.sync(); err != nil {
+		return 0, err
+	}
+
+	for n, v := range b {
+		if err := w.send(w.format.StartBit); err != nil {
+			return n, err
+		}
+
+		for i := 0; i < 8; i++ {
+			if err := w.send(port.StateType(v >> bitIndex(w.bitOrder, i) & 1)); err != nil {
+				return n, err
+			}
+		}
+
+		if err := w.send(w.format.StopBit); err != nil {
+			return n, err
+		}
+	}
+
+	// the trailing sync completes the frame
+	if err := w.sync(); err != nil {
+		return len(b), err
+	}
+
+	return len(b), nil
+}
+
+// SetBitOrder defines the order of the data bits within a byte, the default is LSBFirst.
+func (w *WriteCloser) SetBitOrder(o BitOrder) {
+	w.wl.Lock()
+	defer w.wl.Unlock()
+	w.bitOrder = o
+}
+
+// SetFrameFormat defines the polarity of the framing bits, the default is DefaultFrameFormat.
+func (w *WriteCloser) SetFrameFormat(f FrameFormat) {
+	w.wl.Lock()
+	defer w.wl.Unlock()
+	w.format = f
+}
+
+// Close stops a blocked Write and closes the channel of the bitstream.
+//  Close can be called several times.
+func (w *WriteCloser) Close() error {
+	w.closeOnce.Do(func() { close(w.quit) })
+
+	w.wl.Lock()
+	defer w.wl.Unlock()
+
+	if !w.closed {
+		w.closed = true
+		close(w.tx)
+	}
+
+	return nil
+}
+
+// sync sends a sync sequence.
+func (w *WriteCloser) sync() error {
+	for i := 0; i < syncBits; i++ {
+		if err := w.send(w.format.StopBit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send sends a bit, unless the handler is closed.
+func (w *WriteCloser) send(s port.StateType) error {
+	select {
+	case w.tx <- s:
+		return nil
+	case <-w.quit:
+		return ErrClosed
+	}
+}
@@ -0,0 +1,71 @@
+package dlbus
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"tadl/pkg/port"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	frames := [][]byte{
+		{0x10, 0xc7, 0x01, 0xd2, 0x00, 0xd2, 0x00, 0xd2, 0x00, 1 << 5},
+		{0x30, 0x00, 0xff, 0x80, 0x01, 0x55, 0xaa, 0},
+		{0x10, 0xff},
+	}
+
+	tests := []struct {
+		name   string
+		order  BitOrder
+		format FrameFormat
+	}{
+		{"default", LSBFirst, DefaultFrameFormat},
+		{"msb first", MSBFirst, DefaultFrameFormat},
+		{"inverted", LSBFirst, InvertedFrameFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := make(chan port.StateType)
+			r, err := NewReaderWithOptions(c, WithBitOrder(tt.order), WithFrameFormat(tt.format))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			w := NewWriter(c)
+			w.SetBitOrder(tt.order)
+			w.SetFrameFormat(tt.format)
+			for _, f := range frames {
+				if n, err := w.Write(f); err != nil || n != len(f) {
+					t.Fatalf("got %v written bytes (%v), want %v", n, err, len(f))
+				}
+			}
+			_ = w.Close()
+
+			if got := readFrames(r, 50*time.Millisecond); !reflect.DeepEqual(got, frames) {
+				t.Errorf("got frames %v, want %v", got, frames)
+			}
+			if _, err := w.Write(frames[0]); !errors.Is(err, ErrClosed) {
+				t.Errorf("got error %v after close, want %v", err, ErrClosed)
+			}
+		})
+	}
+}
+
+func TestWriterFraming(t *testing.T) {
+	bits := frameBits(t, []byte{0x01})
+
+	// sync, start bit, data bits (LSB first), stop bit, sync
+	var want []port.StateType
+	for i := 0; i < syncBits; i++ {
+		want = append(want, port.High)
+	}
+	want = append(want, port.Low, port.High, port.Low, port.Low, port.Low, port.Low, port.Low, port.Low, port.Low, port.High)
+	want = append(want, want[:syncBits]...)
+
+	if !reflect.DeepEqual(bits, want) {
+		t.Errorf("got bits %v, want %v", bits, want)
+	}
+}
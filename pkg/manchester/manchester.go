@@ -11,6 +11,8 @@ package manchester
 
 import (
 	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/womat/debug"
@@ -18,11 +20,24 @@ import (
 )
 
 const (
-	// SensitivityFactor is the factor to calc the mid-bit time intervals (SignalT * SensitivityFactor).
-	sensitivityFactor = 0.6
+	// defaultSensitivityFactor is the default factor to calc the mid-bit time intervals (SignalT * SensitivityFactor).
+	defaultSensitivityFactor = 0.6
 
-	// eventSamples are the count of event samples to calculate the clock.
-	eventSamples = 500
+	// maxDrift is the max relative deviation of a measured mid-bit time from signalT,
+	// which is used for the drift correction (see WithDriftCorrection).
+	maxDrift = 0.2
+
+	// minClusterRatio is the min ratio between two neighboured (sorted) event samples to split
+	// the half bit periods from the full bit periods (the expected ratio is 2).
+	minClusterRatio = 1.4
+
+	// defaultMinPeriod and defaultMaxPeriod are the default bounds of a discovered full bit period,
+	// a generous range around the 50 Hz DL-Bus clock (incl. the 488 Hz DL-Bus clock).
+	defaultMinPeriod = time.Millisecond
+	defaultMaxPeriod = 200 * time.Millisecond
+
+	// defaultSampleCount is the default count of event samples to calculate the clock.
+	defaultSampleCount = 500
 
 	// discoverClock is the process state the clock frequency.
 	discoverClock int = iota
@@ -33,14 +48,58 @@ const (
 	synchronized
 )
 
+// Convention defines the edge to level mapping of the mid-bit transitions.
+type Convention int
+
+const (
+	// ThomasConvention (G.E. Thomas): a falling edge is a High (1), a rising edge is a Low (0), used by the DL-Bus.
+	ThomasConvention Convention = iota
+	// IEEEConvention (IEEE 802.3): a rising edge is a High (1), a falling edge is a Low (0).
+	IEEEConvention
+)
+
+// TimedState is a decoded state with the timestamp of the line event.
+type TimedState struct {
+	// State is the decoded state (High/Low/Invalid).
+	State port.StateType
+	// Timestamp is the time of the line event, which completed the state.
+	Timestamp time.Duration
+}
+
+// DecoderStats contains the statistics of the Decoder.
+type DecoderStats struct {
+	// Bits is the count of decoded bits (High/Low).
+	Bits uint64
+	// Invalid is the count of emitted Invalid states.
+	Invalid uint64
+	// Resyncs is the count of synchronizations to the clock (incl. the first synchronization).
+	Resyncs uint64
+	// Interval1, Interval2 and Interval3 are the counts of periods classified as 1, 2 and 3 mid-bit times (signalT),
+	// IntervalOther is the count of all other (invalid) periods. They reveal timing distribution issues.
+	Interval1     uint64
+	Interval2     uint64
+	Interval3     uint64
+	IntervalOther uint64
+}
+
 // Decoder represents the handler of the Decoder.
 type Decoder struct {
+	// stats contains the decoder statistics, updated atomically.
+	// It's the first field to guarantee the 64-bit alignment of the counters on 32-bit platforms.
+	stats DecoderStats
+
 	// state contains the current decoding state (discoverClock/synchronizing/synchronized).
 	state int
 
+	// locked is 1 if the state is synchronized, it's read atomically by Locked.
+	locked int32
+
 	// eventSamples holds event samples to calculate bit periods (clock).
 	eventSamples []time.Duration
 
+	// sampleCount is the count of event samples to calculate the clock.
+	sampleCount int
+
 	// lastTimestamp is the time of the last detected event.
 	lastTimestamp time.Duration
 
@@ -58,67 +117,281 @@ type Decoder struct {
 	// sensitivity is a helper variable to calc the mid-bit time intervals (SignalT * SensitivityFactor).
 	sensitivity time.Duration
 
+	// sensitivityFactor is the factor to calc the mid-bit time intervals (SignalT * SensitivityFactor).
+	sensitivityFactor float64
+
+	// fullPeriod is the discovered full bit period (clock period).
+	fullPeriod time.Duration
+
+	// clockDiscovered is true if the clock discovery is finished.
+	clockDiscovered bool
+
+	// clockHz is the expected clock frequency, 0 disables the clock range check.
+	clockHz float64
+
+	// clockTolerance is the relative tolerance of the expected clock frequency (e.g. 0.2 >> ±20%).
+	clockTolerance float64
+
+	// minPeriod and maxPeriod are the bounds of a discovered full bit period.
+	minPeriod, maxPeriod time.Duration
+
+	// fixedClock skips the clock discovery and uses clockHz as clock frequency.
+	fixedClock bool
+
+	// convention defines the edge to level mapping (default: ThomasConvention).
+	convention Convention
+
+	// driftAlpha is the smoothing factor of the exponential moving average to correct the clock drift,
+	// 0 disables the drift correction.
+	driftAlpha float64
+
+	// gapTimeout is the count of mid-bit times (signalT) without any event, after which the line is
+	// supposed to be silent, 0 disables the gap detection.
+	gapTimeout int
+
+	// quietStart is the count of consecutive valid bits, after which the lock is achieved (see WithQuietStart),
+	// 0 disables the quiet start.
+	quietStart int
+
+	// validBits is the count of consecutive valid bits, until the lock is achieved.
+	validBits int
+
+	// stable is true, if the lock has ever been achieved (see WithQuietStart).
+	stable bool
+
+	// mu protects the clock values (signalT, sensitivity, sensitivityFactor, fullPeriod, clockDiscovered)
+	// against concurrent access.
+	mu sync.RWMutex
+
 	// C is the channel to send the decoded bit stream.
 	C chan port.StateType
 
+	// peak is the maximum fill level of channel C, updated atomically.
+	peak int32
+
+	// emit outputs a decoded state (channel C/CT or the result of DecodeAll).
+	emit func(port.StateType, time.Duration)
+
+	// CT is the channel to send the decoded bit stream with the timestamps of the line events,
+	// it's nil unless enabled by WithTimedStates.
+	CT chan TimedState
+
 	// rx is the channel to receive the line events.
 	rx chan port.Event
 
-	// quit is the channel to stop the Decoder.
-	quit chan bool
-	// done signals that handler is stopped.
-	done chan bool
+	// reset is the channel to restart the clock discovery.
+	reset chan struct{}
+
+	// quit is closed to stop the Decoder.
+	quit chan struct{}
+	// closeOnce guarantees that quit is closed only once.
+	closeOnce sync.Once
+	// done is closed if the handler is stopped.
+	done chan struct{}
 }
 
-// New initials a new Decoder.
+// New initials a new Decoder, the clock frequency is discovered automatically.
 func New(c chan port.Event) *Decoder {
+	d, _ := NewWithOptions(c)
+	return d
+}
+
+// NewWithOptions initials a new Decoder configured by options.
+func NewWithOptions(c chan port.Event, opts ...Option) (*Decoder, error) {
+	d, err := newDecoder(c, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	d.emit = d.sendChannel
+
+	go d.run()
+	return d, nil
+}
+
+// DecodeAll decodes the line events synchronously without go routines and channels,
+// e.g. to analyze captured traces. It runs the same state machine as the Decoder,
+// so the clock is discovered first, unless WithFixedClock is used.
+// The returned bit stream contains port.Invalid at each point, where the decoder lost the synchronization.
+func DecodeAll(events []port.Event, opts ...Option) ([]port.StateType, error) {
+	d, err := newDecoder(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []port.StateType
+	d.emit = func(s port.StateType, _ time.Duration) { states = append(states, s) }
+
+	for _, evt := range events {
+		d.eventHandler(evt)
+	}
+
+	return states, nil
+}
+
+// newDecoder initials the Decoder struct and starts the clock discovery, the go routine isn't started.
+func newDecoder(c chan port.Event, opts ...Option) (*Decoder, error) {
 	d := Decoder{
-		C:    make(chan port.StateType, 100),
-		rx:   c,
-		quit: make(chan bool),
-		done: make(chan bool),
+		C:                 make(chan port.StateType, 100),
+		rx:                c,
+		sensitivityFactor: defaultSensitivityFactor,
+		sampleCount:       defaultSampleCount,
+		minPeriod:         defaultMinPeriod,
+		maxPeriod:         defaultMaxPeriod,
+		reset:             make(chan struct{}),
+		quit:              make(chan struct{}),
+		done:              make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		if err := opt(&d); err != nil {
+			return nil, err
+		}
 	}
 
 	// start to discover clock frequency.
-	d.eventSamples = make([]time.Duration, 0, eventSamples)
-	d.state = discoverClock
-	debug.DebugLog.Print("discovering clock frequency started")
+	d.discover()
 
-	go d.run()
-	return &d
+	return &d, nil
 }
 
-// Close stops Decoder.
+// Close stops Decoder and closes channel C.
+// Close is idempotent, further calls (or calls after the rx channel is closed) return nil.
 func (d *Decoder) Close() error {
-	d.quit <- true
+	d.closeOnce.Do(func() { close(d.quit) })
 
 	// wait until run() is terminated
 	<-d.done
+	return nil
+}
+
+// Reset forces a re-discovery of the clock frequency, e.g. if the signal source has been changed.
+// The reset is executed by the decoder go routine, so it doesn't race with the event handling.
+// The go routine and the channels are not affected, bits already buffered in channel C may still drain after reset.
+func (d *Decoder) Reset() {
+	select {
+	case d.reset <- struct{}{}:
+	case <-d.done:
+	}
+}
+
+// discover (re)starts the discovery of the clock frequency.
+// If a fixed clock is configured, the discovery is skipped and the decoder starts synchronizing.
+func (d *Decoder) discover() {
+	d.lastInterval = 0
+	d.lastTimestamp = 0
+
+	if d.fixedClock {
+		fullPeriod := time.Duration(float64(time.Second) / d.clockHz)
+		d.setClock(fullPeriod/2, fullPeriod)
+		debug.InfoLog.Printf("fixed clock: %.1f Hz\n", d.clockHz)
+		d.setState(synchronizing)
+		return
+	}
+
+	d.mu.Lock()
+	d.clockDiscovered = false
+	d.mu.Unlock()
+
+	d.eventSamples = make([]time.Duration, 0, d.sampleCount)
+	d.setState(discoverClock)
+	debug.DebugLog.Print("discovering clock frequency started")
+}
+
+// setClock sets the clock values (signalT, sensitivity, fullPeriod) and marks the clock as known.
+func (d *Decoder) setClock(halfPeriod, fullPeriod time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.signalT = halfPeriod
+	d.sensitivity = time.Duration(float64(d.signalT) * d.sensitivityFactor)
+	d.fullPeriod = fullPeriod
+	d.clockDiscovered = true
+}
+
+// SetSensitivity sets the factor to calc the mid-bit time intervals (SignalT * factor)
+// and recomputes the sensitivity of the current clock. The factor must be within (0,1).
+// SetSensitivity is safe to call concurrently to the running decoder.
+func (d *Decoder) SetSensitivity(factor float64) error {
+	if factor <= 0 || factor >= 1 {
+		return ErrInvalidOption
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-	close(d.C)
-	close(d.quit)
-	close(d.done)
+	d.sensitivityFactor = factor
+	d.sensitivity = time.Duration(float64(d.signalT) * factor)
 	return nil
 }
 
+// Clock returns the discovered mid-bit time (signalT), the clock frequency and
+// whether the clock discovery is finished.
+// Clock is safe to call concurrently to the running decoder.
+func (d *Decoder) Clock() (signalT time.Duration, freqHz float64, ok bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if !d.clockDiscovered {
+		return 0, 0, false
+	}
+
+	return d.signalT, 1 / d.fullPeriod.Seconds(), true
+}
+
 // run receives events and send it to eventHandler to decode.
+// run is terminated by Close or if the rx channel is closed.
 func (d *Decoder) run() {
+	defer close(d.done)
+	defer close(d.C)
+	defer func() {
+		if d.CT != nil {
+			close(d.CT)
+		}
+	}()
+
+	// gap detects a silent line while synchronized (see WithGapTimeout)
+	gap := time.NewTimer(time.Hour)
+	gap.Stop()
+	defer gap.Stop()
+
 	for {
 		select {
 		case <-d.quit:
-			d.done <- true
 			return
+		case <-d.reset:
+			d.discover()
+		case <-gap.C:
+			if d.state == synchronized {
+				d.warnf("no event within %v, wait for synchronizing", time.Duration(d.gapTimeout)*d.signalT)
+				d.send(port.Invalid, d.lastTimestamp)
+				d.setState(synchronizing)
+			}
 		case evt, open := <-d.rx:
 			if !open {
-				d.quit <- true
-				continue
+				return
 			}
 
 			d.eventHandler(evt)
+			d.armGapTimer(gap)
 		}
 	}
 }
 
+// armGapTimer restarts the gap timer, if the gap timeout is enabled and the decoder is synchronized.
+func (d *Decoder) armGapTimer(gap *time.Timer) {
+	if !gap.Stop() {
+		select {
+		case <-gap.C:
+		default:
+		}
+	}
+
+	if d.gapTimeout > 0 && d.state == synchronized {
+		gap.Reset(time.Duration(d.gapTimeout) * d.signalT)
+	}
+}
+
 // eventHandler decodes line events (edges) to a bit stream.
 //  * discoverClock:
 //           the clock frequency is discovered by analyzing the bit periods (measuring full bit periods)
@@ -136,21 +409,36 @@ func (d *Decoder) eventHandler(event port.Event) {
 
 	switch d.state {
 	case discoverClock:
-		if len(d.eventSamples) < eventSamples {
+		if len(d.eventSamples) < d.sampleCount {
 			d.eventSamples = append(d.eventSamples, period)
 
-			if len(d.eventSamples) == eventSamples {
-				halfPeriod, fullPeriod := calcBitPeriods(d.eventSamples)
+			if len(d.eventSamples) == d.sampleCount {
+				halfPeriod, fullPeriod, single := calcBitPeriods(d.eventSamples)
+
+				if single {
+					var ok bool
+					if halfPeriod, fullPeriod, ok = d.resolveSingleCluster(halfPeriod); !ok {
+						debug.DebugLog.Printf("ambiguous clock (single cluster of periods %v), restart discovering", halfPeriod)
+						d.discover()
+						return
+					}
+				}
 
-				d.signalT = halfPeriod
-				d.sensitivity = time.Duration(float64(d.signalT) * sensitivityFactor)
+				if !d.validClock(fullPeriod) {
+					debug.ErrorLog.Printf("discovered clock %.1f Hz (period %v) is out of range, restart discovering",
+						1/fullPeriod.Seconds(), fullPeriod)
+					d.discover()
+					return
+				}
+
+				d.setClock(halfPeriod, fullPeriod)
 
 				debug.DebugLog.Println("discovering clock frequency finished")
 				debug.InfoLog.Printf("clock: %.1f Hz\n", 1/fullPeriod.Seconds())
 				debug.DebugLog.Printf("SignalT: %v\n", d.signalT)
 				debug.DebugLog.Printf("Sensitivity: %v\n", d.sensitivity)
 
-				d.state = synchronizing
+				d.setState(synchronizing)
 				d.eventSamples = nil
 			}
 		}
@@ -158,14 +446,15 @@ func (d *Decoder) eventHandler(event port.Event) {
 	case synchronizing:
 		// synchronize to the clock (distinguish a bit edge from a mid-bit transition)
 		// capture next falling edge and check if period value equal 2 SignalT (T = 1⁄2 data rate)
-		interval := int((period-d.sensitivity)/d.signalT) + 1
+		interval := d.interval(period)
 
 		if interval == 2 && event.Type == port.FallingEdge {
 			debug.DebugLog.Println("synchronizing with the data clock finished")
 
 			d.lastTimestamp = event.Timestamp - d.signalT
 			d.lastInterval = 0
-			d.state = synchronized
+			d.setState(synchronized)
+			atomic.AddUint64(&d.stats.Resyncs, 1)
 			return
 		}
 
@@ -175,17 +464,17 @@ func (d *Decoder) eventHandler(event port.Event) {
 		// 2 >> 1/2 data rate, start restart SignalT timer
 		// 3 >> 3 SignalT time (1.5 data rate from starting), signal is valid, level depends on falling/rising edge
 		// all others: invalid >> restart synchronizing
-		interval := int((period-d.sensitivity)/d.signalT) + 1
+		interval := d.interval(period)
 
 		if (interval == 1 && (d.lastInterval == 1 || d.lastInterval == 3)) ||
 			(interval == 2 && d.lastInterval == 2) ||
 			(interval == 3 && d.lastInterval == 2) {
-			debug.WarningLog.Printf(
+			d.warnf(
 				"invalid interval combination: current state: %v, last state: %v (period: %v)",
 				interval, d.lastInterval, period)
 
-			d.C <- port.Invalid
-			d.state = synchronizing
+			d.send(port.Invalid, event.Timestamp)
+			d.setState(synchronizing)
 			return
 		}
 
@@ -194,62 +483,205 @@ func (d *Decoder) eventHandler(event port.Event) {
 			// d.lastTimestamp is already set at the beginning of the procedure
 			// d.lastTimestamp = event.Timestamp
 			d.lastInterval = interval
+			d.correctDrift(period)
 
 		case 1, 3:
 			switch event.Type {
 			case port.RisingEdge:
-				d.C <- port.Low
+				d.send(d.level(port.Low), event.Timestamp)
 			case port.FallingEdge:
-				d.C <- port.High
+				d.send(d.level(port.High), event.Timestamp)
 			}
 
 			d.lastInterval = interval
 			d.lastTimestamp = event.Timestamp - d.signalT
 
 		default:
-			debug.WarningLog.Printf("invalid interval: %v (period: %v)", interval, period)
+			d.warnf("invalid interval: %v (period: %v)", interval, period)
 
-			d.C <- port.Invalid
-			d.state = synchronizing
+			d.send(port.Invalid, event.Timestamp)
+			d.setState(synchronizing)
 		}
 	}
 }
 
-// calcBitPeriods calculates the manchester bit periods (clock) from the event samples
-func calcBitPeriods(samples []time.Duration) (halfBitPeriod, fullBitPeriod time.Duration) {
-	// the first entry in the slice must be a half bit period
-	// so, sorting the samples helps to identify a half bit period
+// correctDrift adapts signalT slowly (exponential moving average) to the measured mid-bit time.
+// It's called on a bit edge (interval 2), the time reference is the virtual bit start (last mid-bit - signalT),
+// so the measured mid-bit time is period - signalT.
+// Measurements which differ more than maxDrift from signalT are ignored, so a single noisy event can't destroy the lock.
+func (d *Decoder) correctDrift(period time.Duration) {
+	if d.driftAlpha == 0 {
+		return
+	}
+
+	measured := period - d.signalT
+	if diff := float64(measured - d.signalT); diff > float64(d.signalT)*maxDrift || diff < -float64(d.signalT)*maxDrift {
+		return
+	}
+
+	signalT := d.signalT + time.Duration(d.driftAlpha*float64(measured-d.signalT))
+	d.setClock(signalT, 2*signalT)
+}
+
+// Stats returns the statistics of the decoder, it is safe to call Stats concurrently to the running decoder.
+func (d *Decoder) Stats() DecoderStats {
+	return DecoderStats{
+		Bits:    atomic.LoadUint64(&d.stats.Bits),
+		Invalid: atomic.LoadUint64(&d.stats.Invalid),
+		Resyncs: atomic.LoadUint64(&d.stats.Resyncs),
+
+		Interval1:     atomic.LoadUint64(&d.stats.Interval1),
+		Interval2:     atomic.LoadUint64(&d.stats.Interval2),
+		Interval3:     atomic.LoadUint64(&d.stats.Interval3),
+		IntervalOther: atomic.LoadUint64(&d.stats.IntervalOther),
+	}
+}
+
+// Fill returns the fill level of channel C.
+func (d *Decoder) Fill() port.ChannelFill {
+	return port.ChannelFill{Current: len(d.C), Peak: int(atomic.LoadInt32(&d.peak)), Capacity: cap(d.C)}
+}
+
+// level returns the level of a mid-bit transition depending on the convention.
+// The level of the G.E. Thomas convention is passed, the level of the IEEE 802.3 convention is inverted.
+func (d *Decoder) level(thomas port.StateType) port.StateType {
+	if d.convention == IEEEConvention {
+		return 1 - thomas
+	}
+	return thomas
+}
+
+// Locked returns true if the decoder is synchronized to the clock, it is safe to call Locked concurrently.
+func (d *Decoder) Locked() bool {
+	return atomic.LoadInt32(&d.locked) == 1
+}
+
+// setState sets the decoding state.
+func (d *Decoder) setState(state int) {
+	d.state = state
+
+	if state == synchronized {
+		atomic.StoreInt32(&d.locked, 1)
+		return
+	}
+	atomic.StoreInt32(&d.locked, 0)
+}
+
+// send updates the statistics and emits the decoded state.
+func (d *Decoder) send(s port.StateType, ts time.Duration) {
+	if s == port.Invalid {
+		atomic.AddUint64(&d.stats.Invalid, 1)
+		d.validBits = 0
+	} else {
+		atomic.AddUint64(&d.stats.Bits, 1)
+		if d.validBits++; !d.stable && d.validBits >= d.quietStart {
+			d.stable = true
+		}
+	}
+
+	d.emit(s, ts)
+}
+
+// warnf logs a decoding warning, the warnings are downgraded to debug messages
+// until the lock has been achieved for the first time (see WithQuietStart).
+func (d *Decoder) warnf(format string, v ...interface{}) {
+	if d.quietStart > 0 && !d.stable {
+		debug.DebugLog.Printf(format, v...)
+		return
+	}
+	debug.WarningLog.Printf(format, v...)
+}
+
+// sendChannel sends the decoded state to channel C (and CT if enabled).
+func (d *Decoder) sendChannel(s port.StateType, ts time.Duration) {
+	// don't block a Close, if nobody reads channel C
+	select {
+	case d.C <- s:
+	case <-d.quit:
+		return
+	}
+	port.UpdatePeak(&d.peak, len(d.C))
+
+	if d.CT != nil {
+		select {
+		case d.CT <- TimedState{State: s, Timestamp: ts}:
+		case <-d.quit:
+		}
+	}
+}
+
+// interval returns the count of mid-bit times (signalT) of the period and counts the classification.
+func (d *Decoder) interval(period time.Duration) int {
+	d.mu.RLock()
+	i := int((period-d.sensitivity)/d.signalT) + 1
+	d.mu.RUnlock()
+
+	switch i {
+	case 1:
+		atomic.AddUint64(&d.stats.Interval1, 1)
+	case 2:
+		atomic.AddUint64(&d.stats.Interval2, 1)
+	case 3:
+		atomic.AddUint64(&d.stats.Interval3, 1)
+	default:
+		atomic.AddUint64(&d.stats.IntervalOther, 1)
+	}
+
+	return i
+}
+
+// calcBitPeriods calculates the manchester bit periods (clock) from the event samples.
+// The samples are split into the cluster of half bit periods and the cluster of full bit periods
+// at the largest gap between two neighboured (sorted) samples.
+// If the samples contain only one cluster (no significant gap), single is true and
+// halfBitPeriod is the median of the cluster, which is ambiguous (see resolveSingleCluster).
+func calcBitPeriods(samples []time.Duration) (halfBitPeriod, fullBitPeriod time.Duration, single bool) {
 	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
 
 	// drop the lowest and highest event sample
 	samples = samples[1 : len(samples)-1]
 
-	halfBitPeriodSum := time.Duration(0)
-	fullBitPeriodSum := time.Duration(0)
+	// find the largest relative gap between two neighboured samples
+	split, ratio := 0, 0.0
+	for i := 1; i < len(samples); i++ {
+		if samples[i-1] <= 0 {
+			continue
+		}
+		if r := float64(samples[i]) / float64(samples[i-1]); r > ratio {
+			split, ratio = i, r
+		}
+	}
 
-	// since the slice is sorted, the first entry is a half bit period!
-	halfBitPeriod = samples[0]
-	fullBitPeriod = halfBitPeriod * 2
+	// the calculation of half bit period and full bit period is based on the median
+	// of the received half bit periods and full bit periods, because the median is robust against stretched edges
+	if ratio < minClusterRatio {
+		halfBitPeriod = median(samples)
+		return halfBitPeriod, halfBitPeriod * 2, true
+	}
 
-	ixFull := 1
-	ixHalf := 1
+	return median(samples[:split]), median(samples[split:]), false
+}
 
-	// the calculation of half bit period and full bit period is based on average calculation
-	// of the received half bit periods and full bit periods
-	for _, t := range samples {
-		// if time duration is greater than 150% of a half bit period, it is full bit period
-		if t > halfBitPeriod+halfBitPeriod/2 {
-			fullBitPeriodSum += t
-			fullBitPeriod = fullBitPeriodSum / time.Duration(ixFull)
-			ixFull++
-			continue
-		}
+// resolveSingleCluster resolves a single cluster of event samples with the median period,
+// which are either half bit periods or full bit periods (e.g. a long run of alternating bits).
+// It's resolved by the expected clock range, if exactly one of the interpretations is valid,
+// otherwise (or without clock range) ok is false and the discovery waits for both clusters.
+func (d *Decoder) resolveSingleCluster(period time.Duration) (halfBitPeriod, fullBitPeriod time.Duration, ok bool) {
+	if d.clockHz == 0 {
+		return 0, 0, false
+	}
 
-		// otherwise, it is a half period
-		halfBitPeriodSum += t
-		halfBitPeriod = halfBitPeriodSum / time.Duration(ixHalf)
-		ixHalf++
+	half, full := d.validClock(2*period), d.validClock(period)
+	switch {
+	case half && !full:
+		return period, 2 * period, true
+	case full && !half:
+		return period / 2, period, true
 	}
+	return 0, 0, false
+}
 
-	return halfBitPeriod, fullBitPeriod
+// median returns the median of sorted samples.
+func median(samples []time.Duration) time.Duration {
+	return samples[len(samples)/2]
 }
@@ -0,0 +1,418 @@
+package manchester
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"tadl/pkg/port"
+
+	"github.com/womat/debug"
+)
+
+// events returns line events with the periods, the edges alternate starting with a rising edge.
+func events(periods ...time.Duration) []port.Event {
+	var evts []port.Event
+	var ts time.Duration
+	for i, p := range periods {
+		ts += p
+		e := port.Event{Timestamp: ts, Type: port.RisingEdge}
+		if i%2 == 1 {
+			e.Type = port.FallingEdge
+		}
+		evts = append(evts, e)
+	}
+	return evts
+}
+
+// repeat returns the periods n times.
+func repeat(n int, periods ...time.Duration) []time.Duration {
+	var r []time.Duration
+	for i := 0; i < n; i++ {
+		r = append(r, periods...)
+	}
+	return r
+}
+
+// encode returns the line events of the manchester encoded bits by the Thomas convention (a falling mid-bit edge is a High).
+//  signalT is the half bit period, the line is low before the first bit.
+func encode(bits []port.StateType, signalT time.Duration) []port.Event {
+	return encodeClock(bits, func(int) time.Duration { return signalT })
+}
+
+// encodeClock returns the line events of the manchester encoded bits like encode,
+// the half bit period of the i-th bit is signalT(i), e.g. to emulate a drifting clock.
+func encodeClock(bits []port.StateType, signalT func(i int) time.Duration) []port.Event {
+	var evts []port.Event
+	var ts time.Duration
+	level := port.Low
+	for i, bit := range bits {
+		for _, half := range []port.StateType{bit, 1 - bit} {
+			if half != level {
+				e := port.Event{Timestamp: ts, Type: port.RisingEdge}
+				if half == port.Low {
+					e.Type = port.FallingEdge
+				}
+				evts = append(evts, e)
+				level = half
+			}
+			ts += signalT(i)
+		}
+	}
+	return evts
+}
+
+// bitsOf returns the bits (LSB first) of the bytes.
+func bitsOf(b ...byte) []port.StateType {
+	var bits []port.StateType
+	for _, v := range b {
+		for i := 0; i < 8; i++ {
+			bits = append(bits, port.StateType(v>>i&1))
+		}
+	}
+	return bits
+}
+
+// signalT returns the half bit period of the clock frequency.
+func signalT(clockHz float64) time.Duration {
+	return time.Duration(float64(time.Second) / clockHz / 2)
+}
+
+// hasSuffix returns true if the decoded bits end with the bits of want.
+func hasSuffix(got, want []port.StateType) bool {
+	if len(got) < len(want) {
+		return false
+	}
+	got = got[len(got)-len(want):]
+	for i := range want {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDiscoverClock(t *testing.T) {
+	const ms = time.Millisecond
+
+	tests := []struct {
+		name    string
+		clockHz float64
+		periods []time.Duration
+		ok      bool
+		signalT time.Duration
+	}{
+		{"both clusters", 0, repeat(10, 10*ms, 10*ms, 20*ms), true, 10 * ms},
+		{"both clusters in range", 50, repeat(10, 10*ms, 20*ms, 10*ms), true, 10 * ms},
+		// a single cluster is ambiguous without clock range: 40 ms may be a full period (25 Hz) or two half periods
+		{"single cluster without clock", 0, repeat(30, 40*ms), false, 0},
+		{"single cluster of full periods", 50, repeat(30, 20*ms), true, 10 * ms},
+		{"single cluster of half periods", 50, repeat(30, 10*ms), true, 10 * ms},
+		{"single cluster out of range", 50, repeat(30, 40*ms), false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newDecoder(nil, WithSampleCount(20), WithClockRange(tt.clockHz, 0.2))
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.emit = func(port.StateType, time.Duration) {}
+
+			for _, e := range events(tt.periods...) {
+				d.eventHandler(e)
+			}
+
+			signalT, _, ok := d.Clock()
+			if ok != tt.ok || signalT != tt.signalT {
+				t.Errorf("got signalT %v discovered %v, want %v %v", signalT, ok, tt.signalT, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCalcBitPeriods(t *testing.T) {
+	const ms = time.Millisecond
+
+	half, full, single := calcBitPeriods(repeat(5, 10*ms, 11*ms, 20*ms, 21*ms))
+	if single || half < 10*ms || half > 11*ms || full < 20*ms || full > 21*ms {
+		t.Errorf("got %v %v single %v, want ~10ms ~20ms", half, full, single)
+	}
+
+	if half, _, single = calcBitPeriods(repeat(10, 20*ms)); !single || half != 20*ms {
+		t.Errorf("got %v single %v, want a single cluster of 20ms", half, single)
+	}
+}
+
+func TestCalcBitPeriodsSkewed(t *testing.T) {
+	const ms = time.Millisecond
+
+	// a few stretched edges (e.g. a partial frame at startup) skew the mean of both clusters, but not the median
+	samples := append(repeat(40, 10*ms, 20*ms), repeat(8, 13*ms, 26*ms)...)
+	half, full, single := calcBitPeriods(samples)
+	if single || half != 10*ms || full != 20*ms {
+		t.Errorf("got %v %v single %v, want 10ms 20ms", half, full, single)
+	}
+
+	// the decoder discovers the correct clock of the skewed samples
+	d, err := newDecoder(nil, WithSampleCount(len(samples)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.emit = func(port.StateType, time.Duration) {}
+	for _, e := range events(append(repeat(8, 13*ms, 26*ms), repeat(40, 10*ms, 20*ms)...)...) {
+		d.eventHandler(e)
+	}
+	if signalT, _, ok := d.Clock(); !ok || signalT != 10*ms {
+		t.Errorf("got signalT %v discovered %v, want 10ms true", signalT, ok)
+	}
+}
+
+func TestDecodeClockRates(t *testing.T) {
+	bits := bitsOf(repeat8(0xa5, 0x3c, 0xf0, 0x01, 0x7e, 0x99)...)
+	tail := bits[len(bits)-64:]
+
+	tests := []struct {
+		name     string
+		signalHz float64
+		clockHz  float64
+		decoded  bool
+	}{
+		{"50 Hz", 50, 50, true},
+		{"488 Hz", 488, 488, true},
+		{"488 Hz without clock range", 488, 0, true},
+		{"488 Hz out of the 50 Hz range", 488, 50, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeAll(encode(bits, signalT(tt.signalHz)), WithClockRange(tt.clockHz, 0.2), WithSampleCount(50))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.decoded {
+				if len(got) != 0 {
+					t.Errorf("got %v decoded bits, want none of a clock out of range", len(got))
+				}
+				return
+			}
+			for _, s := range got {
+				if s == port.Invalid {
+					t.Fatalf("got invalid bit in decoded stream %v", got)
+				}
+			}
+			if !hasSuffix(got, tail) {
+				t.Errorf("got decoded bits %v, want the suffix %v", got, tail)
+			}
+		})
+	}
+}
+
+// repeat8 returns the bytes 8 times.
+func repeat8(b ...byte) []byte {
+	var r []byte
+	for i := 0; i < 8; i++ {
+		r = append(r, b...)
+	}
+	return r
+}
+
+func TestDriftCorrection(t *testing.T) {
+	bits := bitsOf(repeat8(repeat8(0xa5, 0x3c, 0xf0, 0x01, 0x7e, 0x99)...)...)
+	tail := bits[len(bits)-64:]
+
+	// the clock speeds up gradually from 50 Hz to ~71 Hz (signalT 10ms >> 7ms)
+	speedUp := func(i int) time.Duration {
+		return 10*time.Millisecond - 3*time.Millisecond*time.Duration(i)/time.Duration(len(bits))
+	}
+	evts := encodeClock(bits, speedUp)
+
+	tests := []struct {
+		name    string
+		alpha   float64
+		correct bool
+	}{
+		// the mid-bit transitions aren't classified correctly, if the clock differs more than 20%
+		{"without drift correction", 0, false},
+		{"with drift correction", 0.05, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeAll(evts, WithSampleCount(50), WithDriftCorrection(tt.alpha))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			correct := hasSuffix(got, tail)
+			for _, s := range got {
+				if s == port.Invalid {
+					correct = false
+				}
+			}
+			if correct != tt.correct {
+				t.Errorf("got correctly decoded bits %v, want %v: %v", correct, tt.correct, got[len(got)-64:])
+			}
+		})
+	}
+}
+
+func TestCorrectDrift(t *testing.T) {
+	const ms = time.Millisecond
+
+	tests := []struct {
+		name    string
+		period  time.Duration
+		signalT time.Duration
+	}{
+		{"slower clock", 21 * ms, 10500 * time.Microsecond},
+		{"faster clock", 19 * ms, 9500 * time.Microsecond},
+		// a single noisy event (deviation above 20%) is ignored
+		{"noisy event", 25 * ms, 10 * ms},
+		{"noisy short event", 13 * ms, 10 * ms},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newDecoder(nil, WithDriftCorrection(0.5))
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.setClock(10*ms, 20*ms)
+
+			// the period of a bit edge is measured from the virtual bit start (signalT before the last mid-bit)
+			d.correctDrift(tt.period)
+			if signalT, _, _ := d.Clock(); signalT != tt.signalT {
+				t.Errorf("got signalT %v, want %v", signalT, tt.signalT)
+			}
+		})
+	}
+}
+
+func TestConvention(t *testing.T) {
+	bits := bitsOf(repeat8(0xa5, 0x3c, 0xf0, 0x01, 0x7e, 0x99)...)
+	// an IEEE 802.3 encoded signal is the inverted Thomas encoded signal
+	inverted := make([]port.StateType, len(bits))
+	for i, b := range bits {
+		inverted[i] = 1 - b
+	}
+	tail, invertedTail := bits[len(bits)-64:], inverted[len(inverted)-64:]
+
+	tests := []struct {
+		name string
+		// signal are the bits of the Thomas encoded signal
+		signal []port.StateType
+		opts   []Option
+		want   []port.StateType
+	}{
+		{"thomas (default)", bits, nil, tail},
+		{"thomas", bits, []Option{WithConvention(ThomasConvention)}, tail},
+		{"ieee", inverted, []Option{WithConvention(IEEEConvention)}, tail},
+		{"thomas signal decoded by ieee", bits, []Option{WithConvention(IEEEConvention)}, invertedTail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeAll(encode(tt.signal, signalT(50)), append(tt.opts, WithSampleCount(50))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !hasSuffix(got, tt.want) {
+				t.Errorf("got decoded bits %v, want the suffix %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := newDecoder(nil, WithConvention(Convention(2))); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("got error %v of an unknown convention, want %v", err, ErrInvalidOption)
+	}
+}
+
+// intervalEvents are line events of a fixed 50 Hz clock (signalT 10ms) with each interval classification:
+//  sync (2), bit edge (2), mid-bit (1), mid-bit (3), other (5, invalid)
+var intervalEvents = []port.Event{
+	{Timestamp: 20 * time.Millisecond, Type: port.FallingEdge},
+	{Timestamp: 30 * time.Millisecond, Type: port.RisingEdge},
+	{Timestamp: 40 * time.Millisecond, Type: port.FallingEdge},
+	{Timestamp: 60 * time.Millisecond, Type: port.RisingEdge},
+	{Timestamp: 105 * time.Millisecond, Type: port.FallingEdge},
+}
+
+// intervalStats are the statistics of intervalEvents.
+var intervalStats = DecoderStats{Bits: 2, Invalid: 1, Resyncs: 1, Interval1: 1, Interval2: 2, Interval3: 1, IntervalOther: 1}
+
+func TestIntervalStats(t *testing.T) {
+	d, err := newDecoder(nil, WithFixedClock(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []port.StateType
+	d.emit = func(s port.StateType, _ time.Duration) { got = append(got, s) }
+	for _, e := range intervalEvents {
+		d.eventHandler(e)
+	}
+
+	if s := d.Stats(); s != intervalStats {
+		t.Errorf("got stats %+v, want %+v", s, intervalStats)
+	}
+	if want := []port.StateType{port.High, port.Low, port.Invalid}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got bits %v, want %v", got, want)
+	}
+}
+
+func TestQuietStart(t *testing.T) {
+	defer func(w, d *log.Logger) { debug.WarningLog, debug.DebugLog = w, d }(debug.WarningLog, debug.DebugLog)
+
+	// an invalid interval before the lock, the sync and 3 bits, an invalid interval after the lock
+	events := []port.Event{
+		{Timestamp: 20 * time.Millisecond, Type: port.FallingEdge},
+		{Timestamp: 40 * time.Millisecond, Type: port.RisingEdge},
+		{Timestamp: 100 * time.Millisecond, Type: port.FallingEdge},
+		{Timestamp: 120 * time.Millisecond, Type: port.FallingEdge},
+		{Timestamp: 140 * time.Millisecond, Type: port.RisingEdge},
+		{Timestamp: 160 * time.Millisecond, Type: port.FallingEdge},
+		{Timestamp: 180 * time.Millisecond, Type: port.RisingEdge},
+		{Timestamp: 240 * time.Millisecond, Type: port.FallingEdge},
+	}
+
+	tests := []struct {
+		name       string
+		quietStart int
+		warnings   int
+		debugs     int
+	}{
+		{"disabled", 0, 2, 0},
+		{"pre-lock warning suppressed", 3, 1, 1},
+		{"lock not achieved", 4, 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings, debugs bytes.Buffer
+			debug.WarningLog, debug.DebugLog = log.New(&warnings, "", 0), log.New(&debugs, "", 0)
+
+			d, err := newDecoder(nil, WithFixedClock(50), WithQuietStart(tt.quietStart))
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.emit = func(port.StateType, time.Duration) {}
+			for _, e := range events {
+				d.eventHandler(e)
+			}
+
+			if s := d.Stats(); s.Invalid != 2 || s.Bits != 4 {
+				t.Fatalf("got stats %+v, want 2 invalid intervals and 4 bits", s)
+			}
+			if got := strings.Count(warnings.String(), "invalid interval"); got != tt.warnings {
+				t.Errorf("got %v warnings of invalid intervals, want %v: %q", got, tt.warnings, warnings.String())
+			}
+			if got := strings.Count(debugs.String(), "invalid interval"); got != tt.debugs {
+				t.Errorf("got %v debug messages of invalid intervals, want %v: %q", got, tt.debugs, debugs.String())
+			}
+		})
+	}
+
+	if _, err := newDecoder(nil, WithQuietStart(-1)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("got error %v of a negative quiet start, want %v", err, ErrInvalidOption)
+	}
+}
@@ -0,0 +1,169 @@
+package manchester
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidOption is returned by NewWithOptions if an option has an invalid value.
+var ErrInvalidOption = errors.New("invalid decoder option")
+
+// Option configures the Decoder, see NewWithOptions.
+type Option func(*Decoder) error
+
+// WithClockRange defines the expected clock frequency (Hz) and the relative tolerance (e.g. 0.2 >> ±20%).
+// If the discovered clock is out of range, the clock discovery is restarted.
+// A clock frequency of 0 disables the range check.
+//
+// Known clock frequencies of the DL-Bus (Technische Alternative):
+//  * UVR31, UVR42, UVR64, HZR65, EEG30, TFM66: 50 Hz
+//  * UVR1611, UVR61-3 (from version 8.3): 488 Hz
+func WithClockRange(clockHz, tolerance float64) Option {
+	return func(d *Decoder) error {
+		if clockHz < 0 || tolerance < 0 || tolerance >= 1 {
+			return ErrInvalidOption
+		}
+
+		d.clockHz = clockHz
+		d.clockTolerance = tolerance
+		return nil
+	}
+}
+
+// WithFixedClock skips the clock discovery and uses the given clock frequency (Hz).
+func WithFixedClock(clockHz float64) Option {
+	return func(d *Decoder) error {
+		if clockHz <= 0 {
+			return ErrInvalidOption
+		}
+
+		d.clockHz = clockHz
+		d.fixedClock = true
+		return nil
+	}
+}
+
+// WithSensitivity defines the factor to calc the mid-bit time intervals (SignalT * factor).
+// The factor must be within (0,1), default is 0.6.
+func WithSensitivity(factor float64) Option {
+	return func(d *Decoder) error {
+		if factor <= 0 || factor >= 1 {
+			return ErrInvalidOption
+		}
+
+		d.sensitivityFactor = factor
+		return nil
+	}
+}
+
+// WithSampleCount defines the count of event samples to discover the clock, default is 500.
+// A lower count speeds up the startup on a clean signal, at least 4 samples are required,
+// because the lowest and highest sample is dropped and both bit periods must be included.
+func WithSampleCount(n int) Option {
+	return func(d *Decoder) error {
+		if n < 4 {
+			return ErrInvalidOption
+		}
+
+		d.sampleCount = n
+		return nil
+	}
+}
+
+// WithGapTimeout enables the detection of a silent line (e.g. unplugged cable).
+// If no event is received within n * signalT while synchronized, port.Invalid is sent to channel C
+// and the decoder restarts synchronizing. The value 0 disables the gap detection (default).
+func WithGapTimeout(n int) Option {
+	return func(d *Decoder) error {
+		if n < 0 {
+			return ErrInvalidOption
+		}
+
+		d.gapTimeout = n
+		return nil
+	}
+}
+
+// WithQuietStart suppresses the startup noise of the log: the warnings of the decoding (e.g. invalid intervals)
+// are downgraded to debug messages, until the lock is achieved for the first time.
+// The lock is achieved, if n consecutive bits are decoded without an invalid interval.
+// The value 0 disables the quiet start (default).
+func WithQuietStart(n int) Option {
+	return func(d *Decoder) error {
+		if n < 0 {
+			return ErrInvalidOption
+		}
+
+		d.quietStart = n
+		return nil
+	}
+}
+
+// WithDriftCorrection enables the continuous correction of the clock drift while synchronized.
+// signalT is adapted by an exponential moving average with the smoothing factor alpha within [0,1),
+// e.g. 0.01 adapts slowly. The value 0 disables the drift correction (default).
+func WithDriftCorrection(alpha float64) Option {
+	return func(d *Decoder) error {
+		if alpha < 0 || alpha >= 1 {
+			return ErrInvalidOption
+		}
+
+		d.driftAlpha = alpha
+		return nil
+	}
+}
+
+// WithTimedStates enables channel CT with the given buffer size,
+// which receives the decoded bit stream with the timestamps of the line events additionally to channel C.
+// Channel CT must be read, otherwise the decoder blocks.
+func WithTimedStates(size int) Option {
+	return func(d *Decoder) error {
+		if size < 0 {
+			return ErrInvalidOption
+		}
+
+		d.CT = make(chan TimedState, size)
+		return nil
+	}
+}
+
+// WithPeriodBounds defines the bounds of a discovered full bit period (clock period).
+// If the discovered period is out of bounds (e.g. discovered during noise), the clock discovery is restarted.
+// The default bounds (1ms..200ms) are a generous range around the DL-Bus clock.
+func WithPeriodBounds(min, max time.Duration) Option {
+	return func(d *Decoder) error {
+		if min <= 0 || max < min {
+			return ErrInvalidOption
+		}
+
+		d.minPeriod = min
+		d.maxPeriod = max
+		return nil
+	}
+}
+
+// WithConvention defines the edge to level mapping of the mid-bit transitions (default: ThomasConvention).
+func WithConvention(c Convention) Option {
+	return func(d *Decoder) error {
+		if c != ThomasConvention && c != IEEEConvention {
+			return ErrInvalidOption
+		}
+
+		d.convention = c
+		return nil
+	}
+}
+
+// validClock checks if the full bit period is within the period bounds and the expected clock range.
+func (d *Decoder) validClock(fullPeriod time.Duration) bool {
+	if fullPeriod < d.minPeriod || fullPeriod > d.maxPeriod {
+		return false
+	}
+
+	if d.clockHz == 0 {
+		return true
+	}
+
+	hz := 1 / fullPeriod.Seconds()
+	return hz >= d.clockHz*(1-d.clockTolerance) && hz <= d.clockHz*(1+d.clockTolerance)
+}
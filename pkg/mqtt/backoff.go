@@ -0,0 +1,52 @@
+package mqtt
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// backoff is the capped exponential backoff with jitter of the reconnects to the broker.
+//  The delay starts with min and is doubled after each failed attempt up to max,
+//  the waiting time is a random time between the half and the full delay (to spread the reconnects of many clients).
+type backoff struct {
+	sync.Mutex
+	min, max time.Duration
+	// delay is the delay of the last failed attempt, 0 means connected.
+	delay time.Duration
+	// rand is the source of the jitter.
+	rand *rand.Rand
+}
+
+// newBackoff returns the backoff with the delays min..max.
+func newBackoff(min, max time.Duration) *backoff {
+	if max < min {
+		max = min
+	}
+	return &backoff{min: min, max: max, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// failed doubles the delay and returns the waiting time until the next attempt.
+func (b *backoff) failed() time.Duration {
+	b.Lock()
+	defer b.Unlock()
+
+	switch {
+	case b.delay == 0:
+		b.delay = b.min
+	case b.delay < b.max:
+		b.delay *= 2
+	}
+	if b.delay > b.max {
+		b.delay = b.max
+	}
+
+	return b.delay/2 + time.Duration(b.rand.Int63n(int64(b.delay/2)+1))
+}
+
+// reset resets the delay after a successful connect.
+func (b *backoff) reset() {
+	b.Lock()
+	defer b.Unlock()
+	b.delay = 0
+}
@@ -0,0 +1,30 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(time.Second, 8*time.Second)
+
+	// the delay is doubled up to max, the wait is between the half and the full delay
+	for _, delay := range []time.Duration{1, 2, 4, 8, 8} {
+		delay *= time.Second
+		if w := b.failed(); w < delay/2 || w > delay {
+			t.Errorf("got wait %v, want %v..%v", w, delay/2, delay)
+		}
+	}
+
+	b.reset()
+	if w := b.failed(); w < 500*time.Millisecond || w > time.Second {
+		t.Errorf("got wait %v after reset, want 500ms..1s", w)
+	}
+}
+
+func TestBackoffMaxBelowMin(t *testing.T) {
+	b := newBackoff(time.Second, time.Millisecond)
+	if w := b.failed(); w > time.Second {
+		t.Errorf("got wait %v, want max 1s", w)
+	}
+}
@@ -0,0 +1,27 @@
+// Package mqtt is the mqtt client of the application.
+// The Handler is the paho client, which supports the authentication and TLS connections to the mqtt broker
+// (e.g. a cloud broker), the package mqttmem provides an in-memory PublisherSubscriber.
+package mqtt
+
+// Message contains the properties of the mqtt message.
+type Message struct {
+	Topic    string
+	Payload  []byte
+	Qos      byte
+	Retained bool
+}
+
+// PublisherSubscriber is the interface of a mqtt client.
+type PublisherSubscriber interface {
+	// Publish the message to mqtt broker
+	Publish(Message) error
+	// Subscribe the topic and the function handler if a message is received
+	Subscribe(string, byte, func(Message)) error
+	// Unsubscribe the topic
+	Unsubscribe(string) error
+	// Close the connection to mqtt broker
+	Close() error
+}
+
+// ensure the Handler satisfies the interface.
+var _ PublisherSubscriber = (*Handler)(nil)
@@ -0,0 +1,358 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/womat/debug"
+)
+
+// ErrNotAuthorized is returned by Connect, if the broker refuses the credentials.
+var ErrNotAuthorized = errors.New("mqtt broker refused the credentials")
+
+// ErrNotConnected is returned by Publish, if the broker isn't connected (e.g. while reconnecting, see backoff).
+var ErrNotConnected = errors.New("mqtt broker not connected")
+
+// quiesce is the specified number of milliseconds to wait for existing work to be completed.
+// connectTimeout is the timeout of the connect (incl. the TLS handshake).
+// willQos is the qos of the availability messages.
+// minReconnectInterval is the first delay of the reconnects, DefaultMaxReconnectInterval is the default maximum delay.
+const (
+	quiesce                     = 250
+	timeout                     = time.Second
+	connectTimeout              = 10 * time.Second
+	willQos                     = 1
+	minReconnectInterval        = time.Second
+	DefaultMaxReconnectInterval = 2 * time.Minute
+)
+
+// Options defines the connection to the mqtt broker.
+type Options struct {
+	// Broker is the connection string, e.g. tcp://localhost:1883 or ssl://broker.example.com:8883.
+	Broker string
+	// ClientID is the client id, an empty id is generated by the broker.
+	ClientID string
+	// Username and Password are the credentials, an empty Username connects without authentication.
+	Username string
+	Password string
+	// TLS enables the TLS connection (ssl:// broker), the server certificate is verified by the system CAs or by CAFile.
+	TLS bool
+	// CAFile is the pem file of the CA certificates to verify the server certificate (optional).
+	CAFile string
+	// CertFile and KeyFile are the pem files of the client certificate (optional).
+	CertFile string
+	KeyFile  string
+	// Will is the availability of the client, see Will.
+	Will Will
+	// MaxReconnectInterval is the maximum delay of the reconnects, the value 0 uses DefaultMaxReconnectInterval.
+	MaxReconnectInterval time.Duration
+	// OnConnect is called after each (re)connect (optional), it must not block.
+	OnConnect func()
+}
+
+// Will defines the availability topic of the client (e.g. for Home Assistant).
+//  The broker publishes the Offline payload as last will, if the connection is lost.
+//  The Online payload is published after each connect, the Offline payload is published by Close.
+//  Both messages are retained, an empty Topic disables the availability.
+type Will struct {
+	Topic   string
+	Online  string
+	Offline string
+}
+
+// Handler contains the handler of the mqtt broker.
+type Handler struct {
+	paho.Client
+	// will is the availability of the client.
+	will Will
+	// connected is called after each (re)connect (see Options.OnConnect).
+	connected func()
+	// backoff delays the reconnects of the reconnect loop.
+	backoff *backoff
+	// reconnecting is 1, while the reconnect loop is running, it's accessed atomically.
+	reconnecting int32
+	// quit is closed by Close to stop the reconnect loop.
+	quit chan struct{}
+	// closeOnce guarantees that quit is closed only once.
+	closeOnce sync.Once
+	// subscriptions contains the subscribed topics, which are subscribed again after a reconnect.
+	subscriptions struct {
+		sync.Mutex
+		topics map[string]subscription
+	}
+}
+
+// subscription is the qos and the message handler of a subscribed topic.
+type subscription struct {
+	qos     byte
+	handler paho.MessageHandler
+}
+
+// New generates a new mqtt broker client and connects to the mqtt broker without authentication, see Connect.
+func New(broker string) (*Handler, error) {
+	return Connect(Options{Broker: broker})
+}
+
+// Connect generates a new mqtt broker client and connects to the mqtt broker.
+func Connect(o Options) (*Handler, error) {
+	if o.Broker == "" {
+		return nil, errors.New("missing broker")
+	}
+
+	if o.MaxReconnectInterval <= 0 {
+		o.MaxReconnectInterval = DefaultMaxReconnectInterval
+	}
+
+	// the reconnects aren't done by paho (SetConnectRetry, SetAutoReconnect), but by the reconnect loop
+	// with a capped exponential backoff, so a refused connect (e.g. ErrNotAuthorized) can be returned
+	opts := paho.NewClientOptions().
+		AddBroker(o.Broker).
+		SetClientID(o.ClientID).
+		SetUsername(o.Username).
+		SetPassword(o.Password).
+		SetConnectTimeout(connectTimeout).
+		SetConnectRetry(false).
+		SetAutoReconnect(false)
+
+	if o.TLS {
+		c, err := tlsConfig(o)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(c)
+	}
+
+	h := Handler{
+		will:      o.Will,
+		connected: o.OnConnect,
+		backoff:   newBackoff(minReconnectInterval, o.MaxReconnectInterval),
+		quit:      make(chan struct{}),
+	}
+	h.subscriptions.topics = map[string]subscription{}
+	if w := o.Will; w.Topic != "" {
+		opts.SetWill(w.Topic, w.Offline, willQos, true)
+	}
+	opts.SetOnConnectHandler(h.onConnect)
+	opts.SetConnectionLostHandler(func(c paho.Client, err error) {
+		debug.WarningLog.Printf("mqtt connection lost: %v", err)
+		h.reconnect()
+	})
+	h.Client = paho.NewClient(opts)
+
+	// a broker, which isn't reachable at startup, is connected by the reconnect loop
+	if err := h.reConnect(); err != nil {
+		if errors.Is(err, ErrNotAuthorized) {
+			return nil, err
+		}
+		debug.WarningLog.Printf("can't connect to mqtt broker %v, retry in background: %v", o.Broker, err)
+		h.reconnect()
+	}
+	return &h, nil
+}
+
+// tlsConfig returns the TLS configuration of the options o.
+func tlsConfig(o Options) (*tls.Config, error) {
+	c := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if o.CAFile != "" {
+		pem, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read mqtt ca file: %w", err)
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in mqtt ca file %q", o.CAFile)
+		}
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load mqtt client certificate: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+
+	return c, nil
+}
+
+// Close will end the connection to the broker.
+//  The availability is set to offline before, because the broker doesn't publish the will on a disconnect.
+func (m *Handler) Close() error {
+	if m.Client == nil {
+		return nil
+	}
+	m.closeOnce.Do(func() { close(m.quit) })
+
+	if m.will.Topic != "" && m.Client.IsConnected() {
+		if err := m.publishAvailability(m.will.Offline); err != nil {
+			debug.WarningLog.Printf("can't publish mqtt availability %q: %v", m.will.Offline, err)
+		}
+	}
+
+	m.Client.Disconnect(quiesce)
+	return nil
+}
+
+// onConnect resets the backoff, subscribes the topics again and publishes the availability after each (re)connect,
+// then Options.OnConnect is called.
+//  The broker drops the subscriptions of a lost connection (clean session).
+func (m *Handler) onConnect(c paho.Client) {
+	m.backoff.reset()
+
+	m.subscriptions.Lock()
+	for topic, s := range m.subscriptions.topics {
+		if t := c.Subscribe(topic, s.qos, s.handler); t.WaitTimeout(timeout) && t.Error() != nil {
+			debug.WarningLog.Printf("can't subscribe mqtt topic %v again: %v", topic, t.Error())
+		}
+	}
+	m.subscriptions.Unlock()
+
+	if m.will.Topic != "" {
+		if err := m.publishAvailability(m.will.Online); err != nil {
+			debug.WarningLog.Printf("can't publish mqtt availability %q: %v", m.will.Online, err)
+		}
+	}
+
+	if m.connected != nil {
+		m.connected()
+	}
+}
+
+// publishAvailability publishes the availability payload p as retained message to the will topic.
+func (m *Handler) publishAvailability(p string) error {
+	t := m.Client.Publish(m.will.Topic, willQos, true, p)
+	if !t.WaitTimeout(timeout) {
+		return errors.New("time out")
+	}
+	return t.Error()
+}
+
+// Publish the message to mqtt broker
+// If none topic is defined, no mqtt message are send.
+//  If the broker isn't connected, ErrNotConnected is returned, the broker is reconnected by the reconnect loop.
+func (m *Handler) Publish(msg Message) error {
+	if msg.Topic == "" {
+		return errors.New("missing topic")
+	}
+
+	if !m.Client.IsConnected() {
+		return ErrNotConnected
+	}
+
+	t := m.Client.Publish(msg.Topic, msg.Qos, msg.Retained, msg.Payload)
+	if !t.WaitTimeout(timeout) {
+		return errors.New("time out")
+	}
+	return t.Error()
+}
+
+// Subscribe waits for a message and call the function handler
+//  If the broker isn't connected, the topic is subscribed after the connect.
+func (m *Handler) Subscribe(topic string, qos byte, handler func(Message)) error {
+	msgHandler := func(c paho.Client, msg paho.Message) {
+		handler(Message{
+			Topic:    msg.Topic(),
+			Payload:  msg.Payload(),
+			Qos:      msg.Qos(),
+			Retained: msg.Retained(),
+		})
+	}
+
+	m.subscriptions.Lock()
+	defer m.subscriptions.Unlock()
+
+	if m.Client.IsConnected() {
+		t := m.Client.Subscribe(topic, qos, msgHandler)
+		if !t.WaitTimeout(timeout) {
+			return errors.New("time out")
+		}
+		if err := t.Error(); err != nil {
+			return err
+		}
+	}
+
+	m.subscriptions.topics[topic] = subscription{qos: qos, handler: msgHandler}
+	return nil
+}
+
+// Unsubscribe will end the subscription from each of the topic provided.
+// Messages published to those topics from other clients will no longer be
+// received.
+func (m *Handler) Unsubscribe(topic string) error {
+	m.subscriptions.Lock()
+	delete(m.subscriptions.topics, topic)
+	m.subscriptions.Unlock()
+
+	t := m.Client.Unsubscribe(topic)
+
+	if !t.WaitTimeout(timeout) {
+		return errors.New("time out")
+	}
+	return t.Error()
+}
+
+// reConnect reconnects to the defined mqtt broker.
+//  A refused authentication returns ErrNotAuthorized.
+func (m *Handler) reConnect() error {
+	t := m.Client.Connect()
+	if !t.WaitTimeout(connectTimeout) {
+		return errors.New("time out")
+	}
+
+	switch err := t.Error(); {
+	case errors.Is(err, packets.ErrorRefusedBadUsernameOrPassword), errors.Is(err, packets.ErrorRefusedNotAuthorised):
+		return fmt.Errorf("%w: %v", ErrNotAuthorized, err)
+	case err != nil:
+		return err
+	}
+	return nil
+}
+
+// reconnect starts the reconnect loop, if it isn't running.
+func (m *Handler) reconnect() {
+	if atomic.CompareAndSwapInt32(&m.reconnecting, 0, 1) {
+		go m.reconnectLoop()
+	}
+}
+
+// reconnectLoop reconnects to the broker with a capped exponential backoff, until it's connected or closed.
+//  A refused authentication is retried too, after the startup the credentials may be changed at the broker.
+func (m *Handler) reconnectLoop() {
+	for {
+		select {
+		case <-m.quit:
+			atomic.StoreInt32(&m.reconnecting, 0)
+			return
+		case <-time.After(m.backoff.failed()):
+		}
+
+		if err := m.reConnect(); err != nil {
+			debug.WarningLog.Printf("can't reconnect to mqtt broker: %v", err)
+			continue
+		}
+
+		// a connect concurrent to Close is disconnected again
+		select {
+		case <-m.quit:
+			m.Client.Disconnect(quiesce)
+			atomic.StoreInt32(&m.reconnecting, 0)
+			return
+		default:
+		}
+
+		atomic.StoreInt32(&m.reconnecting, 0)
+		// the connection may be lost again, before the loop is marked as stopped
+		if m.Client.IsConnected() || !atomic.CompareAndSwapInt32(&m.reconnecting, 0, 1) {
+			return
+		}
+	}
+}
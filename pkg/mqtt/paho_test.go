@@ -0,0 +1,215 @@
+package mqtt
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestConnectUnreachable(t *testing.T) {
+	// nothing listens on port 1, the connect is refused immediately
+	h, err := Connect(Options{Broker: "tcp://127.0.0.1:1", MaxReconnectInterval: time.Second})
+	if err != nil {
+		t.Fatalf("got error %v, want the handler retrying in background", err)
+	}
+
+	if atomic.LoadInt32(&h.reconnecting) != 1 {
+		t.Error("the reconnect loop isn't running")
+	}
+	if err = h.Publish(Message{Topic: "tadl", Payload: []byte("{}")}); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("got error %v, want %v", err, ErrNotConnected)
+	}
+	if err = h.Subscribe("tadl/cmd", 0, func(Message) {}); err != nil {
+		t.Errorf("got error %v of a subscribe while not connected, want nil", err)
+	}
+
+	if err = h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&h.reconnecting) == 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("the reconnect loop isn't stopped by Close")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConnectMissingBroker(t *testing.T) {
+	if _, err := Connect(Options{}); err == nil {
+		t.Error("got no error without broker")
+	}
+}
+
+// testBroker is a minimal mqtt broker, which accepts the connects, acknowledges the subscriptions and publishes
+// and records the subscribed topics and the published messages.
+type testBroker struct {
+	net.Listener
+	// subscribed receives the subscribed topics (Topic only).
+	subscribed chan connMessage
+	// published receives the published messages.
+	published chan connMessage
+	// conn is the current connection of the client.
+	conn struct {
+		sync.Mutex
+		net.Conn
+	}
+}
+
+// newTestBroker starts the broker on a local port, it's closed at the end of the test.
+func newTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &testBroker{Listener: l, subscribed: make(chan connMessage, 10), published: make(chan connMessage, 10)}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for n := 1; ; n++ {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			b.conn.Lock()
+			b.conn.Conn = c
+			b.conn.Unlock()
+			go b.serve(c, n)
+		}
+	}()
+	return b
+}
+
+// connMessage is a message received by the n-th connection of the broker.
+type connMessage struct {
+	Message
+	n int
+}
+
+// serve handles the packets of the n-th connection c, until it's closed.
+func (b *testBroker) serve(c net.Conn, n int) {
+	defer c.Close()
+
+	for {
+		p, err := packets.ReadPacket(c)
+		if err != nil {
+			return
+		}
+
+		var resp packets.ControlPacket
+		switch p := p.(type) {
+		case *packets.ConnectPacket:
+			resp = packets.NewControlPacket(packets.Connack)
+		case *packets.SubscribePacket:
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID, ack.ReturnCodes = p.MessageID, p.Qoss
+			resp = ack
+			for _, topic := range p.Topics {
+				b.subscribed <- connMessage{Message: Message{Topic: topic}, n: n}
+			}
+		case *packets.PublishPacket:
+			if p.Qos > 0 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				resp = ack
+			}
+			b.published <- connMessage{Message: Message{Topic: p.TopicName, Payload: p.Payload, Qos: p.Qos, Retained: p.Retain}, n: n}
+		case *packets.PingreqPacket:
+			resp = packets.NewControlPacket(packets.Pingresp)
+		case *packets.DisconnectPacket:
+			return
+		}
+
+		if resp != nil {
+			if err = resp.Write(c); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// send publishes the message to the client of the current connection.
+func (b *testBroker) send(topic, payload string) error {
+	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	p.TopicName, p.Payload = topic, []byte(payload)
+
+	b.conn.Lock()
+	defer b.conn.Unlock()
+	return p.Write(b.conn.Conn)
+}
+
+// drop closes the current connection, e.g. the connection to the client is lost.
+func (b *testBroker) drop() {
+	b.conn.Lock()
+	defer b.conn.Unlock()
+	_ = b.conn.Close()
+}
+
+func TestReconnect(t *testing.T) {
+	b := newTestBroker(t)
+
+	connects := make(chan struct{}, 4)
+	h, err := Connect(Options{
+		Broker:               "tcp://" + b.Addr().String(),
+		Will:                 Will{Topic: "tadl/availability", Online: "online", Offline: "offline"},
+		MaxReconnectInterval: time.Second,
+		OnConnect:            func() { connects <- struct{}{} },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	received := make(chan Message, 4)
+	if err = h.Subscribe("tadl/cmd", 1, func(m Message) { received <- m }); err != nil {
+		t.Fatal(err)
+	}
+
+	// connected waits for the n-th connect: OnConnect is called, the topic is subscribed and the availability is published
+	connected := func(n int) {
+		t.Helper()
+
+		var subscribed, online, called bool
+		for timeout := time.After(3 * time.Second); !subscribed || !online || !called; {
+			select {
+			case m := <-b.subscribed:
+				subscribed = subscribed || m.n == n && m.Topic == "tadl/cmd"
+			case m := <-b.published:
+				online = online || m.n == n && m.Topic == "tadl/availability" && string(m.Payload) == "online" && m.Retained
+			case <-connects:
+				called = true
+			case <-timeout:
+				t.Fatalf("connect %v: got subscribed %v, online %v, OnConnect %v, want all", n, subscribed, online, called)
+			}
+		}
+	}
+	connected(1)
+
+	// the lost connection is reconnected by the reconnect loop (after the first backoff delay)
+	b.drop()
+	connected(2)
+
+	// the messages of the subscribed topic are delivered to the handler of the new connection
+	if err = b.send("tadl/cmd", "publish"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-received:
+		if m.Topic != "tadl/cmd" || string(m.Payload) != "publish" {
+			t.Errorf("got message %+v, want the command publish", m)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("got no message of the subscribed topic after the reconnect")
+	}
+
+	if err = h.Publish(Message{Topic: "tadl", Payload: []byte("{}")}); err != nil {
+		t.Errorf("got error %v of a publish after the reconnect, want nil", err)
+	}
+}
@@ -0,0 +1,141 @@
+// Package mqttmem is an in-memory implementation of the mqtt.PublisherSubscriber interface.
+// Published messages are recorded and delivered to the matching subscribers,
+// e.g. to verify published messages in tests or to run the application without a mqtt broker.
+package mqttmem
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"tadl/pkg/mqtt"
+)
+
+// ErrClosed is returned if the Broker is already closed.
+var ErrClosed = errors.New("broker closed")
+
+// Broker is the in-memory mqtt broker and client.
+type Broker struct {
+	sync.Mutex
+	// messages contains all published messages.
+	messages []mqtt.Message
+	// retained contains the last retained message per topic.
+	retained map[string]mqtt.Message
+	// handlers contains the subscribed handlers per topic filter.
+	handlers map[string]func(mqtt.Message)
+	// closed is true if the Broker is closed.
+	closed bool
+}
+
+// New generates a new in-memory broker.
+func New() *Broker {
+	return &Broker{
+		retained: map[string]mqtt.Message{},
+		handlers: map[string]func(mqtt.Message){},
+	}
+}
+
+// Publish records the message and delivers it to all matching subscribers (with retained flag false).
+func (b *Broker) Publish(msg mqtt.Message) error {
+	if msg.Topic == "" {
+		return errors.New("missing topic")
+	}
+
+	b.Lock()
+	if b.closed {
+		b.Unlock()
+		return ErrClosed
+	}
+
+	b.messages = append(b.messages, msg)
+	if msg.Retained {
+		b.retained[msg.Topic] = msg
+	}
+
+	// like a mqtt broker, the retained flag is only set for retained messages delivered on subscribe
+	live := msg
+	live.Retained = false
+
+	var handlers []func(mqtt.Message)
+	for filter, h := range b.handlers {
+		if match(filter, msg.Topic) {
+			handlers = append(handlers, h)
+		}
+	}
+	b.Unlock()
+
+	for _, h := range handlers {
+		h(live)
+	}
+
+	return nil
+}
+
+// Subscribe the topic filter (wildcards + and # are supported), retained messages are delivered immediately.
+func (b *Broker) Subscribe(topic string, _ byte, handler func(mqtt.Message)) error {
+	b.Lock()
+	if b.closed {
+		b.Unlock()
+		return ErrClosed
+	}
+
+	b.handlers[topic] = handler
+
+	var retained []mqtt.Message
+	for t, msg := range b.retained {
+		if match(topic, t) {
+			retained = append(retained, msg)
+		}
+	}
+	b.Unlock()
+
+	for _, msg := range retained {
+		handler(msg)
+	}
+
+	return nil
+}
+
+// Unsubscribe the topic filter.
+func (b *Broker) Unsubscribe(topic string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	delete(b.handlers, topic)
+	return nil
+}
+
+// Close the broker, further publishes and subscriptions fail.
+func (b *Broker) Close() error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.closed = true
+	return nil
+}
+
+// Messages returns a copy of all published messages.
+func (b *Broker) Messages() []mqtt.Message {
+	b.Lock()
+	defer b.Unlock()
+
+	return append([]mqtt.Message{}, b.messages...)
+}
+
+// match checks if the topic matches the topic filter.
+func match(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+
+	for i, level := range f {
+		switch {
+		case level == "#":
+			return true
+		case i >= len(t):
+			return false
+		case level != "+" && level != t[i]:
+			return false
+		}
+	}
+
+	return len(f) == len(t)
+}
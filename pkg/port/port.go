@@ -1,7 +1,10 @@
 // Package port holds the definition of a physical port
 package port
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
 const (
 	_ EventType = iota
@@ -32,3 +35,23 @@ type Event struct {
 	// The type of state change event this structure represents.
 	Type EventType
 }
+
+// ChannelFill contains the fill level of a channel, e.g. to detect a stage of a pipeline, which is backing up.
+type ChannelFill struct {
+	// Current is the current count of elements in the channel.
+	Current int
+	// Peak is the maximum count of elements in the channel.
+	Peak int
+	// Capacity is the capacity of the channel.
+	Capacity int
+}
+
+// UpdatePeak sets the peak atomically to n, if n is greater than the peak.
+func UpdatePeak(peak *int32, n int) {
+	for {
+		p := atomic.LoadInt32(peak)
+		if int32(n) <= p || atomic.CompareAndSwapInt32(peak, p, int32(n)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package raspberry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/warthog618/gpiod"
+	"github.com/womat/debug"
+	"tadl/pkg/port"
+)
+
+// Chip represents a single GPIO chip that controls a set of lines.
+type Chip struct {
+	gpiodChip *gpiod.Chip
+}
+
+// Open opens the GPIO character device of the default chip (gpiochip0).
+func Open() (*Chip, error) {
+	return OpenChip(DefaultChip)
+}
+
+// OpenChip opens the GPIO character device of the chip name (e.g. gpiochip4 on Pi 5).
+func OpenChip(name string) (*Chip, error) {
+	c, err := gpiod.NewChip(name)
+	if err != nil {
+		return nil, fmt.Errorf("can't open gpio chip %q: %w", name, err)
+	}
+	return &Chip{gpiodChip: c}, nil
+}
+
+// NewLine requests control of a single line on a chip.
+//   If granted, control is maintained until the Line is closed.
+//   Watch the line for edge changes and send the changes after bounce timeout to chanel C.
+//   An edge within the debounce period after the last sent edge is suppressed, the value 0 disables the debounce.
+//   There can only be one watcher on the pin at a time.
+//   The events are dropped (see LineStats.Dropped), if channel C is full, so a stalled reader can't block the edge handling.
+func (c *Chip) NewLine(gpio int, terminator string, debounce time.Duration, opts ...LineOption) (*Line, error) {
+	line, err := newLine(debounce, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// handler check the bounce timeout and send the event to channel C
+	handler := func(evt gpiod.LineEvent) {
+		switch evt.Type {
+		case gpiod.LineEventFallingEdge:
+			line.send(port.Event{Type: port.FallingEdge, Timestamp: evt.Timestamp})
+		case gpiod.LineEventRisingEdge:
+			line.send(port.Event{Type: port.RisingEdge, Timestamp: evt.Timestamp})
+		}
+	}
+
+	reqOpts := []gpiod.LineReqOption{gpiod.WithEventHandler(handler), gpiod.WithBothEdges, gpiod.AsInput}
+
+	switch terminator {
+	case "pullup":
+		reqOpts = append(reqOpts, gpiod.WithPullUp)
+	case "pulldown":
+		reqOpts = append(reqOpts, gpiod.WithPullDown)
+	case "none":
+	default:
+		return nil, ErrInvalidParam
+	}
+
+	// the kernel reports the edges of the logical level, so the edges are inverted too
+	if line.activeLow {
+		reqOpts = append(reqOpts, gpiod.AsActiveLow)
+	}
+
+	if line.hardwareDebounce && debounce > 0 {
+		// the in-kernel debounce requires Linux v5.10 or later, otherwise the software debounce is used
+		if line.backend, err = c.gpiodChip.RequestLine(gpio, append(reqOpts, gpiod.WithDebounce(debounce))...); err == nil {
+			line.sl.Lock()
+			line.debouncer.interval = 0
+			line.stats.Debounce = DebounceHardware
+			line.sl.Unlock()
+			return line, nil
+		}
+		debug.WarningLog.Printf("hardware debounce isn't supported (%v), use software debounce", err)
+	}
+
+	if line.backend, err = c.gpiodChip.RequestLine(gpio, reqOpts...); err != nil {
+		return nil, err
+	}
+	return line, nil
+}
+
+// NewLineContext requests control of a single line like NewLine,
+// the line is closed (the gpiod line is released), when the context is done.
+func (c *Chip) NewLineContext(ctx context.Context, gpio int, terminator string, debounce time.Duration, opts ...LineOption) (*Line, error) {
+	l, err := c.NewLine(gpio, terminator, debounce, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	l.closeOnDone(ctx)
+	return l, nil
+}
+
+// Close releases the Chip.
+//
+// It does not release any lines which may be requested - they must be closed
+// independently.
+func (c *Chip) Close() error {
+	return c.gpiodChip.Close()
+}
@@ -0,0 +1,37 @@
+//go:build !linux
+// +build !linux
+
+package raspberry
+
+import (
+	"context"
+	"time"
+)
+
+// Chip represents a single GPIO chip, which isn't supported by the operating system (see MockChip).
+type Chip struct{}
+
+// Open returns ErrNotSupported, the gpio chips are only supported on linux.
+func Open() (*Chip, error) {
+	return OpenChip(DefaultChip)
+}
+
+// OpenChip returns ErrNotSupported, the gpio chips are only supported on linux.
+func OpenChip(name string) (*Chip, error) {
+	return nil, ErrNotSupported
+}
+
+// NewLine returns ErrNotSupported.
+func (c *Chip) NewLine(gpio int, terminator string, debounce time.Duration, opts ...LineOption) (*Line, error) {
+	return nil, ErrNotSupported
+}
+
+// NewLineContext returns ErrNotSupported.
+func (c *Chip) NewLineContext(ctx context.Context, gpio int, terminator string, debounce time.Duration, opts ...LineOption) (*Line, error) {
+	return nil, ErrNotSupported
+}
+
+// Close releases the Chip.
+func (c *Chip) Close() error {
+	return nil
+}
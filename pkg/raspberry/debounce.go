@@ -0,0 +1,29 @@
+package raspberry
+
+import (
+	"time"
+
+	"tadl/pkg/port"
+)
+
+// debouncer suppresses the bouncing edges of a line (e.g. a contact or a noisy signal):
+// an event within the debounce interval after the last accepted event is suppressed.
+// It works on port.Event, so it doesn't depend on the gpiod backend.
+type debouncer struct {
+	// interval is the debounce period, the value 0 disables the debounce.
+	interval time.Duration
+	// accepted is the timestamp of the last accepted event.
+	accepted time.Duration
+	// started is true, if an event has been accepted.
+	started bool
+}
+
+// accept returns true, if the event isn't suppressed by the debounce period.
+func (d *debouncer) accept(evt port.Event) bool {
+	if d.interval > 0 && d.started && evt.Timestamp-d.accepted < d.interval {
+		return false
+	}
+
+	d.accepted, d.started = evt.Timestamp, true
+	return true
+}
@@ -0,0 +1,69 @@
+package raspberry
+
+import (
+	"testing"
+	"time"
+
+	"tadl/pkg/port"
+)
+
+func TestDebouncer(t *testing.T) {
+	const ms = time.Millisecond
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		times    []time.Duration
+		want     []bool
+	}{
+		{"disabled", 0, []time.Duration{0, 1 * ms, 2 * ms}, []bool{true, true, true}},
+		{"bouncing edges", 5 * ms, []time.Duration{10 * ms, 11 * ms, 14 * ms, 15 * ms, 30 * ms}, []bool{true, false, false, true, true}},
+		// the interval starts with the last accepted event, not with the last suppressed event
+		{"continuous bouncing", 5 * ms, []time.Duration{0, 3 * ms, 6 * ms, 9 * ms}, []bool{true, false, true, false}},
+		{"first event at zero", 5 * ms, []time.Duration{0, 4 * ms}, []bool{true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := debouncer{interval: tt.interval}
+			for i, ts := range tt.times {
+				if got := d.accept(port.Event{Timestamp: ts, Type: port.RisingEdge}); got != tt.want[i] {
+					t.Errorf("event %v at %v: got accepted %v, want %v", i, ts, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLineDebounce(t *testing.T) {
+	const ms = time.Millisecond
+
+	chip := NewMockChip()
+	l, err := chip.NewLine(17, "none", 5*ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	m := chip.Line(17)
+	for _, ts := range []time.Duration{10 * ms, 12 * ms, 20 * ms, 21 * ms} {
+		m.Push(port.Event{Timestamp: ts, Type: port.RisingEdge})
+	}
+
+	s := l.Stats()
+	if s.Events != 4 || s.Suppressed != 2 || s.Debounce != DebounceSoftware {
+		t.Errorf("got events %v suppressed %v debounce %q, want 4 2 %q", s.Events, s.Suppressed, s.Debounce, DebounceSoftware)
+	}
+	if s.MinInterval != 1*ms || s.MaxInterval != 8*ms {
+		t.Errorf("got intervals %v..%v, want 1ms..8ms", s.MinInterval, s.MaxInterval)
+	}
+
+	if n := len(l.C); n != 2 {
+		t.Fatalf("got %v events in channel C, want 2", n)
+	}
+	if e := <-l.C; e.Timestamp != 10*ms {
+		t.Errorf("got first event at %v, want 10ms", e.Timestamp)
+	}
+	if e := <-l.C; e.Timestamp != 20*ms {
+		t.Errorf("got second event at %v, want 20ms", e.Timestamp)
+	}
+}
@@ -0,0 +1,108 @@
+package raspberry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"tadl/pkg/port"
+)
+
+// MockChip is a software emulated GPIO chip, e.g. to test the decoding pipeline without a raspberry pi.
+// The events of its lines are pushed by MockLine.Push or MockLine.Play instead of a gpio pin.
+type MockChip struct {
+	// lines contains the requested lines by gpio.
+	lines map[int]*MockLine
+	// ml protects lines
+	ml sync.Mutex
+}
+
+// MockLine is an emulated line of a MockChip.
+type MockLine struct {
+	*Line
+}
+
+// NewMockChip returns an emulated GPIO chip without requested lines.
+func NewMockChip() *MockChip {
+	return &MockChip{lines: map[int]*MockLine{}}
+}
+
+// NewLine requests an emulated line, see Chip.NewLine.
+//  The emulated line can be accessed by MockChip.Line(gpio) to push events.
+//  The emulated line has no hardware debounce, the software debounce is used instead.
+func (c *MockChip) NewLine(gpio int, terminator string, debounce time.Duration, opts ...LineOption) (*Line, error) {
+	switch terminator {
+	case "pullup", "pulldown", "none":
+	default:
+		return nil, ErrInvalidParam
+	}
+
+	line, err := newLine(debounce, opts...)
+	if err != nil {
+		return nil, err
+	}
+	line.emulated = true
+	l := &MockLine{Line: line}
+
+	c.ml.Lock()
+	defer c.ml.Unlock()
+	c.lines[gpio] = l
+	return l.Line, nil
+}
+
+// NewLineContext requests an emulated line, which is closed when the context is done, see Chip.NewLineContext.
+func (c *MockChip) NewLineContext(ctx context.Context, gpio int, terminator string, debounce time.Duration, opts ...LineOption) (*Line, error) {
+	l, err := c.NewLine(gpio, terminator, debounce, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	l.closeOnDone(ctx)
+	return l, nil
+}
+
+// Line returns the emulated line of the gpio, or nil if it isn't requested.
+func (c *MockChip) Line(gpio int) *MockLine {
+	c.ml.Lock()
+	defer c.ml.Unlock()
+	return c.lines[gpio]
+}
+
+// Close releases the chip, the requested lines must be closed independently.
+func (c *MockChip) Close() error {
+	return nil
+}
+
+// Push sends the event to channel C as a physical edge of the gpio pin (incl. debounce and statistics).
+//  The edge is inverted, if the line is active low (see WithActiveLow).
+//  The event is dropped, if the line is closed.
+func (l *MockLine) Push(evt port.Event) {
+	if l.activeLow {
+		switch evt.Type {
+		case port.RisingEdge:
+			evt.Type = port.FallingEdge
+		case port.FallingEdge:
+			evt.Type = port.RisingEdge
+		}
+	}
+	l.send(evt)
+}
+
+// Play pushes the events in real-time: each event is delayed by the difference of its timestamp to the previous event.
+//  The returned channel is closed, when all events are pushed.
+func (l *MockLine) Play(events []port.Event) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for i, evt := range events {
+			if i > 0 {
+				time.Sleep(evt.Timestamp - events[i-1].Timestamp)
+			}
+			l.Push(evt)
+		}
+	}()
+
+	return done
+}
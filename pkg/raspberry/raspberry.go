@@ -2,76 +2,250 @@
 package raspberry
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/warthog618/gpiod"
 	"tadl/pkg/port"
 )
 
 var ErrInvalidParam = fmt.Errorf("invalid parameters")
 
-// Chip represents a single GPIO chip that controls a set of lines.
-type Chip struct {
-	gpiodChip *gpiod.Chip
+// ErrNotSupported is returned by OpenChip, if the gpio chips aren't supported by the operating system.
+var ErrNotSupported = errors.New("gpio chips are only supported on linux")
+
+// LineRequester is implemented by a GPIO chip (Chip or MockChip), which requests the lines.
+// The gpiod backend (Chip) requires linux, the emulation (MockChip) runs on every operating system.
+type LineRequester interface {
+	// NewLine requests control of a single line, see Chip.NewLine.
+	NewLine(gpio int, terminator string, debounce time.Duration, opts ...LineOption) (*Line, error)
+	// NewLineContext requests control of a single line, which is closed when the context is done.
+	NewLineContext(ctx context.Context, gpio int, terminator string, debounce time.Duration, opts ...LineOption) (*Line, error)
+	// Close releases the chip.
+	Close() error
+}
+
+// lineBackend is the requested line of a gpio chip backend (e.g. *gpiod.Line).
+type lineBackend interface {
+	Value() (int, error)
+	Close() error
 }
 
 // Line represents a single requested line.
 type Line struct {
-	gpiodLine *gpiod.Line
+	// backend is the requested line of the gpio chip (e.g. gpiod), nil for an emulated line.
+	backend lineBackend
 	// send edge changes to channel
 	C chan port.Event
+	// peak is the maximum fill level of channel C, updated atomically.
+	peak int32
+	// level is the logical level after the last event of an emulated line, updated atomically.
+	level int32
+	// emulated is true for an emulated line (MockChip) without backend.
+	emulated bool
+	// activeLow is true, if the level of the line is inverted (see WithActiveLow).
+	activeLow bool
+	// hardwareDebounce is true, if the in-kernel debounce is requested (see WithHardwareDebounce).
+	hardwareDebounce bool
+	// closeOnce guarantees that the line is closed only once.
+	closeOnce sync.Once
+	// closed is true, if channel C is closed.
+	closed bool
+	// done is closed by Close.
+	done chan struct{}
+	// hl serializes the sends to channel C and the closing of channel C.
+	hl sync.Mutex
+	// stats contains the edge statistics, see Stats.
+	stats LineStats
+	// last is the timestamp of the last received event.
+	last time.Duration
+	// debouncer suppresses the edges within the debounce period.
+	debouncer debouncer
+	// sl protects stats, last and debouncer
+	sl sync.Mutex
+}
+
+// LineStats contains the edge statistics of a Line, e.g. to verify the debounce period.
+type LineStats struct {
+	// Events is the count of received events (edges).
+	Events uint64
+	// Suppressed is the count of events suppressed by the debounce period.
+	Suppressed uint64
+	// Dropped is the count of events dropped, because channel C was full.
+	Dropped uint64
+	// MinInterval and MaxInterval are the minimum and maximum interval between two received events.
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// Debounce is the active debounce mode (DebounceNone, DebounceSoftware or DebounceHardware).
+	Debounce string
+}
+
+// DefaultChip is the GPIO chip of the header pins of the raspberry pi (up to Pi 4).
+const DefaultChip = "gpiochip0"
+
+// debounce modes of a line, see LineStats.Debounce.
+const (
+	DebounceNone     = "none"
+	DebounceSoftware = "software"
+	DebounceHardware = "hardware"
+)
+
+// closeOnDone closes the line, when the context is done. The watching goroutine exits, if the line is closed.
+func (l *Line) closeOnDone(ctx context.Context) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = l.Close()
+		case <-l.done:
+		}
+	}()
+}
+
+// defaultBuffer is the default buffer size of channel C.
+const defaultBuffer = 100
+
+// LineOption is an option of a line, see NewLine.
+type LineOption func(*lineOptions) error
+
+// lineOptions contains the options of a line.
+type lineOptions struct {
+	buffer           int
+	activeLow        bool
+	hardwareDebounce bool
+}
+
+// WithBuffer defines the buffer size of channel C (default 100).
+func WithBuffer(n int) LineOption {
+	return func(o *lineOptions) error {
+		if n < 1 {
+			return ErrInvalidParam
+		}
+
+		o.buffer = n
+		return nil
+	}
+}
+
+// WithActiveLow inverts the level of the line (e.g. an inverting interface circuit like an opto-isolator).
+// The edges are reported for the inverted level: a physical falling edge is a port.RisingEdge.
+// Since the manchester decoding depends on the edge direction, the inversion restores the polarity
+// of the decoded bits of an inverting circuit (alternatively to the convention of the manchester decoder).
+func WithActiveLow() LineOption {
+	return func(o *lineOptions) error {
+		o.activeLow = true
+		return nil
+	}
+}
+
+// WithHardwareDebounce uses the in-kernel debounce (Linux v5.10 or later) instead of the software debounce,
+// which saves CPU and keeps the timestamps of the edges accurate.
+// If the kernel rejects the debounce, the software debounce is used (see LineStats.Debounce).
+func WithHardwareDebounce() LineOption {
+	return func(o *lineOptions) error {
+		o.hardwareDebounce = true
+		return nil
+	}
 }
 
-// Open opens a GPIO character device and initialize the global lines slice
-func Open() (*Chip, error) {
-	c, err := gpiod.NewChip("gpiochip0")
-	chip := Chip{gpiodChip: c}
-	return &chip, err
+// newLine returns a line with the debounce period without backend.
+func newLine(debounce time.Duration, opts ...LineOption) (*Line, error) {
+	o := lineOptions{buffer: defaultBuffer}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	mode := DebounceNone
+	if debounce > 0 {
+		mode = DebounceSoftware
+	}
+
+	return &Line{
+		C:                make(chan port.Event, o.buffer),
+		activeLow:        o.activeLow,
+		hardwareDebounce: o.hardwareDebounce,
+		done:             make(chan struct{}),
+		debouncer:        debouncer{interval: debounce},
+		stats:            LineStats{Debounce: mode},
+	}, nil
 }
 
-// NewLine requests control of a single line on a chip.
-//   If granted, control is maintained until the Line is closed.
-//   Watch the line for edge changes and send the changes after bounce timeout to chanel C.
-//   There can only be one watcher on the pin at a time.
-func (c *Chip) NewLine(gpio int, terminator string, debounce time.Duration) (*Line, error) {
-	var err error
+// send sends the event to channel C, unless it's suppressed by the debounce period.
+// The event is dropped, if channel C is full.
+func (l *Line) send(evt port.Event) {
+	l.hl.Lock()
+	defer l.hl.Unlock()
 
-	line := &Line{C: make(chan port.Event, 100)}
+	if l.closed || !l.accept(evt) {
+		return
+	}
 
-	// handler check the bounce timeout and send the event to channel C
-	handler := func(evt gpiod.LineEvent) {
-		switch evt.Type {
-		case gpiod.LineEventFallingEdge:
-			line.C <- port.Event{Type: port.FallingEdge, Timestamp: evt.Timestamp}
-		case gpiod.LineEventRisingEdge:
-			line.C <- port.Event{Type: port.RisingEdge, Timestamp: evt.Timestamp}
+	if l.emulated {
+		var level int32
+		if evt.Type == port.RisingEdge {
+			level = 1
 		}
+		atomic.StoreInt32(&l.level, level)
 	}
 
-	switch terminator {
-	case "pullup":
-		line.gpiodLine, err = c.gpiodChip.RequestLine(gpio, gpiod.WithEventHandler(handler),
-			gpiod.WithBothEdges, gpiod.AsInput, gpiod.WithPullUp)
-	case "pulldown":
-		line.gpiodLine, err = c.gpiodChip.RequestLine(gpio, gpiod.WithEventHandler(handler),
-			gpiod.WithBothEdges, gpiod.AsInput, gpiod.WithPullDown)
-	case "none":
-		line.gpiodLine, err = c.gpiodChip.RequestLine(gpio, gpiod.WithEventHandler(handler),
-			gpiod.WithBothEdges, gpiod.AsInput)
+	select {
+	case l.C <- evt:
 	default:
-		return nil, ErrInvalidParam
+		l.sl.Lock()
+		l.stats.Dropped++
+		l.sl.Unlock()
+		return
+	}
+	port.UpdatePeak(&l.peak, len(l.C))
+}
+
+// accept updates the statistics of the event and returns false, if the event is suppressed by the debounce period.
+func (l *Line) accept(evt port.Event) bool {
+	l.sl.Lock()
+	defer l.sl.Unlock()
+
+	ts := evt.Timestamp
+	if l.stats.Events > 0 {
+		i := ts - l.last
+		if l.stats.Events == 1 || i < l.stats.MinInterval {
+			l.stats.MinInterval = i
+		}
+		if i > l.stats.MaxInterval {
+			l.stats.MaxInterval = i
+		}
+	}
+	l.stats.Events++
+	l.last = ts
+
+	if !l.debouncer.accept(evt) {
+		l.stats.Suppressed++
+		return false
 	}
+	return true
+}
 
-	return line, err
+// Stats returns the edge statistics, it's safe to call Stats concurrently.
+func (l *Line) Stats() LineStats {
+	l.sl.Lock()
+	defer l.sl.Unlock()
+	return l.stats
 }
 
-// Close releases the Chip.
-//
-// It does not release any lines which may be requested - they must be closed
-// independently.
-func (c *Chip) Close() error {
-	return c.gpiodChip.Close()
+// Value returns the current logical level of the line (0 or 1), which is inverted if the line is active low.
+func (l *Line) Value() (int, error) {
+	if l.emulated {
+		return int(atomic.LoadInt32(&l.level)), nil
+	}
+	return l.backend.Value()
+}
+
+// Fill returns the fill level of channel C.
+func (l *Line) Fill() port.ChannelFill {
+	return port.ChannelFill{Current: len(l.C), Peak: int(atomic.LoadInt32(&l.peak)), Capacity: cap(l.C)}
 }
 
 // Close releases all resources held by the requested line.
@@ -79,10 +253,20 @@ func (c *Chip) Close() error {
 // Note that this includes waiting for any running event handler to return.
 // As a consequence the Close must not be called from the context of the event
 // handler - the Close should be called from a different goroutine.
-func (l *Line) Close() error {
-	if err := l.gpiodLine.Close(); err != nil {
-		return err
-	}
-	close(l.C)
-	return nil
+// The event handler doesn't block (a full channel C drops the events), so Close can't hang.
+// Close can be called several times.
+func (l *Line) Close() (err error) {
+	l.closeOnce.Do(func() {
+		// an emulated line has no backend
+		if !l.emulated {
+			err = l.backend.Close()
+		}
+
+		l.hl.Lock()
+		defer l.hl.Unlock()
+		l.closed = true
+		close(l.C)
+		close(l.done)
+	})
+	return err
 }
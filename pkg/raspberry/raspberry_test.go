@@ -0,0 +1,129 @@
+package raspberry
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"tadl/pkg/port"
+)
+
+// waitGoroutines waits until the count of goroutines isn't greater than n.
+func waitGoroutines(t *testing.T, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > n {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %v goroutines, want %v", runtime.NumGoroutine(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLineClose(t *testing.T) {
+	chip := NewMockChip()
+	before := runtime.NumGoroutine()
+
+	l, err := chip.NewLineContext(context.Background(), 17, "none", 0, WithBuffer(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the full channel C doesn't block the close
+	chip.Line(17).Push(port.Event{Timestamp: time.Millisecond, Type: port.RisingEdge})
+	chip.Line(17).Push(port.Event{Timestamp: 2 * time.Millisecond, Type: port.FallingEdge})
+
+	done := make(chan error)
+	go func() { done <- l.Close() }()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("close of the line hangs")
+	}
+	waitGoroutines(t, before)
+
+	// the remaining event is received, then channel C is closed
+	if e, ok := <-l.C; !ok || e.Timestamp != time.Millisecond {
+		t.Errorf("got event %+v (%v), want the buffered event", e, ok)
+	}
+	if _, ok := <-l.C; ok {
+		t.Error("got an event after close, want a closed channel C")
+	}
+
+	// the events of a closed line are dropped, a second close is ignored
+	chip.Line(17).Push(port.Event{Timestamp: 3 * time.Millisecond, Type: port.RisingEdge})
+	if err = l.Close(); err != nil {
+		t.Errorf("got error %v of the second close, want nil", err)
+	}
+}
+
+func TestLineCloseContext(t *testing.T) {
+	chip := NewMockChip()
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l, err := chip.NewLineContext(ctx, 17, "none", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-l.C:
+		if ok {
+			t.Fatal("got an event, want a closed channel C")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("line isn't closed by the context")
+	}
+	waitGoroutines(t, before)
+}
+
+func TestLineBuffer(t *testing.T) {
+	chip := NewMockChip()
+	l, err := chip.NewLine(17, "none", 0, WithBuffer(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// nobody reads channel C, the push of a full channel doesn't block
+	for i := 1; i <= 5; i++ {
+		chip.Line(17).Push(port.Event{Timestamp: time.Duration(i) * time.Millisecond, Type: port.RisingEdge})
+	}
+
+	if s := l.Stats(); s.Events != 5 || s.Dropped != 3 {
+		t.Errorf("got events %v dropped %v, want 5 3", s.Events, s.Dropped)
+	}
+	if f := l.Fill(); f != (port.ChannelFill{Current: 2, Peak: 2, Capacity: 2}) {
+		t.Errorf("got fill %+v, want a full channel of capacity 2", f)
+	}
+	// the oldest events are kept
+	if e := <-l.C; e.Timestamp != time.Millisecond {
+		t.Errorf("got first event at %v, want 1ms", e.Timestamp)
+	}
+
+	// the dropping is resolved by the consumer
+	chip.Line(17).Push(port.Event{Timestamp: 6 * time.Millisecond, Type: port.RisingEdge})
+	if s := l.Stats(); s.Dropped != 3 || len(l.C) != 2 {
+		t.Errorf("got dropped %v and %v buffered events, want 3 and 2", s.Dropped, len(l.C))
+	}
+
+	for _, n := range []int{0, -1} {
+		if _, err = chip.NewLine(18, "none", 0, WithBuffer(n)); err != ErrInvalidParam {
+			t.Errorf("got error %v of buffer %v, want %v", err, n, ErrInvalidParam)
+		}
+	}
+	d, err := chip.NewLine(18, "none", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if cap(d.C) != defaultBuffer {
+		t.Errorf("got buffer %v, want the default buffer %v", cap(d.C), defaultBuffer)
+	}
+}